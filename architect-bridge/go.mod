@@ -2,9 +2,14 @@ module architect-bridge
 
 go 1.22
 
-require github.com/jackc/pgx/v5 v5.7.2
+require (
+	github.com/affanhamid/editor/pglisten v0.0.0
+	github.com/jackc/pgx/v5 v5.7.2
+)
 
 require (
+	github.com/affanhamid/editor/logging v0.0.0
+	github.com/affanhamid/editor/promtext v0.0.0
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
@@ -12,3 +17,9 @@ require (
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 )
+
+replace github.com/affanhamid/editor/pglisten => ../pglisten
+
+replace github.com/affanhamid/editor/logging => ../logging
+
+replace github.com/affanhamid/editor/promtext => ../promtext
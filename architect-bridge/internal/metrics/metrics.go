@@ -0,0 +1,38 @@
+// Package metrics holds the bridge's Prometheus metrics, served with
+// --metrics-addr.
+package metrics
+
+import "github.com/affanhamid/editor/promtext"
+
+// Registry holds every bridge metric.
+var Registry = promtext.NewRegistry()
+
+var (
+	Clients = Registry.Gauge("architect_bridge_clients",
+		"Editor clients connected to the bridge socket.")
+	EventsForwarded = Registry.Counter("architect_bridge_events_total",
+		"Outbox events forwarded to clients, by event type.", "type")
+	Commands = Registry.Counter("architect_bridge_commands_total",
+		"Commands received from clients, by command type.", "command")
+	CommandErrors = Registry.Counter("architect_bridge_command_errors_total",
+		"Commands that failed, by command type.", "command")
+	ListenReconnects = Registry.Counter("architect_listen_reconnects_total",
+		"Times the LISTEN connection to Postgres was re-established.")
+)
+
+// commandTypes are the command types the bridge handles.
+var commandTypes = map[string]bool{
+	"submit_prompt": true, "approve_consultation": true, "kill_agent": true,
+	"orchestrator_command": true, "pause_agent": true, "resume_agent": true,
+	"pause_swarm": true, "resume_swarm": true, "post_message": true,
+	"review_plan": true, "request_snapshot": true,
+}
+
+// CommandLabel is the label value of a command type. Clients choose command
+// types, so unknown ones are counted together as "other".
+func CommandLabel(commandType string) string {
+	if commandTypes[commandType] {
+		return commandType
+	}
+	return "other"
+}
@@ -3,67 +3,49 @@ package pg
 import (
 	"context"
 	"encoding/json"
-	"fmt"
-	"log"
-	"time"
 
+	"architect-bridge/internal/metrics"
 	"architect-bridge/internal/protocol"
 
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/pglisten"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-var channels = []string{"agent_messages", "context_updates", "task_updates", "agent_updates"}
+// Consumer is the bridge's name in event_consumers.
+const Consumer = "bridge"
 
-func StartListener(ctx context.Context, dbURL string, eventCh chan<- protocol.Event) {
-	for {
-		if ctx.Err() != nil {
-			return
+// StartListener forwards events from the outbox, starting after the last one
+// the bridge acknowledged, until ctx is cancelled. The receiver calls Ack
+// once an event has been delivered to clients. Events missed while the
+// connection was down follow in order after a reconnect, so clients need
+// no fresh snapshot then.
+func StartListener(ctx context.Context, pool *pgxpool.Pool, dbURL string, eventCh chan<- protocol.Event) {
+	events := make(chan pglisten.Event)
+	go func() {
+		for e := range events {
+			eventCh <- outboxToEvent(e)
 		}
-		err := listenLoop(ctx, dbURL, eventCh)
-		if err != nil {
-			if ctx.Err() != nil {
-				return
-			}
-			log.Printf("listener: connection lost: %v, reconnecting in 2s...", err)
-			time.Sleep(2 * time.Second)
-		}
-	}
-}
-
-func listenLoop(ctx context.Context, dbURL string, eventCh chan<- protocol.Event) error {
-	conn, err := pgx.Connect(ctx, dbURL)
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
-	}
-	defer conn.Close(ctx)
+	}()
+	defer close(events)
 
-	for _, ch := range channels {
-		_, err := conn.Exec(ctx, "LISTEN "+ch)
-		if err != nil {
-			return fmt.Errorf("failed to listen on %s: %w", ch, err)
-		}
+	c := &pglisten.Consumer{Name: Consumer, Pool: pool, ConnString: dbURL, Logger: logging.For("pglisten"),
+		OnReconnect: func() { metrics.ListenReconnects.Inc() }}
+	if err := c.Run(ctx, events); err != nil {
+		logging.For("pglisten").Error("event consumer stopped", "err", err)
 	}
+}
 
-	log.Printf("listener: listening on %v", channels)
-
-	for {
-		notification, err := conn.WaitForNotification(ctx)
-		if err != nil {
-			if ctx.Err() != nil {
-				return nil
-			}
-			return fmt.Errorf("notification error: %w", err)
-		}
-		event := notificationToEvent(notification)
-		eventCh <- event
-	}
+// Ack records that every event up to seq has been forwarded.
+func Ack(ctx context.Context, pool *pgxpool.Pool, seq int64) error {
+	c := &pglisten.Consumer{Name: Consumer, Pool: pool}
+	return c.Ack(ctx, seq)
 }
 
-func notificationToEvent(n *pgconn.Notification) protocol.Event {
+func outboxToEvent(e pglisten.Event) protocol.Event {
 	var data interface{}
-	if err := json.Unmarshal([]byte(n.Payload), &data); err != nil {
-		data = map[string]interface{}{"raw": n.Payload}
+	if err := json.Unmarshal(e.Payload, &data); err != nil {
+		data = map[string]interface{}{"raw": string(e.Payload)}
 	}
 
 	typeMap := map[string]string{
@@ -71,14 +53,18 @@ func notificationToEvent(n *pgconn.Notification) protocol.Event {
 		"context_updates": "context_update",
 		"task_updates":    "task_update",
 		"agent_updates":   "agent_update",
+		"swarm_updates":   "swarm_update",
+		"command_results": "command_result",
+		"plan_updates":    "plan_update",
 	}
 
-	eventType := typeMap[n.Channel]
+	eventType := typeMap[e.Channel]
 	if eventType == "" {
-		eventType = n.Channel
+		eventType = e.Channel
 	}
 
 	return protocol.Event{
+		Seq:  e.Seq,
 		Type: eventType,
 		Data: data,
 	}
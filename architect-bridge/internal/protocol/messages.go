@@ -3,6 +3,7 @@ package protocol
 import "encoding/json"
 
 type Event struct {
+	Seq  int64       `json:"seq,omitempty"`
 	Type string      `json:"type"`
 	Data interface{} `json:"data"`
 }
@@ -4,12 +4,17 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
-	"log"
 	"net"
 	"os"
 	"sync"
+
+	"architect-bridge/internal/metrics"
+
+	"github.com/affanhamid/editor/logging"
 )
 
+var logger = logging.For("socket")
+
 type ClientConn struct {
 	conn net.Conn
 	mu   sync.Mutex
@@ -43,12 +48,13 @@ func (s *SocketServer) Start(ctx context.Context) {
 	os.Remove(s.path)
 	listener, err := net.Listen("unix", s.path)
 	if err != nil {
-		log.Fatalf("socket: failed to listen: %v", err)
+		logger.Error("failed to listen", "path", s.path, "err", err)
+		os.Exit(1)
 	}
 	defer listener.Close()
 	defer os.Remove(s.path)
 
-	log.Printf("socket: listening on %s", s.path)
+	logger.Info("listening", "path", s.path)
 
 	go func() {
 		<-ctx.Done()
@@ -61,12 +67,13 @@ func (s *SocketServer) Start(ctx context.Context) {
 			if ctx.Err() != nil {
 				return
 			}
-			log.Printf("socket: accept error: %v", err)
+			logger.Warn("accept failed", "err", err)
 			continue
 		}
 		client := &ClientConn{conn: conn}
 		s.mu.Lock()
 		s.clients = append(s.clients, client)
+		metrics.Clients.Set(float64(len(s.clients)))
 		s.mu.Unlock()
 
 		go s.handleClient(client)
@@ -79,7 +86,8 @@ func (s *SocketServer) handleClient(client *ClientConn) {
 	for scanner.Scan() {
 		var cmd Command
 		if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
-			log.Printf("socket: invalid command: %v", err)
+			logger.Warn("invalid command", "err", err)
+			metrics.CommandErrors.Inc("invalid")
 			continue
 		}
 		cmd.Conn = client
@@ -94,16 +102,20 @@ func (s *SocketServer) handleClient(client *ClientConn) {
 			break
 		}
 	}
+	metrics.Clients.Set(float64(len(s.clients)))
 	s.mu.Unlock()
 	client.conn.Close()
 }
 
-func (s *SocketServer) Broadcast(event Event) {
+// Broadcast sends event to every connected client and returns how many
+// there were.
+func (s *SocketServer) Broadcast(event Event) int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	for _, client := range s.clients {
 		client.Send(event)
 	}
+	return len(s.clients)
 }
 
 func (s *SocketServer) Commands() <-chan Command {
@@ -0,0 +1,54 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrPlanNotPending is returned by ReviewPlan for a plan that is not
+// awaiting review: already reviewed, or expired with the run that proposed it.
+var ErrPlanNotPending = errors.New("plan is not awaiting review")
+
+// PlanReview is the data of a review_plan command:
+// {"plan_id": 1, "action": "approve" | "reject", "tasks": [...]}.
+// Tasks, if given, approve an edited plan.
+type PlanReview struct {
+	PlanID int64           `json:"plan_id"`
+	Action string          `json:"action"`
+	Tasks  json.RawMessage `json:"tasks"`
+}
+
+// ReviewPlan records a reviewer's decision on a plan awaiting review, as
+// `architect plan` does. The orchestrator waiting on the plan checks an
+// approved one and sends it back for review if it cannot run.
+func ReviewPlan(ctx context.Context, pool *pgxpool.Pool, r PlanReview) error {
+	status, ok := map[string]string{"approve": "approved", "reject": "rejected"}[r.Action]
+	if !ok {
+		return fmt.Errorf("invalid action %q", r.Action)
+	}
+	var edited []byte
+	if r.Action == "approve" && len(r.Tasks) > 0 {
+		var err error
+		if edited, err = json.Marshal(map[string]json.RawMessage{"tasks": r.Tasks}); err != nil {
+			return fmt.Errorf("invalid tasks: %w", err)
+		}
+	}
+	tag, err := pool.Exec(ctx,
+		`UPDATE plans
+		 SET status = $2,
+		     approved = CASE WHEN $2 = 'approved' THEN COALESCE($3::jsonb, proposed) END,
+		     review_error = NULL, reviewed_by = 'human', reviewed_at = NOW()
+		 WHERE id = $1 AND status = 'pending_review'`,
+		r.PlanID, status, edited)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPlanNotPending
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testSchema holds the plans table the tests use, in the database at
+// TEST_DATABASE_URL. It mirrors schema/migrations/019_create_plans.sql and
+// 027_add_plan_expired.sql.
+const testSchema = `
+DROP SCHEMA IF EXISTS bridge_state_test CASCADE;
+CREATE SCHEMA bridge_state_test;
+CREATE TABLE bridge_state_test.plans (
+    id           BIGSERIAL PRIMARY KEY,
+    prompt       TEXT NOT NULL,
+    status       VARCHAR(32) NOT NULL DEFAULT 'pending_review'
+                 CHECK (status IN ('pending_review', 'approved', 'rejected', 'expired')),
+    proposed     JSONB NOT NULL,
+    approved     JSONB NULL,
+    review_error TEXT NULL,
+    reviewed_by  VARCHAR(64) NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reviewed_at  TIMESTAMPTZ NULL
+);`
+
+// openPlans creates the plans table in a schema of its own and returns a
+// pool that uses it.
+func openPlans(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", "bridge_state_test")
+	u.RawQuery = q.Encode()
+
+	pool, err := pgxpool.New(context.Background(), u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := pool.Exec(context.Background(), testSchema); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+// createPlan adds a plan with the given status, as the orchestrator does.
+func createPlan(t *testing.T, pool *pgxpool.Pool, status string) int64 {
+	t.Helper()
+	var id int64
+	err := pool.QueryRow(context.Background(),
+		`INSERT INTO plans (prompt, status, proposed) VALUES ('build it', $1, '{"tasks": [{"id": 1, "title": "proposed"}]}')
+		 RETURNING id`, status).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// planRow returns a plan's status and approved tasks.
+func planRow(t *testing.T, pool *pgxpool.Pool, id int64) (status, approvedTitle string) {
+	t.Helper()
+	var approved []byte
+	err := pool.QueryRow(context.Background(), `SELECT status, approved FROM plans WHERE id = $1`, id).Scan(&status, &approved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved != nil {
+		var plan struct {
+			Tasks []struct {
+				Title string `json:"title"`
+			} `json:"tasks"`
+		}
+		if err := json.Unmarshal(approved, &plan); err != nil || len(plan.Tasks) != 1 {
+			t.Fatalf("approved plan %s: %v", approved, err)
+		}
+		approvedTitle = plan.Tasks[0].Title
+	}
+	return status, approvedTitle
+}
+
+func TestReviewPlan(t *testing.T) {
+	pool := openPlans(t)
+	ctx := context.Background()
+
+	approved := createPlan(t, pool, "pending_review")
+	if err := ReviewPlan(ctx, pool, PlanReview{PlanID: approved, Action: "approve"}); err != nil {
+		t.Fatal(err)
+	}
+	if status, title := planRow(t, pool, approved); status != "approved" || title != "proposed" {
+		t.Errorf("approved plan: %s %q", status, title)
+	}
+
+	edited := createPlan(t, pool, "pending_review")
+	tasks := json.RawMessage(`[{"id": 1, "title": "edited"}]`)
+	if err := ReviewPlan(ctx, pool, PlanReview{PlanID: edited, Action: "approve", Tasks: tasks}); err != nil {
+		t.Fatal(err)
+	}
+	if status, title := planRow(t, pool, edited); status != "approved" || title != "edited" {
+		t.Errorf("edited plan: %s %q", status, title)
+	}
+
+	rejected := createPlan(t, pool, "pending_review")
+	if err := ReviewPlan(ctx, pool, PlanReview{PlanID: rejected, Action: "reject", Tasks: tasks}); err != nil {
+		t.Fatal(err)
+	}
+	if status, title := planRow(t, pool, rejected); status != "rejected" || title != "" {
+		t.Errorf("rejected plan: %s %q", status, title)
+	}
+}
+
+func TestReviewPlanRefused(t *testing.T) {
+	pool := openPlans(t)
+	ctx := context.Background()
+
+	pending := createPlan(t, pool, "pending_review")
+	if err := ReviewPlan(ctx, pool, PlanReview{PlanID: pending, Action: "edit"}); err == nil {
+		t.Error("expected an unknown action to be refused")
+	}
+	for _, status := range []string{"approved", "rejected", "expired"} {
+		id := createPlan(t, pool, status)
+		if err := ReviewPlan(ctx, pool, PlanReview{PlanID: id, Action: "approve"}); !errors.Is(err, ErrPlanNotPending) {
+			t.Errorf("%s plan: got %v, want ErrPlanNotPending", status, err)
+		}
+	}
+	if status, _ := planRow(t, pool, pending); status != "pending_review" {
+		t.Errorf("refused review changed the plan to %s", status)
+	}
+}
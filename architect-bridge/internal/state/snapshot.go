@@ -2,10 +2,13 @@ package state
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"architect-bridge/internal/protocol"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -41,11 +44,21 @@ type Edge struct {
 	EdgeType string `json:"edge_type"`
 }
 
+// Plan is a decomposed plan awaiting review.
+type Plan struct {
+	ID          int             `json:"id"`
+	Prompt      string          `json:"prompt"`
+	Proposed    json.RawMessage `json:"proposed"`
+	ReviewError string          `json:"review_error,omitempty"`
+}
+
 type Snapshot struct {
-	Agents   []Agent   `json:"agents"`
-	Tasks    []Task    `json:"tasks"`
-	Messages []Message `json:"messages"`
-	Edges    []Edge    `json:"edges"`
+	Agents      []Agent   `json:"agents"`
+	Tasks       []Task    `json:"tasks"`
+	Messages    []Message `json:"messages"`
+	Edges       []Edge    `json:"edges"`
+	SwarmPaused bool      `json:"swarm_paused"`
+	PendingPlan *Plan     `json:"pending_plan"`
 }
 
 func GetSnapshot(ctx context.Context, db *pgxpool.Pool) (*Snapshot, error) {
@@ -107,6 +120,23 @@ func GetSnapshot(ctx context.Context, db *pgxpool.Pool) (*Snapshot, error) {
 		snapshot.Edges = append(snapshot.Edges, e)
 	}
 
+	// Get swarm run state
+	if err := db.QueryRow(ctx, `SELECT paused FROM swarm_state`).Scan(&snapshot.SwarmPaused); err != nil {
+		return nil, err
+	}
+
+	// Get the plan awaiting review, if any
+	var p Plan
+	err = db.QueryRow(ctx,
+		`SELECT id, prompt, proposed, COALESCE(review_error, '') FROM plans
+		 WHERE status = 'pending_review' ORDER BY id DESC LIMIT 1`,
+	).Scan(&p.ID, &p.Prompt, &p.Proposed, &p.ReviewError)
+	if err == nil {
+		snapshot.PendingPlan = &p
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
 	return snapshot, nil
 }
 
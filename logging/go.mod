@@ -0,0 +1,3 @@
+module github.com/affanhamid/editor/logging
+
+go 1.22
@@ -0,0 +1,214 @@
+// Package logging sets up log/slog for the orchestrator, mcp-pg and
+// architect-bridge. All three use the same attribute keys, so one grep for
+// task_id=42 follows a task through every process of a run.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+)
+
+// Attribute keys shared by every architect binary.
+const (
+	RunID     = "run_id"
+	TaskID    = "task_id"
+	AgentID   = "agent_id"
+	Tool      = "tool"
+	Component = "component"
+)
+
+// Environment variables through which the orchestrator hands its logging
+// settings to the mcp-pg of each agent.
+const (
+	RunIDEnv  = "ARCHITECT_RUN_ID"
+	FormatEnv = "ARCHITECT_LOG_FORMAT"
+	LevelEnv  = "ARCHITECT_LOG_LEVEL"
+	FileEnv   = "ARCHITECT_LOG_FILE"
+)
+
+// Options configure Setup.
+type Options struct {
+	// Format is "text" (the default) or "json".
+	Format string
+	// Level is a default level, optionally followed by per-component
+	// levels: "info" or "info,spawn=debug,pglisten=warn".
+	Level string
+	// RunID, if set, is attached to every record.
+	RunID string
+}
+
+// Setup makes a logger writing to w the default for slog and for the log
+// package.
+func Setup(w io.Writer, opts Options) error {
+	levels, err := ParseLevels(opts.Level)
+	if err != nil {
+		return err
+	}
+	// The inner handler lets everything through; levelHandler filters.
+	handlerOpts := &slog.HandlerOptions{Level: levels.min()}
+	var inner slog.Handler
+	switch opts.Format {
+	case "", "text":
+		inner = slog.NewTextHandler(w, handlerOpts)
+	case "json":
+		inner = slog.NewJSONHandler(w, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q (known: text, json)", opts.Format)
+	}
+	logger := slog.New(&levelHandler{inner: inner, levels: levels, level: levels.Default})
+	if opts.RunID != "" {
+		logger = logger.With(RunID, opts.RunID)
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// Levels are the minimum levels logged, by component.
+type Levels struct {
+	Default    slog.Level
+	Components map[string]slog.Level
+}
+
+// ParseLevels parses a level spec such as "info,spawn=debug". An empty spec
+// is "info".
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: slog.LevelInfo, Components: map[string]slog.Level{}}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		component, name, hasComponent := strings.Cut(part, "=")
+		if !hasComponent {
+			name = component
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(name)); err != nil {
+			return levels, fmt.Errorf("log level %q: %w", part, err)
+		}
+		if hasComponent {
+			levels.Components[component] = level
+		} else {
+			levels.Default = level
+		}
+	}
+	return levels, nil
+}
+
+// For returns the level of a component.
+func (l Levels) For(component string) slog.Level {
+	if level, ok := l.Components[component]; ok {
+		return level
+	}
+	return l.Default
+}
+
+func (l Levels) min() slog.Level {
+	m := l.Default
+	for _, level := range l.Components {
+		m = min(m, level)
+	}
+	return m
+}
+
+// levelHandler applies the level of the component a logger was created for.
+type levelHandler struct {
+	inner  slog.Handler
+	levels Levels
+	level  slog.Level
+}
+
+func (h *levelHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level
+}
+
+func (h *levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	level := h.level
+	for _, a := range attrs {
+		if a.Key == Component {
+			level = h.levels.For(a.Value.String())
+		}
+	}
+	return &levelHandler{inner: h.inner.WithAttrs(attrs), levels: h.levels, level: level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{inner: h.inner.WithGroup(name), levels: h.levels, level: h.level}
+}
+
+// For returns the logger of a component. It follows the default logger at
+// the time of each call, so package-level loggers created before Setup
+// still use its settings.
+func For(component string) *slog.Logger {
+	return slog.New(newDeferredHandler([]deferredOp{{attrs: []slog.Attr{slog.String(Component, component)}}}))
+}
+
+// deferredHandler resolves slog's default handler when a record is logged,
+// applying its attributes and groups to it then.
+type deferredHandler struct {
+	ops []deferredOp
+	// resolved caches the handler built for the current default logger.
+	resolved *atomic.Pointer[resolvedHandler]
+}
+
+// deferredOp is a WithAttrs (attrs) or WithGroup (group) call to replay.
+type deferredOp struct {
+	attrs []slog.Attr
+	group string
+}
+
+type resolvedHandler struct {
+	logger  *slog.Logger
+	handler slog.Handler
+}
+
+func newDeferredHandler(ops []deferredOp) deferredHandler {
+	return deferredHandler{ops: ops, resolved: new(atomic.Pointer[resolvedHandler])}
+}
+
+func (h deferredHandler) target() slog.Handler {
+	logger := slog.Default()
+	if r := h.resolved.Load(); r != nil && r.logger == logger {
+		return r.handler
+	}
+	handler := logger.Handler()
+	for _, op := range h.ops {
+		if op.group != "" {
+			handler = handler.WithGroup(op.group)
+		} else {
+			handler = handler.WithAttrs(op.attrs)
+		}
+	}
+	h.resolved.Store(&resolvedHandler{logger: logger, handler: handler})
+	return handler
+}
+
+func (h deferredHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.target().Enabled(ctx, level)
+}
+
+func (h deferredHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.target().Handle(ctx, r)
+}
+
+func (h deferredHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	return newDeferredHandler(append(h.ops[:len(h.ops):len(h.ops)], deferredOp{attrs: attrs}))
+}
+
+func (h deferredHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return newDeferredHandler(append(h.ops[:len(h.ops):len(h.ops)], deferredOp{group: name}))
+}
@@ -0,0 +1,91 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("warn, spawn=debug,pglisten=error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if levels.Default != slog.LevelWarn {
+		t.Errorf("default = %v, want WARN", levels.Default)
+	}
+	if got := levels.For("spawn"); got != slog.LevelDebug {
+		t.Errorf("spawn = %v, want DEBUG", got)
+	}
+	if got := levels.For("monitor"); got != slog.LevelWarn {
+		t.Errorf("monitor = %v, want WARN", got)
+	}
+
+	if levels, err := ParseLevels(""); err != nil || levels.Default != slog.LevelInfo {
+		t.Errorf("empty spec = %v, %v; want INFO", levels.Default, err)
+	}
+	if _, err := ParseLevels("spawn=loud"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestSetupComponentLevels(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	// Created before Setup, like a package-level logger.
+	spawn := For("spawn")
+	monitor := For("monitor")
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, Options{Format: "json", Level: "warn,spawn=debug", RunID: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	spawn.Debug("spawned", AgentID, "a1", TaskID, int64(7))
+	monitor.Info("dropped")
+	monitor.Warn("kept")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2:\n%s", len(lines), buf.String())
+	}
+	var entry map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "spawned" || entry[Component] != "spawn" || entry[RunID] != "r1" || entry[AgentID] != "a1" || entry[TaskID] != float64(7) {
+		t.Errorf("unexpected entry %v", entry)
+	}
+	if !strings.Contains(lines[1], `"msg":"kept"`) {
+		t.Errorf("unexpected second line %s", lines[1])
+	}
+}
+
+func TestForWithGroupBeforeSetup(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+
+	// A grouped package-level logger still follows Setup.
+	spawn := For("spawn").WithGroup("limits")
+
+	var buf bytes.Buffer
+	if err := Setup(&buf, Options{Format: "json", Level: "warn,spawn=debug"}); err != nil {
+		t.Fatal(err)
+	}
+	spawn.Debug("applied", "cpu", 2)
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v in %q", err, buf.String())
+	}
+	group, _ := entry["limits"].(map[string]any)
+	if entry[Component] != "spawn" || group["cpu"] != float64(2) {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
+
+func TestSetupRejectsUnknownFormat(t *testing.T) {
+	if err := Setup(&bytes.Buffer{}, Options{Format: "xml"}); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -14,6 +14,7 @@ function M.setup(opts)
   local dag = require("architect.ui.dag_view")
   local prompt = require("architect.ui.prompt_input")
   local consultation = require("architect.ui.consultation")
+  local plan_review = require("architect.ui.plan_review")
 
   -- Start the bridge binary if configured
   if M.config.bridge_binary then
@@ -23,9 +24,9 @@ function M.setup(opts)
       "--socket", M.config.socket_path,
     }, { detach = true })
     -- Give it a moment to start
-    vim.defer_fn(function() M.connect_bridge(bridge, swarm, chat, dag, consultation) end, 500)
+    vim.defer_fn(function() M.connect_bridge(bridge, swarm, chat, dag, consultation, plan_review) end, 500)
   else
-    M.connect_bridge(bridge, swarm, chat, dag, consultation)
+    M.connect_bridge(bridge, swarm, chat, dag, consultation, plan_review)
   end
 
   -- Keymaps
@@ -44,12 +45,17 @@ function M.setup(opts)
     bridge.send({ type = "request_snapshot" })
   end, { desc = "Architect: DAG View" })
 
+  vim.keymap.set("n", "<leader>ar", function()
+    M.pending_plan = true
+    bridge.send({ type = "request_snapshot" })
+  end, { desc = "Architect: Review Plan" })
+
   vim.keymap.set("n", "<leader>ap", function()
     prompt.show(bridge)
   end, { desc = "Architect: Submit Prompt" })
 end
 
-function M.connect_bridge(bridge, swarm, chat, dag, consultation)
+function M.connect_bridge(bridge, swarm, chat, dag, consultation, plan_review)
   bridge.connect(M.config.socket_path, function(event)
     if event.type == "snapshot" then
       swarm.update(event.data.agents or {})
@@ -60,6 +66,14 @@ function M.connect_bridge(bridge, swarm, chat, dag, consultation)
         dag.show(event.data.tasks or {}, event.data.edges or {})
         M.pending_dag = false
       end
+      if M.pending_plan then
+        if event.data.pending_plan then
+          plan_review.show(event.data.pending_plan, bridge)
+        else
+          vim.notify("Architect: no plan awaiting review", vim.log.levels.INFO)
+        end
+        M.pending_plan = false
+      end
 
     elseif event.type == "agent_update" then
       swarm.update_single(event.data)
@@ -73,9 +87,19 @@ function M.connect_bridge(bridge, swarm, chat, dag, consultation)
         )
       end
 
+    elseif event.type == "swarm_update" then
+      vim.notify(event.data.paused and "Architect: swarm paused" or "Architect: swarm resumed", vim.log.levels.INFO)
+
     elseif event.type == "task_update" then
       -- Use event data directly instead of requesting full snapshot
 
+    elseif event.type == "plan_update" then
+      if event.data.status == "pending_review" then
+        plan_review.show(event.data, bridge)
+      else
+        vim.notify("Architect: plan " .. event.data.status, vim.log.levels.INFO)
+      end
+
     elseif event.type == "consultation_request" then
       consultation.show(event.data, bridge)
     end
@@ -0,0 +1,98 @@
+local NuiPopup = require("nui.popup")
+
+local M = {}
+
+-- Opens the plan's tasks as JSON, one task per line; writing the buffer
+-- approves the edited plan.
+local function edit(plan, bridge)
+  local lines = { "[" }
+  local tasks = plan.proposed and plan.proposed.tasks or {}
+  for i, task in ipairs(tasks) do
+    table.insert(lines, "  " .. vim.json.encode(task) .. (i < #tasks and "," or ""))
+  end
+  table.insert(lines, "]")
+
+  vim.cmd("tabnew")
+  local buf = vim.api.nvim_get_current_buf()
+  vim.api.nvim_buf_set_name(buf, "architect://plan/" .. plan.id)
+  vim.bo[buf].buftype = "acwrite"
+  vim.bo[buf].filetype = "json"
+  vim.bo[buf].bufhidden = "wipe"
+  vim.api.nvim_buf_set_lines(buf, 0, -1, false, lines)
+  vim.bo[buf].modified = false
+
+  vim.api.nvim_create_autocmd("BufWriteCmd", {
+    buffer = buf,
+    callback = function()
+      local text = table.concat(vim.api.nvim_buf_get_lines(buf, 0, -1, false), "\n")
+      local ok, edited = pcall(vim.json.decode, text)
+      if not ok or type(edited) ~= "table" then
+        vim.notify("Plan is not a JSON array of tasks", vim.log.levels.ERROR)
+        return
+      end
+      bridge.send({ type = "review_plan", data = { plan_id = plan.id, action = "approve", tasks = edited } })
+      vim.bo[buf].modified = false
+      vim.cmd("bwipeout")
+      vim.notify("Plan approved with edits", vim.log.levels.INFO)
+    end,
+  })
+end
+
+function M.show(plan, bridge)
+  local popup = NuiPopup({
+    position = "50%",
+    size = { width = 90, height = 25 },
+    border = {
+      style = "double",
+      text = { top = " PLAN REVIEW #" .. plan.id .. " ", top_align = "center" },
+    },
+    buf_options = { modifiable = false },
+  })
+  popup:mount()
+
+  local lines = { "" }
+  for line in (plan.prompt or ""):gmatch("[^\n]+") do
+    table.insert(lines, "  " .. line)
+  end
+  if plan.review_error and plan.review_error ~= "" then
+    table.insert(lines, "")
+    table.insert(lines, "  Returned for review: " .. plan.review_error)
+  end
+  table.insert(lines, "")
+  table.insert(lines, "  " .. string.rep("─", 80))
+  table.insert(lines, "")
+  for _, task in ipairs(plan.proposed and plan.proposed.tasks or {}) do
+    local blocked = #(task.blocked_by or {}) > 0 and " ← " .. table.concat(task.blocked_by, ",") or ""
+    table.insert(lines, string.format("  %3d  [%-6s] %s%s", task.id, task.risk_level or "?", task.title or "", blocked))
+  end
+  table.insert(lines, "")
+  table.insert(lines, "  " .. string.rep("─", 80))
+  table.insert(lines, "")
+  table.insert(lines, "  [a] Approve    [r] Reject    [e] Edit    [q] Dismiss")
+
+  vim.bo[popup.bufnr].modifiable = true
+  vim.api.nvim_buf_set_lines(popup.bufnr, 0, -1, false, lines)
+  vim.bo[popup.bufnr].modifiable = false
+
+  popup:map("n", "a", function()
+    bridge.send({ type = "review_plan", data = { plan_id = plan.id, action = "approve" } })
+    popup:unmount()
+    vim.notify("Plan approved", vim.log.levels.INFO)
+  end)
+
+  popup:map("n", "r", function()
+    bridge.send({ type = "review_plan", data = { plan_id = plan.id, action = "reject" } })
+    popup:unmount()
+    vim.notify("Plan rejected", vim.log.levels.WARN)
+  end)
+
+  popup:map("n", "e", function()
+    popup:unmount()
+    edit(plan, bridge)
+  end)
+
+  popup:map("n", "q", function() popup:unmount() end)
+  popup:map("n", "<Esc>", function() popup:unmount() end)
+end
+
+return M
@@ -5,7 +5,9 @@ M.status_icons = {
   working  = "●",
   idle     = "○",
   blocked  = "■",
+  paused   = "⏸",
   dead     = "✗",
+  stopped  = "□",
 }
 
 M.status_hl = {
@@ -13,7 +15,9 @@ M.status_hl = {
   working  = "DiagnosticOk",
   idle     = "Comment",
   blocked  = "DiagnosticWarn",
+  paused   = "DiagnosticHint",
   dead     = "DiagnosticError",
+  stopped  = "Comment",
 }
 
 M.task_icons = {
@@ -21,6 +25,7 @@ M.task_icons = {
   in_progress = "●",
   completed   = "✓",
   failed      = "✗",
+  cancelled   = "⊘",
   blocked     = "■",
 }
 
@@ -31,6 +36,7 @@ M.type_prefix = {
   blocker   = "[BLK]",
   discovery = "[DSC]",
   decision  = "[DEC]",
+  warning   = "[WRN]",
 }
 
 function M.truncate(str, max_len)
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type Lease struct {
+	Path       string    `json:"path"`
+	AgentID    string    `json:"agent_id"`
+	TaskID     *int64    `json:"task_id,omitempty"`
+	Reason     *string   `json:"reason,omitempty"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// LeaseHeldError is returned by AcquireLease when another agent holds an
+// unexpired lease on the path.
+type LeaseHeldError struct {
+	Lease Lease
+	// Remaining is how long the lease has left.
+	Remaining time.Duration
+}
+
+func (e *LeaseHeldError) Error() string {
+	holder := e.Lease.AgentID
+	if e.Lease.TaskID != nil {
+		holder = fmt.Sprintf("%s (task %d)", holder, *e.Lease.TaskID)
+	}
+	msg := fmt.Sprintf("%s is leased by %s for another %s", e.Lease.Path, holder, e.Remaining.Round(time.Second))
+	if e.Lease.Reason != nil {
+		msg += ": " + *e.Lease.Reason
+	}
+	return msg
+}
+
+const leaseColumns = `path, agent_id, task_id, reason, acquired_at, expires_at`
+
+func scanLease(row pgx.Row) (Lease, error) {
+	var l Lease
+	err := row.Scan(&l.Path, &l.AgentID, &l.TaskID, &l.Reason, &l.AcquiredAt, &l.ExpiresAt)
+	return l, err
+}
+
+// AcquireLease takes a lease on path for ttl, or extends the agent's own
+// lease on it. The lease is tied to the agent's current task. If another
+// agent holds an unexpired lease, a *LeaseHeldError describes it.
+func (q *Queries) AcquireLease(ctx context.Context, agentID, path string, ttl time.Duration, reason *string) (*Lease, error) {
+	// The holder may release between the two statements; try again then.
+	for range 3 {
+		l, err := scanLease(q.Pool.QueryRow(ctx,
+			`INSERT INTO file_leases (path, agent_id, task_id, reason, expires_at)
+			 VALUES ($1, $2, (SELECT current_task_id FROM agents WHERE agent_id = $2), $3, NOW() + make_interval(secs => $4))
+			 ON CONFLICT (path) DO UPDATE
+			   SET agent_id = EXCLUDED.agent_id,
+			       task_id = EXCLUDED.task_id,
+			       reason = EXCLUDED.reason,
+			       acquired_at = CASE WHEN file_leases.agent_id = EXCLUDED.agent_id
+			                          THEN file_leases.acquired_at ELSE NOW() END,
+			       expires_at = EXCLUDED.expires_at
+			   WHERE file_leases.agent_id = EXCLUDED.agent_id OR file_leases.expires_at <= NOW()
+			 RETURNING `+leaseColumns,
+			path, agentID, reason, ttl.Seconds(),
+		))
+		if err == nil {
+			return &l, nil
+		}
+		if err != pgx.ErrNoRows {
+			return nil, fmt.Errorf("acquire_lease: %w", err)
+		}
+
+		var remaining float64
+		var held Lease
+		err = q.Pool.QueryRow(ctx,
+			`SELECT `+leaseColumns+`, EXTRACT(EPOCH FROM expires_at - NOW())
+			 FROM file_leases
+			 WHERE path = $1 AND expires_at > NOW()`,
+			path,
+		).Scan(&held.Path, &held.AgentID, &held.TaskID, &held.Reason, &held.AcquiredAt, &held.ExpiresAt, &remaining)
+		if err == pgx.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("acquire_lease: %w", err)
+		}
+		return nil, &LeaseHeldError{Lease: held, Remaining: time.Duration(remaining * float64(time.Second))}
+	}
+	return nil, fmt.Errorf("acquire_lease: lease on %s keeps changing hands, try again", path)
+}
+
+// ReleaseLease releases the agent's lease on path.
+func (q *Queries) ReleaseLease(ctx context.Context, agentID, path string) error {
+	tag, err := q.Pool.Exec(ctx,
+		`DELETE FROM file_leases WHERE path = $1 AND agent_id = $2`,
+		path, agentID,
+	)
+	if err != nil {
+		return fmt.Errorf("release_lease: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("you hold no lease on %s", path)
+	}
+	return nil
+}
+
+// ListLeases returns unexpired leases with an optional agent filter.
+func (q *Queries) ListLeases(ctx context.Context, agentID *string) ([]Lease, error) {
+	rows, err := q.Pool.Query(ctx,
+		`SELECT `+leaseColumns+`
+		 FROM file_leases
+		 WHERE expires_at > NOW()
+		   AND ($1::text IS NULL OR agent_id = $1)
+		 ORDER BY path`,
+		agentID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list_leases: %w", err)
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Lease, error) {
+		return scanLease(row)
+	})
+}
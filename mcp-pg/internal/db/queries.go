@@ -161,15 +161,16 @@ func (q *Queries) WriteContext(ctx context.Context, agentID, domain, key, value
 	return id, nil
 }
 
-// GetTasks returns tasks with optional status and assigned_to filters, plus edges.
-func (q *Queries) GetTasks(ctx context.Context, status, assignedTo *string) (*TasksResult, error) {
+// GetTasks returns tasks with optional status, assigned_to and parent_id filters, plus edges.
+func (q *Queries) GetTasks(ctx context.Context, status, assignedTo *string, parentID *int64) (*TasksResult, error) {
 	rows, err := q.Pool.Query(ctx,
 		`SELECT id, title, description, status, assigned_to, risk_level, output, parent_id
 		 FROM tasks
 		 WHERE ($1::text IS NULL OR status = $1)
 		   AND ($2::text IS NULL OR assigned_to = $2)
+		   AND ($3::bigint IS NULL OR parent_id = $3)
 		 ORDER BY id`,
-		status, assignedTo,
+		status, assignedTo, parentID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get_tasks: %w", err)
@@ -219,17 +220,19 @@ func (q *Queries) GetTasks(ctx context.Context, status, assignedTo *string) (*Ta
 }
 
 // ClaimTask attempts to claim an unassigned task. Returns task ID and title, or error if already claimed.
+// Epics, whose status follows their tasks, cannot be claimed.
 func (q *Queries) ClaimTask(ctx context.Context, agentID string, taskID int64) (*Task, error) {
 	var t Task
 	err := q.Pool.QueryRow(ctx,
 		`UPDATE tasks
 		 SET assigned_to = $1, status = 'in_progress', updated_at = NOW()
 		 WHERE id = $2 AND assigned_to IS NULL
+		   AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = tasks.id)
 		 RETURNING id, title`,
 		agentID, taskID,
 	).Scan(&t.ID, &t.Title)
 	if err == pgx.ErrNoRows {
-		return nil, fmt.Errorf("task %d is already claimed or does not exist", taskID)
+		return nil, fmt.Errorf("task %d is already claimed, is an epic or does not exist", taskID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("claim_task: %w", err)
@@ -11,6 +11,8 @@ func New(q *db.Queries) *server.MCPServer {
 		"mcp-pg",
 		"1.0.0",
 		server.WithToolCapabilities(true),
+		server.WithToolHandlerMiddleware(tools.LogCalls),
+		server.WithToolHandlerMiddleware(tools.TraceCalls(tools.TraceparentFromEnv())),
 	)
 
 	cfg := tools.NewConfig(q)
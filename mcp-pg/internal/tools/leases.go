@@ -0,0 +1,125 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/affanhamid/editor/mcp-pg/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultLeaseTTL = 10 * time.Minute
+	maxLeaseTTL     = time.Hour
+)
+
+func registerLeaseTools(s *server.MCPServer, cfg *Config) {
+	acquireLease := mcp.NewTool("acquire_lease",
+		mcp.WithDescription("Tell other agents you are editing a file. Fails, naming the holder, if another agent holds the file. Call again before the lease expires to extend it."),
+		mcp.WithString("path",
+			mcp.Description("File path relative to the repository root"),
+			mcp.Required(),
+		),
+		mcp.WithNumber("ttl_seconds",
+			mcp.Description("How long to hold the lease, at most 3600 seconds"),
+			mcp.DefaultNumber(defaultLeaseTTL.Seconds()),
+		),
+		mcp.WithString("reason",
+			mcp.Description("What you are changing in the file"),
+		),
+	)
+
+	releaseLease := mcp.NewTool("release_lease",
+		mcp.WithDescription("Release your lease on a file once you are done editing it. Leases are also released when your task finishes."),
+		mcp.WithString("path",
+			mcp.Description("File path relative to the repository root"),
+			mcp.Required(),
+		),
+	)
+
+	listLeases := mcp.NewTool("list_leases",
+		mcp.WithDescription("See which files other agents are editing right now."),
+		mcp.WithString("agent_id",
+			mcp.Description("Filter by agent ID"),
+		),
+	)
+
+	s.AddTool(acquireLease, makeAcquireLeaseHandler(cfg))
+	s.AddTool(releaseLease, makeReleaseLeaseHandler(cfg))
+	s.AddTool(listLeases, makeListLeasesHandler(cfg))
+}
+
+// leasePath normalises a repository-relative path, so that one file is
+// always leased under the same name.
+func leasePath(p string) (string, error) {
+	if p == "" {
+		return "", fmt.Errorf("path is required")
+	}
+	clean := path.Clean(strings.TrimPrefix(p, "./"))
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("path %q must be relative to the repository root", p)
+	}
+	return clean, nil
+}
+
+func makeAcquireLeaseHandler(cfg *Config) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		p, err := leasePath(request.GetString("path", ""))
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		ttl := time.Duration(request.GetFloat("ttl_seconds", defaultLeaseTTL.Seconds()) * float64(time.Second))
+		if ttl <= 0 {
+			return errorResult(fmt.Errorf("ttl_seconds must be positive")), nil
+		}
+		ttl = min(ttl, maxLeaseTTL)
+
+		var reason *string
+		if v := request.GetString("reason", ""); v != "" {
+			reason = &v
+		}
+
+		lease, err := cfg.Queries.AcquireLease(ctx, cfg.AgentID, p, ttl, reason)
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		return textResult(fmt.Sprintf("Leased %s until %s", lease.Path, lease.ExpiresAt.Format(time.RFC3339))), nil
+	}
+}
+
+func makeReleaseLeaseHandler(cfg *Config) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		p, err := leasePath(request.GetString("path", ""))
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		if err := cfg.Queries.ReleaseLease(ctx, cfg.AgentID, p); err != nil {
+			return errorResult(err), nil
+		}
+
+		return textResult(fmt.Sprintf("Released %s", p)), nil
+	}
+}
+
+func makeListLeasesHandler(cfg *Config) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var agentID *string
+		if v := request.GetString("agent_id", ""); v != "" {
+			agentID = &v
+		}
+
+		leases, err := cfg.Queries.ListLeases(ctx, agentID)
+		if err != nil {
+			return errorResult(err), nil
+		}
+
+		return textResult(db.ToJSON(leases)), nil
+	}
+}
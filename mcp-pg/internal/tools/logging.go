@@ -0,0 +1,50 @@
+package tools
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var logger = logging.For("tools")
+
+// LogCalls logs every tool call with its duration and outcome. Calls about a
+// task carry its task_id, so they line up with the orchestrator's log.
+func LogCalls(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+
+		attrs := []any{logging.Tool, request.Params.Name, "duration", time.Since(start)}
+		for _, arg := range []string{"task_id", "ref_task_id"} {
+			if id := request.GetFloat(arg, 0); id != 0 {
+				attrs = append(attrs, logging.TaskID, int64(id))
+				break
+			}
+		}
+		level := slog.LevelInfo
+		switch {
+		case err != nil:
+			level = slog.LevelError
+			attrs = append(attrs, "err", err)
+		case result != nil && result.IsError:
+			level = slog.LevelWarn
+			attrs = append(attrs, "err", resultText(result))
+		}
+		logger.Log(ctx, level, "tool call", attrs...)
+		return result, err
+	}
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	for _, c := range result.Content {
+		if tc, ok := c.(mcp.TextContent); ok {
+			return tc.Text
+		}
+	}
+	return ""
+}
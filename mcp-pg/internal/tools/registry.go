@@ -1,7 +1,6 @@
 package tools
 
 import (
-	"log"
 	"os"
 
 	"github.com/affanhamid/editor/mcp-pg/internal/db"
@@ -17,7 +16,8 @@ type Config struct {
 func NewConfig(q *db.Queries) *Config {
 	agentID := os.Getenv("ARCHITECT_AGENT_ID")
 	if agentID == "" {
-		log.Fatal("ARCHITECT_AGENT_ID environment variable is required")
+		logger.Error("ARCHITECT_AGENT_ID environment variable is required")
+		os.Exit(1)
 	}
 	branch := os.Getenv("ARCHITECT_BRANCH")
 	return &Config{
@@ -33,4 +33,5 @@ func RegisterAll(s *server.MCPServer, cfg *Config) {
 	registerTaskTools(s, cfg)
 	registerDecisionTools(s, cfg)
 	registerAgentTools(s, cfg)
+	registerLeaseTools(s, cfg)
 }
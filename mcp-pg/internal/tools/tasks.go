@@ -18,6 +18,9 @@ func registerTaskTools(s *server.MCPServer, cfg *Config) {
 		mcp.WithString("assigned_to",
 			mcp.Description("Filter by agent ID"),
 		),
+		mcp.WithNumber("parent_id",
+			mcp.Description("Filter by epic: only the tasks that belong to this task"),
+		),
 	)
 
 	claimTask := mcp.NewTool("claim_task",
@@ -58,8 +61,12 @@ func makeGetTasksHandler(cfg *Config) server.ToolHandlerFunc {
 		if v := request.GetString("assigned_to", ""); v != "" {
 			assignedTo = &v
 		}
+		var parentID *int64
+		if v := int64(request.GetFloat("parent_id", 0)); v != 0 {
+			parentID = &v
+		}
 
-		result, err := cfg.Queries.GetTasks(ctx, status, assignedTo)
+		result, err := cfg.Queries.GetTasks(ctx, status, assignedTo, parentID)
 		if err != nil {
 			return errorResult(err), nil
 		}
@@ -1,14 +1,21 @@
 package tools_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/mcp-pg/internal/db"
 	"github.com/affanhamid/editor/mcp-pg/internal/tools"
+	"github.com/affanhamid/editor/tracing"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
@@ -92,6 +99,14 @@ func setupTestDB(t *testing.T) (*db.Queries, func()) {
 			started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 			last_heartbeat TIMESTAMPTZ NOT NULL DEFAULT NOW()
 		)`,
+		`CREATE TABLE IF NOT EXISTS file_leases (
+			path VARCHAR(512) PRIMARY KEY,
+			agent_id VARCHAR(64) NOT NULL,
+			task_id BIGINT NULL REFERENCES tasks(id),
+			reason TEXT NULL,
+			acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
 	}
 
 	for _, s := range schema {
@@ -103,7 +118,7 @@ func setupTestDB(t *testing.T) (*db.Queries, func()) {
 	queries := &db.Queries{Pool: pool}
 
 	cleanup := func() {
-		tables := []string{"task_edges", "messages", "context", "tasks", "decisions", "agents"}
+		tables := []string{"file_leases", "task_edges", "messages", "context", "tasks", "decisions", "agents"}
 		for _, table := range tables {
 			pool.Exec(ctx, fmt.Sprintf("TRUNCATE %s CASCADE", table))
 		}
@@ -172,6 +187,7 @@ func TestAllToolsRegistered(t *testing.T) {
 		"get_tasks", "claim_task", "update_task",
 		"write_decision", "check_decisions",
 		"heartbeat", "get_agents",
+		"acquire_lease", "release_lease", "list_leases",
 	}
 
 	registered := s.ListTools()
@@ -329,6 +345,46 @@ func TestClaimTaskRaceCondition(t *testing.T) {
 	}
 }
 
+func TestGetTasksByParent(t *testing.T) {
+	s, queries, cleanup := setupServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	var epicID, childID int64
+	err := queries.Pool.QueryRow(ctx,
+		`INSERT INTO tasks (title, description) VALUES ('epic', 'desc') RETURNING id`,
+	).Scan(&epicID)
+	if err != nil {
+		t.Fatalf("failed to insert epic: %v", err)
+	}
+	err = queries.Pool.QueryRow(ctx,
+		`INSERT INTO tasks (title, description, parent_id) VALUES ('child', 'desc', $1) RETURNING id`, epicID,
+	).Scan(&childID)
+	if err != nil {
+		t.Fatalf("failed to insert child: %v", err)
+	}
+
+	result := callTool(t, s, "get_tasks", map[string]any{"parent_id": float64(epicID)})
+	if result.IsError {
+		t.Fatalf("get_tasks failed: %s", getTextContent(t, result))
+	}
+	var got db.TasksResult
+	if err := json.Unmarshal([]byte(getTextContent(t, result)), &got); err != nil {
+		t.Fatalf("failed to parse get_tasks result: %v", err)
+	}
+	if len(got.Tasks) != 1 || got.Tasks[0].ID != childID {
+		t.Errorf("expected only task %d, got %+v", childID, got.Tasks)
+	}
+
+	// Epics are never claimed; their status follows their tasks.
+	if _, err := queries.ClaimTask(ctx, "agent-1", epicID); err == nil {
+		t.Error("expected error when claiming an epic")
+	}
+	if _, err := queries.ClaimTask(ctx, "agent-1", childID); err != nil {
+		t.Errorf("claiming the epic's task failed: %v", err)
+	}
+}
+
 func TestUpdateTaskOwnership(t *testing.T) {
 	_, queries, cleanup := setupServer(t)
 	defer cleanup()
@@ -434,3 +490,165 @@ func TestGetAgents(t *testing.T) {
 		t.Errorf("expected 1 working agent, got %d", len(agents))
 	}
 }
+
+func TestFileLeases(t *testing.T) {
+	s, queries, cleanup := setupServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	var taskID int64
+	err := queries.Pool.QueryRow(ctx,
+		`INSERT INTO tasks (title, description, status, assigned_to) VALUES ('test', 'desc', 'in_progress', 'agent-1') RETURNING id`,
+	).Scan(&taskID)
+	if err != nil {
+		t.Fatalf("failed to insert task: %v", err)
+	}
+	_, err = queries.Pool.Exec(ctx,
+		`INSERT INTO agents (agent_id, pid, status, current_task_id) VALUES ('agent-1', 1111, 'working', $1)`, taskID,
+	)
+	if err != nil {
+		t.Fatalf("failed to insert agent: %v", err)
+	}
+
+	lease, err := queries.AcquireLease(ctx, "agent-1", "internal/db/queries.go", time.Minute, nil)
+	if err != nil {
+		t.Fatalf("agent-1 should get the lease: %v", err)
+	}
+	if lease.TaskID == nil || *lease.TaskID != taskID {
+		t.Errorf("expected the lease to belong to task %d, got %v", taskID, lease.TaskID)
+	}
+
+	// test-agent is refused and told who holds the file.
+	result := callTool(t, s, "acquire_lease", map[string]any{"path": "./internal/db/queries.go"})
+	if !result.IsError {
+		t.Fatal("expected acquire_lease to fail while agent-1 holds the file")
+	}
+	if text := getTextContent(t, result); !strings.Contains(text, "agent-1") || !strings.Contains(text, fmt.Sprintf("task %d", taskID)) {
+		t.Errorf("expected the holder in %q", text)
+	}
+
+	result = callTool(t, s, "release_lease", map[string]any{"path": "internal/db/queries.go"})
+	if !result.IsError {
+		t.Error("expected release_lease to fail for a lease held by another agent")
+	}
+
+	// An expired lease can be taken over.
+	if _, err := queries.Pool.Exec(ctx, `UPDATE file_leases SET expires_at = NOW() - INTERVAL '1 second'`); err != nil {
+		t.Fatal(err)
+	}
+	result = callTool(t, s, "acquire_lease", map[string]any{"path": "internal/db/queries.go", "reason": "add ListLeases"})
+	if result.IsError {
+		t.Fatalf("acquire_lease failed: %s", getTextContent(t, result))
+	}
+
+	result = callTool(t, s, "list_leases", map[string]any{})
+	var leases []db.Lease
+	if err := json.Unmarshal([]byte(getTextContent(t, result)), &leases); err != nil {
+		t.Fatalf("failed to parse leases: %v", err)
+	}
+	if len(leases) != 1 || leases[0].AgentID != "test-agent" {
+		t.Fatalf("expected one lease held by test-agent, got %+v", leases)
+	}
+
+	result = callTool(t, s, "release_lease", map[string]any{"path": "internal/db/queries.go"})
+	if result.IsError {
+		t.Fatalf("release_lease failed: %s", getTextContent(t, result))
+	}
+	leases, err = queries.ListLeases(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases) != 0 {
+		t.Errorf("expected no leases after release, got %+v", leases)
+	}
+}
+
+func TestLogCalls(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	if err := logging.Setup(&buf, logging.Options{Format: "json"}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := tools.LogCalls(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return &mcp.CallToolResult{
+			Content: []mcp.Content{mcp.TextContent{Type: "text", Text: "task 7 is not assigned to you"}},
+			IsError: true,
+		}, nil
+	})
+	var req mcp.CallToolRequest
+	req.Params.Name = "update_task"
+	req.Params.Arguments = map[string]any{"task_id": float64(7), "status": "completed"}
+	if _, err := handler(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "WARN" || entry[logging.Tool] != "update_task" || entry[logging.TaskID] != float64(7) {
+		t.Errorf("unexpected log entry %v", entry)
+	}
+	if entry["err"] != "task 7 is not assigned to you" {
+		t.Errorf("err = %v", entry["err"])
+	}
+}
+
+func TestTraceCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := tracing.Setup(tracing.Options{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	taskSpan := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	handler := tools.TraceCalls(func() string { return taskSpan })(func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultError("task 7 is not assigned to you"), nil
+	})
+	var req mcp.CallToolRequest
+	req.Params.Name = "update_task"
+	req.Params.Arguments = map[string]any{"task_id": float64(7)}
+	if _, err := handler(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"TraceID":"4bf92f3577b34da6a3ce929d0e0e4736"`,
+		`"SpanID":"00f067aa0ba902b7"`,
+		`"Name":"tool update_task"`,
+		`"Description":"task 7 is not assigned to you"`,
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("missing %s in %s", want, data)
+		}
+	}
+}
+
+// A reused agent keeps its mcp-pg, so the traceparent file is read again on
+// every call.
+func TestTraceparentFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traceparent")
+	t.Setenv(tracing.TraceparentEnv, "spawned")
+	t.Setenv(tracing.TraceparentFileEnv, path)
+	traceparent := tools.TraceparentFromEnv()
+
+	if got := traceparent(); got != "spawned" {
+		t.Errorf("without the file: %q, want TRACEPARENT", got)
+	}
+	for _, want := range []string{"first task", "second task"} {
+		if err := os.WriteFile(path, []byte(want), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if got := traceparent(); got != want {
+			t.Errorf("traceparent = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/tracing"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TraceCalls records a span for every tool call. traceparent returns the span
+// of the task the agent is working on, so the calls show up as children of
+// that task.
+func TraceCalls(traceparent func() string) server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			ctx = tracing.ContextWithTraceparent(ctx, traceparent())
+			ctx, span := tracing.Start(ctx, "tool "+request.Params.Name, slog.String(logging.Tool, request.Params.Name))
+			for _, arg := range []string{"task_id", "ref_task_id"} {
+				if id := request.GetFloat(arg, 0); id != 0 {
+					span.SetAttributes(slog.Int64(logging.TaskID, int64(id)))
+					break
+				}
+			}
+
+			result, err := next(ctx, request)
+			if err == nil && result != nil && result.IsError {
+				span.SetError(errors.New(resultText(result)))
+			}
+			span.EndWithError(err)
+			return result, err
+		}
+	}
+}
+
+// TraceparentFromEnv returns the span of the agent's current task as the
+// orchestrator passes it. A reused agent keeps its mcp-pg, so the
+// orchestrator rewrites the traceparent file for each new task and the file
+// is read on every call; TRACEPARENT, fixed at spawn, is the fallback.
+func TraceparentFromEnv() func() string {
+	path := os.Getenv(tracing.TraceparentFileEnv)
+	fallback := os.Getenv(tracing.TraceparentEnv)
+	return func() string {
+		if path == "" {
+			return fallback
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fallback
+		}
+		return string(data)
+	}
+}
@@ -2,19 +2,39 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/mcp-pg/internal/db"
 	mcpserver "github.com/affanhamid/editor/mcp-pg/internal/server"
+	"github.com/affanhamid/editor/tracing"
 	"github.com/mark3labs/mcp-go/server"
 )
 
 func main() {
 	ctx := context.Background()
 
+	if err := setupLogging(); err != nil {
+		fmt.Fprintf(os.Stderr, "mcp-pg: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Tool calls are traced as spans of the agent's task when the
+	// orchestrator traces its run.
+	shutdownTracing, err := tracing.Setup(tracing.OptionsFromEnv("architect-mcp-pg", os.Getenv(logging.RunIDEnv)))
+	if err != nil {
+		slog.Warn("tracing disabled", "err", err)
+		shutdownTracing = func(context.Context) error { return nil }
+	}
+	defer shutdownTracing(ctx)
+
 	pool, err := db.NewPool(ctx)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		slog.Error("failed to connect to database", "err", err)
+		os.Exit(1)
 	}
 	defer pool.Close()
 
@@ -22,6 +42,34 @@ func main() {
 	s := mcpserver.New(queries)
 
 	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("MCP server error: %v", err)
+		slog.Error("MCP server error", "err", err)
+		shutdownTracing(ctx)
+		os.Exit(1)
+	}
+}
+
+// setupLogging applies the logging settings the orchestrator passes in the
+// environment. The log goes to the agent's log file if one is given; stdout
+// carries the MCP protocol, so it is never used.
+func setupLogging() error {
+	var out io.Writer = os.Stderr
+	if path := os.Getenv(logging.FileEnv); path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open log file: %w", err)
+		}
+		out = f
+	}
+	err := logging.Setup(out, logging.Options{
+		Format: os.Getenv(logging.FormatEnv),
+		Level:  os.Getenv(logging.LevelEnv),
+		RunID:  os.Getenv(logging.RunIDEnv),
+	})
+	if err != nil {
+		return err
+	}
+	if agentID := os.Getenv("ARCHITECT_AGENT_ID"); agentID != "" {
+		slog.SetDefault(slog.Default().With(logging.AgentID, agentID))
 	}
+	return nil
 }
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/affanhamid/editor/pglisten"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/term"
 )
@@ -21,11 +23,13 @@ import (
 
 type Task struct {
 	ID                 int64
+	ParentID           *int64
 	Title              string
 	Status             string
 	AssignedTo         *string
 	RiskLevel          string
 	ConsultationStatus *string
+	FailureReason      *string
 }
 
 type TaskEdge struct {
@@ -43,6 +47,29 @@ type Agent struct {
 }
 
 
+type SandboxViolation struct {
+	AgentID   string
+	TaskID    *int64
+	Detail    string
+	CreatedAt time.Time
+}
+
+type FileLease struct {
+	Path      string
+	AgentID   string
+	TaskID    *int64
+	Reason    *string
+	ExpiresAt time.Time
+}
+
+type BranchConflict struct {
+	TaskA      int64
+	TaskB      int64
+	Kind       string
+	Files      []string
+	DetectedAt time.Time
+}
+
 type ContextEntry struct {
 	AgentID    string
 	Domain     string
@@ -58,6 +85,9 @@ type LogLine struct {
 	Subtype string          `json:"subtype,omitempty"`
 	Message json.RawMessage `json:"message,omitempty"`
 
+	// system sandbox_violation fields
+	Detail string `json:"detail,omitempty"`
+
 	// result fields
 	DurationMs   float64 `json:"duration_ms,omitempty"`
 	TotalCostUSD float64 `json:"total_cost_usd,omitempty"`
@@ -83,6 +113,9 @@ const (
 	viewAgent = 1
 )
 
+// maxRecentEvents is how many outbox events the events panel shows.
+const maxRecentEvents = 8
+
 // ── Status icons ────────────────────────────────────────────────────────────
 
 func statusIcon(s string) string {
@@ -95,6 +128,8 @@ func statusIcon(s string) string {
 		return "✗"
 	case "blocked":
 		return "⊘"
+	case "cancelled":
+		return "⊖"
 	default:
 		return "○"
 	}
@@ -113,31 +148,97 @@ func bprintln(buf *bytes.Buffer, s string) {
 
 // ── DAG rendering ───────────────────────────────────────────────────────────
 
-func renderDAG(buf *bytes.Buffer, tasks []Task, edges []TaskEdge) {
+// taskLabel is a task's title, with the reason if the orchestrator failed it.
+func taskLabel(t Task) string {
+	if t.FailureReason != nil {
+		return fmt.Sprintf("%s  (%s)", t.Title, *t.FailureReason)
+	}
+	return t.Title
+}
+
+// renderDAG draws the tasks as a tree along their edges. The tasks of an
+// epic are folded into it, and its edges drawn from the epic; with
+// expandEpics they are listed under it, with their order within the epic.
+func renderDAG(buf *bytes.Buffer, tasks []Task, edges []TaskEdge, expandEpics bool) {
 	bprintln(buf, "\n─── DAG ───────────────────────────────────────")
 
 	taskMap := make(map[int64]Task)
+	members := make(map[int64][]Task)
+	var top []Task
 	for _, t := range tasks {
 		taskMap[t.ID] = t
+		if t.ParentID != nil {
+			members[*t.ParentID] = append(members[*t.ParentID], t)
+		} else {
+			top = append(top, t)
+		}
+	}
+	node := func(id int64) int64 {
+		if t, ok := taskMap[id]; ok && t.ParentID != nil {
+			return *t.ParentID
+		}
+		return id
 	}
 
 	children := make(map[int64][]int64)
 	hasParent := make(map[int64]bool)
+	inEpic := make(map[int64][]int64) // blockers of a task within its epic
+	seen := make(map[TaskEdge]bool)
 	for _, e := range edges {
-		children[e.FromTask] = append(children[e.FromTask], e.ToTask)
-		hasParent[e.ToTask] = true
+		from, to := node(e.FromTask), node(e.ToTask)
+		if from == to {
+			inEpic[e.ToTask] = append(inEpic[e.ToTask], e.FromTask)
+			continue
+		}
+		if seen[TaskEdge{from, to}] {
+			continue
+		}
+		seen[TaskEdge{from, to}] = true
+		children[from] = append(children[from], to)
+		hasParent[to] = true
+	}
+
+	label := func(t Task) string {
+		ms := members[t.ID]
+		if len(ms) == 0 || expandEpics {
+			return taskLabel(t)
+		}
+		done := 0
+		for _, m := range ms {
+			if m.Status == "completed" {
+				done++
+			}
+		}
+		return fmt.Sprintf("%s  [+%d tasks, %d done]", taskLabel(t), len(ms), done)
+	}
+	printMembers := func(id int64, prefix string) {
+		if !expandEpics {
+			return
+		}
+		for _, m := range members[id] {
+			after := ""
+			if deps := inEpic[m.ID]; len(deps) > 0 {
+				ids := make([]string, len(deps))
+				for i, dep := range deps {
+					ids[i] = fmt.Sprintf("#%d", dep)
+				}
+				after = "  (after " + strings.Join(ids, ", ") + ")"
+			}
+			bprintf(buf, "  %s    · [%s] #%d %s%s\n", prefix, statusIcon(m.Status), m.ID, taskLabel(m), after)
+		}
 	}
 
 	var roots []int64
-	for _, t := range tasks {
+	for _, t := range top {
 		if !hasParent[t.ID] {
 			roots = append(roots, t.ID)
 		}
 	}
 
-	if len(edges) == 0 {
-		for _, t := range tasks {
-			bprintf(buf, "  [%s] #%d %s\n", statusIcon(t.Status), t.ID, t.Title)
+	if len(children) == 0 {
+		for _, t := range top {
+			bprintf(buf, "  [%s] #%d %s\n", statusIcon(t.Status), t.ID, label(t))
+			printMembers(t.ID, "")
 		}
 		if len(tasks) == 0 {
 			bprintln(buf, "  (no tasks)")
@@ -159,9 +260,9 @@ func renderDAG(buf *bytes.Buffer, tasks []Task, edges []TaskEdge) {
 			connector = "├──▶ "
 		}
 		if prefix == "" {
-			bprintf(buf, "  [%s] #%d %s\n", statusIcon(t.Status), t.ID, t.Title)
+			bprintf(buf, "  [%s] #%d %s\n", statusIcon(t.Status), t.ID, label(t))
 		} else {
-			bprintf(buf, "  %s%s[%s] #%d %s\n", prefix, connector, statusIcon(t.Status), t.ID, t.Title)
+			bprintf(buf, "  %s%s[%s] #%d %s\n", prefix, connector, statusIcon(t.Status), t.ID, label(t))
 		}
 
 		if visited[id] {
@@ -178,6 +279,7 @@ func renderDAG(buf *bytes.Buffer, tasks []Task, edges []TaskEdge) {
 				childPrefix += "│    "
 			}
 		}
+		printMembers(id, childPrefix)
 
 		for i, kid := range kids {
 			printTree(kid, childPrefix, i == len(kids)-1)
@@ -223,7 +325,7 @@ func renderAgents(buf *bytes.Buffer, agents []Agent, taskMap map[int64]Task) {
 		}
 
 		dur := "—"
-		if a.Status == "working" || a.Status == "starting" {
+		if a.Status == "working" || a.Status == "starting" || a.Status == "paused" {
 			elapsed := time.Since(a.StartedAt)
 			if elapsed < time.Minute {
 				dur = fmt.Sprintf("%.0fs", elapsed.Seconds())
@@ -265,6 +367,100 @@ func renderContext(buf *bytes.Buffer, entries []ContextEntry) {
 	}
 }
 
+// ── Lease rendering ─────────────────────────────────────────────────────────
+
+func renderLeases(buf *bytes.Buffer, leases []FileLease) {
+	if len(leases) == 0 {
+		return
+	}
+	bprintln(buf, "\n─── FILE LEASES ───────────────────────────────")
+
+	for _, l := range leases {
+		shortID := l.AgentID
+		if len(shortID) > 8 {
+			shortID = shortID[:8]
+		}
+		task := "—"
+		if l.TaskID != nil {
+			task = fmt.Sprintf("#%d", *l.TaskID)
+		}
+		reason := ""
+		if l.Reason != nil {
+			reason = *l.Reason
+			if len(reason) > 30 {
+				reason = reason[:27] + "..."
+			}
+		}
+		left := time.Until(l.ExpiresAt).Round(time.Second)
+		bprintf(buf, "  🔒 %-40s %s %-5s %6s left  %s\n", l.Path, shortID, task, left, reason)
+	}
+}
+
+// ── Conflict rendering ──────────────────────────────────────────────────────
+
+func renderConflicts(buf *bytes.Buffer, conflicts []BranchConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	bprintln(buf, "\n─── BRANCH CONFLICTS ──────────────────────────")
+
+	for _, c := range conflicts {
+		icon := "⚠"
+		if c.Kind == "merge" {
+			icon = "✗"
+		}
+		files := strings.Join(c.Files, ", ")
+		if len(files) > 50 {
+			files = files[:47] + "..."
+		}
+		bprintf(buf, "  %s #%d ↔ #%d  %-7s %s  (since %s)\n",
+			icon, c.TaskA, c.TaskB, c.Kind, files, c.DetectedAt.Format("15:04:05"))
+	}
+}
+
+// ── Sandbox rendering ───────────────────────────────────────────────────────
+
+func renderViolations(buf *bytes.Buffer, violations []SandboxViolation) {
+	if len(violations) == 0 {
+		return
+	}
+	bprintln(buf, "\n─── SANDBOX VIOLATIONS ────────────────────────")
+
+	for _, v := range violations {
+		shortID := v.AgentID
+		if len(shortID) > 8 {
+			shortID = shortID[:8]
+		}
+		task := "—"
+		if v.TaskID != nil {
+			task = fmt.Sprintf("#%d", *v.TaskID)
+		}
+		detail := v.Detail
+		if len(detail) > 70 {
+			detail = detail[:67] + "..."
+		}
+		bprintf(buf, "  ⛔ %s  %s %-5s %s\n", v.CreatedAt.Format("15:04:05"), shortID, task, detail)
+	}
+}
+
+func renderEvents(buf *bytes.Buffer, events []pglisten.Event) {
+	bprintln(buf, "\n─── EVENTS ────────────────────────────────────")
+
+	if len(events) == 0 {
+		bprintln(buf, "  (no events since dashboard start)")
+		return
+	}
+
+	for _, e := range events {
+		payload := string(e.Payload)
+		if len(payload) > 60 {
+			payload = payload[:57] + "..."
+		}
+		bprintf(buf, "  #%d  %s  %-16s %s  %s\n",
+			e.Seq, e.CreatedAt.Format("15:04:05"), e.EventType, e.EntityID, payload)
+	}
+}
+
 // ── Agent conversation rendering ────────────────────────────────────────────
 
 func renderConversation(buf *bytes.Buffer, agent Agent, taskMap map[int64]Task, logPath string) {
@@ -375,6 +571,11 @@ func renderConversation(buf *bytes.Buffer, agent Agent, taskMap map[int64]Task,
 				}
 			}
 
+		case "system":
+			if ll.Subtype == "sandbox_violation" {
+				bprintf(buf, "  ⛔ sandbox: %s\n", ll.Detail)
+			}
+
 		case "result":
 			dur := ll.DurationMs / 1000.0
 			bprintf(buf, "  ⏱  %.1fs | $%.2f | %d turns\n", dur, ll.TotalCostUSD, ll.NumTurns)
@@ -473,12 +674,29 @@ func main() {
 		}
 	}()
 
+	// Follow the events outbox: each event triggers a redraw and is listed
+	// in the events panel. Every dashboard has a position of its own, from
+	// the current end of the outbox since the screen is read from the
+	// tables. Logging would corrupt the raw-mode screen.
+	consumer := &pglisten.Consumer{
+		Name:       dashboardConsumer(),
+		Pool:       pool,
+		ConnString: *dbFlag,
+		StartAtEnd: true,
+		Logger:     slog.New(slog.DiscardHandler),
+	}
+	defer consumer.Remove(context.Background())
+	outbox := make(chan pglisten.Event, 64)
+	go consumer.Run(ctx, outbox)
+	var recent []pglisten.Event
+
 	currentView := viewMain
 	selectedAgent := 0
+	expandEpics := false
 	var agents []Agent // cache for agent selection
 
 	// Initial render
-	agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, agents)
+	agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
 
 	ticker := time.NewTicker(2 * time.Second)
 	defer ticker.Stop()
@@ -494,22 +712,50 @@ func main() {
 			case key == 'b' && currentView == viewAgent:
 				currentView = viewMain
 				selectedAgent = 0
-				agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, agents)
+				agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
+			case key == 'e' && currentView == viewMain:
+				expandEpics = !expandEpics
+				agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
+			case key == 'p' && currentView == viewMain:
+				toggleSwarmPause(ctx, pool)
+				agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
 			case key >= '1' && key <= '9' && currentView == viewMain:
 				idx := int(key - '1')
 				if idx < len(agents) {
 					selectedAgent = idx
 					currentView = viewAgent
-					agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, agents)
+					agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
 				}
 			}
+		case e := <-outbox:
+			// Take the whole burst before redrawing once.
+			batch := []pglisten.Event{e}
+			for len(outbox) > 0 {
+				batch = append(batch, <-outbox)
+			}
+			recent = append(recent, batch...)
+			if len(recent) > maxRecentEvents {
+				recent = recent[len(recent)-maxRecentEvents:]
+			}
+			consumer.Ack(ctx, batch[len(batch)-1].Seq)
+			agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
 		case <-ticker.C:
-			agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, agents)
+			agents = renderScreen(ctx, pool, *projectFlag, currentView, selectedAgent, expandEpics, agents, recent)
 		}
 	}
 }
 
-func renderScreen(ctx context.Context, pool *pgxpool.Pool, projectDir string, currentView int, selectedAgent int, prevAgents []Agent) []Agent {
+// dashboardConsumer names this dashboard's position in event_consumers.
+func dashboardConsumer() string {
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("dashboard-%d-%s", os.Getpid(), host)
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+func renderScreen(ctx context.Context, pool *pgxpool.Pool, projectDir string, currentView int, selectedAgent int, expandEpics bool, prevAgents []Agent, events []pglisten.Event) []Agent {
 	queryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
@@ -551,6 +797,30 @@ func renderScreen(ctx context.Context, pool *pgxpool.Pool, projectDir string, cu
 		return flush(prevAgents)
 	}
 
+	swarmPaused, err := querySwarmPaused(queryCtx, pool)
+	if err != nil {
+		bprintf(&buf, "error querying swarm state: %v\n", err)
+		return flush(prevAgents)
+	}
+
+	violations, err := queryViolations(queryCtx, pool)
+	if err != nil {
+		bprintf(&buf, "error querying sandbox violations: %v\n", err)
+		return flush(prevAgents)
+	}
+
+	leases, err := queryLeases(queryCtx, pool)
+	if err != nil {
+		bprintf(&buf, "error querying file leases: %v\n", err)
+		return flush(prevAgents)
+	}
+
+	conflicts, err := queryConflicts(queryCtx, pool)
+	if err != nil {
+		bprintf(&buf, "error querying branch conflicts: %v\n", err)
+		return flush(prevAgents)
+	}
+
 	worktreeBase := filepath.Join(projectDir, ".worktrees")
 
 	switch currentView {
@@ -558,12 +828,19 @@ func renderScreen(ctx context.Context, pool *pgxpool.Pool, projectDir string, cu
 		bprintln(&buf, "╔══════════════════════════════════════════╗")
 		bprintln(&buf, "║          ARCHITECT DASHBOARD             ║")
 		bprintln(&buf, "╚══════════════════════════════════════════╝")
+		if swarmPaused {
+			bprintln(&buf, "\n  ⏸  SWARM PAUSED — no new agents will be spawned")
+		}
 
-		renderDAG(&buf, tasks, edges)
+		renderDAG(&buf, tasks, edges, expandEpics)
 		renderAgents(&buf, agents, taskMap)
 		renderContext(&buf, ctxEntries)
+		renderLeases(&buf, leases)
+		renderConflicts(&buf, conflicts)
+		renderViolations(&buf, violations)
+		renderEvents(&buf, events)
 
-		bprintln(&buf, "\nPress [1-9] to view agent, [q] to quit")
+		bprintln(&buf, "\nPress [1-9] to view agent, [e] expand/collapse epics, [p] pause/resume swarm, [q] to quit")
 
 	case viewAgent:
 		if selectedAgent < len(agents) {
@@ -583,7 +860,7 @@ func renderScreen(ctx context.Context, pool *pgxpool.Pool, projectDir string, cu
 
 func queryTasks(ctx context.Context, pool *pgxpool.Pool) ([]Task, error) {
 	rows, err := pool.Query(ctx,
-		`SELECT id, title, status, assigned_to, risk_level, consultation_status
+		`SELECT id, parent_id, title, status, assigned_to, risk_level, consultation_status, failure_reason
 		 FROM tasks ORDER BY id`)
 	if err != nil {
 		return nil, err
@@ -593,7 +870,7 @@ func queryTasks(ctx context.Context, pool *pgxpool.Pool) ([]Task, error) {
 	var tasks []Task
 	for rows.Next() {
 		var t Task
-		if err := rows.Scan(&t.ID, &t.Title, &t.Status, &t.AssignedTo, &t.RiskLevel, &t.ConsultationStatus); err != nil {
+		if err := rows.Scan(&t.ID, &t.ParentID, &t.Title, &t.Status, &t.AssignedTo, &t.RiskLevel, &t.ConsultationStatus, &t.FailureReason); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, t)
@@ -660,6 +937,81 @@ func queryContext(ctx context.Context, pool *pgxpool.Pool) ([]ContextEntry, erro
 	return entries, rows.Err()
 }
 
+func queryLeases(ctx context.Context, pool *pgxpool.Pool) ([]FileLease, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT path, agent_id, task_id, reason, expires_at
+		 FROM file_leases WHERE expires_at > NOW() ORDER BY path`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var leases []FileLease
+	for rows.Next() {
+		var l FileLease
+		if err := rows.Scan(&l.Path, &l.AgentID, &l.TaskID, &l.Reason, &l.ExpiresAt); err != nil {
+			return nil, err
+		}
+		leases = append(leases, l)
+	}
+	return leases, rows.Err()
+}
+
+func queryConflicts(ctx context.Context, pool *pgxpool.Pool) ([]BranchConflict, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT task_a, task_b, kind, files, detected_at
+		 FROM branch_conflicts WHERE resolved_at IS NULL ORDER BY task_a, task_b`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conflicts []BranchConflict
+	for rows.Next() {
+		var c BranchConflict
+		if err := rows.Scan(&c.TaskA, &c.TaskB, &c.Kind, &c.Files, &c.DetectedAt); err != nil {
+			return nil, err
+		}
+		conflicts = append(conflicts, c)
+	}
+	return conflicts, rows.Err()
+}
+
+// maxViolations is how many recent sandbox violations the main view shows.
+const maxViolations = 5
+
+func queryViolations(ctx context.Context, pool *pgxpool.Pool) ([]SandboxViolation, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT agent_id, task_id, detail, created_at
+		 FROM sandbox_violations ORDER BY id DESC LIMIT $1`, maxViolations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var violations []SandboxViolation
+	for rows.Next() {
+		var v SandboxViolation
+		if err := rows.Scan(&v.AgentID, &v.TaskID, &v.Detail, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		violations = append(violations, v)
+	}
+	return violations, rows.Err()
+}
+
+func querySwarmPaused(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var paused bool
+	err := pool.QueryRow(ctx, `SELECT paused FROM swarm_state`).Scan(&paused)
+	return paused, err
+}
+
+// toggleSwarmPause flips the swarm's paused flag; the orchestrator reacts to
+// the change by pausing or resuming its agents.
+func toggleSwarmPause(ctx context.Context, pool *pgxpool.Pool) {
+	_, _ = pool.Exec(ctx, `UPDATE swarm_state SET paused = NOT paused, updated_at = NOW()`)
+}
+
 // ── Log file helpers ────────────────────────────────────────────────────────
 
 func findAgentLog(worktreeBase string, agentID string) string {
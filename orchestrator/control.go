@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// runTaskCommand implements `architect retry <task>` and `architect cancel <task>`.
+// The command is queued in orchestrator_commands; if an orchestrator is
+// running its result is printed, otherwise it is applied at the next start.
+func runTaskCommand(args []string, command string) {
+	name := map[string]string{"retry_task": "retry", "cancel_task": "cancel"}[command]
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dbURL := fs.String("db", defaultDBURL, "PostgreSQL connection string")
+	wait := fs.Duration("wait", 10*time.Second, "How long to wait for the orchestrator to apply the command")
+	asJSON := fs.Bool("json", false, "Print the command result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: architect %s [flags] <task-id>\n\n", name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	taskID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		log.Fatalf("invalid task ID %q", fs.Arg(0))
+	}
+
+	ctx := context.Background()
+	pool := connect(ctx, *dbURL)
+	defer pool.Close()
+
+	id, err := db.IssueCommand(ctx, pool, command, map[string]int64{"task_id": taskID}, "cli")
+	if err != nil {
+		log.Fatalf("failed to issue %s: %v", name, err)
+	}
+	result, err := db.WaitCommandResult(ctx, pool, id, *wait)
+	if errors.Is(err, pgx.ErrNoRows) {
+		if *asJSON {
+			printJSON(map[string]any{"command_id": id, "queued": true})
+			return
+		}
+		fmt.Printf("%s of task %d queued as command %d (no orchestrator answered within %s)\n", name, taskID, id, *wait)
+		return
+	}
+	if err != nil {
+		log.Fatalf("failed to read result of command %d: %v", id, err)
+	}
+
+	if *asJSON {
+		printJSON(map[string]any{"command_id": id, "applied": result.Applied, "reason": result.Reason})
+	} else if result.Applied {
+		fmt.Printf("task %d: %s applied\n", taskID, name)
+	} else {
+		fmt.Printf("task %d: %s not applied: %s\n", taskID, name, result.Reason)
+	}
+	if !result.Applied {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/gc"
+)
+
+// runGC implements `architect gc`: remove worktrees and branches of finished agents.
+func runGC(args []string) {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	projectDir := fs.String("project", ".", "Path to the git repository")
+	dbURL := fs.String("db", defaultDBURL, "PostgreSQL connection string")
+	dryRun := fs.Bool("dry-run", false, "Show what would be removed without removing anything")
+	keepFailedDays := fs.Int("keep-failed-days", 7, "Days to keep worktrees of failed tasks and dead agents")
+	keepUnmerged := fs.Bool("keep-unmerged", true, "Keep worktrees whose branch has commits not on the base branch")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	pool, err := db.NewPool(ctx, *dbURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	opts := gc.Options{
+		DryRun:       *dryRun,
+		KeepFailed:   time.Duration(*keepFailedDays) * 24 * time.Hour,
+		KeepUnmerged: *keepUnmerged,
+	}
+	results, err := gc.Run(ctx, pool, *projectDir, opts)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tACTION\tBRANCH\tREASON")
+	for _, r := range results {
+		action := "keep"
+		if r.Removed && *dryRun {
+			action = "would remove"
+		} else if r.Removed {
+			action = "removed"
+		}
+		branch := strings.Join(r.Branches, ",")
+		if branch == "" {
+			branch = "—"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.AgentID[:8], action, branch, r.Reason)
+	}
+	w.Flush()
+
+	if err != nil {
+		log.Fatalf("gc failed: %v", err)
+	}
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/gc"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// inspectFlags are the flags shared by the read-only subcommands.
+type inspectFlags struct {
+	fs     *flag.FlagSet
+	dbURL  *string
+	asJSON *bool
+}
+
+func newInspectFlags(name, usage string) inspectFlags {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	f := inspectFlags{
+		fs:     fs,
+		dbURL:  fs.String("db", defaultDBURL, "PostgreSQL connection string"),
+		asJSON: fs.Bool("json", false, "Print JSON instead of a table"),
+	}
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: architect %s\n\n", usage)
+		fs.PrintDefaults()
+	}
+	return f
+}
+
+// connect opens a pool or exits.
+func connect(ctx context.Context, dbURL string) *pgxpool.Pool {
+	pool, err := db.NewPool(ctx, dbURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	return pool
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Fatalf("failed to encode JSON: %v", err)
+	}
+}
+
+func newTable() *tabwriter.Writer {
+	return tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+}
+
+// shortID abbreviates an agent ID the way the orchestrator logs do.
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+// oneLine flattens and truncates text for a table cell.
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+func ago(t time.Time) string {
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// runStatus implements `architect status`: a summary of tasks and agents.
+func runStatus(args []string) {
+	f := newInspectFlags("status", "status [flags]")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	tasks, err := db.ListTasks(ctx, pool, "")
+	if err != nil {
+		log.Fatalf("failed to list tasks: %v", err)
+	}
+	agents, err := db.ListAgents(ctx, pool)
+	if err != nil {
+		log.Fatalf("failed to list agents: %v", err)
+	}
+	paused, err := db.SwarmPaused(ctx, pool)
+	if err != nil {
+		log.Fatalf("failed to read swarm state: %v", err)
+	}
+
+	taskCounts := map[string]int{}
+	for _, t := range tasks {
+		taskCounts[t.Status]++
+	}
+	agentCounts := map[string]int{}
+	for _, a := range agents {
+		agentCounts[a.Status]++
+	}
+
+	if *f.asJSON {
+		printJSON(map[string]any{
+			"swarm_paused": paused,
+			"tasks":        taskCounts,
+			"agents":       agentCounts,
+		})
+		return
+	}
+
+	if paused {
+		fmt.Println("swarm is PAUSED")
+	}
+	w := newTable()
+	fmt.Fprintf(w, "TASKS\t%d\n", len(tasks))
+	for _, s := range []string{"pending", "in_progress", "blocked", "completed", "failed", "cancelled"} {
+		if taskCounts[s] > 0 {
+			fmt.Fprintf(w, "  %s\t%d\n", s, taskCounts[s])
+		}
+	}
+	fmt.Fprintf(w, "AGENTS\t%d\n", len(agents))
+	for _, s := range []string{"starting", "working", "blocked", "paused", "idle", "stopped", "dead"} {
+		if agentCounts[s] > 0 {
+			fmt.Fprintf(w, "  %s\t%d\n", s, agentCounts[s])
+		}
+	}
+	w.Flush()
+}
+
+// runTasks implements `architect tasks [--status s]`.
+func runTasks(args []string) {
+	f := newInspectFlags("tasks", "tasks [flags]")
+	status := f.fs.String("status", "", "Only show tasks with this status")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	tasks, err := db.ListTasks(ctx, pool, *status)
+	if err != nil {
+		log.Fatalf("failed to list tasks: %v", err)
+	}
+	if *f.asJSON {
+		printJSON(tasks)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tSTATUS\tRISK\tAGENT\tEPIC\tUPDATED\tTITLE")
+	for _, t := range tasks {
+		agent := ""
+		if t.AssignedTo != nil {
+			agent = shortID(*t.AssignedTo)
+		}
+		epic := ""
+		switch {
+		case t.Epic:
+			epic = "epic"
+		case t.ParentID != nil:
+			epic = fmt.Sprintf("#%d", *t.ParentID)
+		}
+		status := t.Status
+		if t.FailureReason != "" {
+			status += " (" + t.FailureReason + ")"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			t.ID, status, t.RiskLevel, orDash(agent), orDash(epic), ago(t.UpdatedAt), oneLine(t.Title, 60))
+	}
+	w.Flush()
+}
+
+// runAgents implements `architect agents`.
+func runAgents(args []string) {
+	f := newInspectFlags("agents", "agents [flags]")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	agents, err := db.ListAgents(ctx, pool)
+	if err != nil {
+		log.Fatalf("failed to list agents: %v", err)
+	}
+	if *f.asJSON {
+		printJSON(agents)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "AGENT\tSTATUS\tTASK\tPID\tSTARTED\tHEARTBEAT\tWORKTREE")
+	for _, a := range agents {
+		task := ""
+		if a.CurrentTaskID != nil {
+			task = fmt.Sprint(*a.CurrentTaskID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			shortID(a.AgentID), a.Status, orDash(task), a.PID,
+			a.StartedAt.Format("15:04:05"), ago(a.LastHeartbeat), orDash(a.WorktreePath))
+	}
+	w.Flush()
+}
+
+// runMessages implements `architect messages [--channel c]`.
+func runMessages(args []string) {
+	f := newInspectFlags("messages", "messages [flags]")
+	channel := f.fs.String("channel", "", "Only show messages on this channel")
+	limit := f.fs.Int("n", 50, "Number of messages to show")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	msgs, err := db.RecentMessages(ctx, pool, *channel, *limit)
+	if err != nil {
+		log.Fatalf("failed to list messages: %v", err)
+	}
+	// Oldest first reads naturally, like a chat log.
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	if *f.asJSON {
+		printJSON(msgs)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tTIME\tCHANNEL\tFROM\tTYPE\tCONTENT")
+	for _, m := range msgs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			m.ID, m.CreatedAt.Format("15:04:05"), m.Channel, shortID(m.AgentID), m.MsgType, oneLine(m.Content, 80))
+	}
+	w.Flush()
+}
+
+// runDecisions implements `architect decisions [--domain d]`.
+func runDecisions(args []string) {
+	f := newInspectFlags("decisions", "decisions [flags]")
+	domain := f.fs.String("domain", "", "Only show decisions in this domain")
+	limit := f.fs.Int("n", 50, "Number of decisions to show")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	decisions, err := db.RecentDecisions(ctx, pool, *domain, *limit)
+	if err != nil {
+		log.Fatalf("failed to list decisions: %v", err)
+	}
+	if *f.asJSON {
+		printJSON(decisions)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tTIME\tDOMAIN\tAGENT\tRISK\tDECISION")
+	for _, d := range decisions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+			d.ID, d.CreatedAt.Format("2006-01-02 15:04"), d.Domain, shortID(d.AgentID), d.RiskLevel, oneLine(d.Decision, 80))
+	}
+	w.Flush()
+}
+
+// runLogs implements `architect logs <agent> [-f]`: print an agent's
+// agent.log, from its worktree or from the gc archive.
+func runLogs(args []string) {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	dbURL := fs.String("db", defaultDBURL, "PostgreSQL connection string")
+	projectDir := fs.String("project", ".", "Path to the git repository (to find archived logs)")
+	follow := fs.Bool("f", false, "Keep printing new output as the agent writes it")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: architect logs [flags] <agent-id>\n\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	pool := connect(ctx, *dbURL)
+	defer pool.Close()
+
+	agentID, err := db.ResolveAgentID(ctx, pool, fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	worktreePath, err := db.AgentWorktreePath(ctx, pool, agentID)
+	if err != nil {
+		log.Fatalf("failed to look up agent %s: %v", shortID(agentID), err)
+	}
+
+	path := filepath.Join(worktreePath, "agent.log")
+	if _, err := os.Stat(path); worktreePath == "" || err != nil {
+		path = gc.ArchivePath(*projectDir, agentID)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("no log for agent %s: %v", shortID(agentID), err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(os.Stdout, file); err != nil {
+		log.Fatalf("failed to read %s: %v", path, err)
+	}
+	if !*follow {
+		return
+	}
+	for {
+		time.Sleep(500 * time.Millisecond)
+		if _, err := io.Copy(os.Stdout, file); err != nil {
+			log.Fatalf("failed to read %s: %v", path, err)
+		}
+	}
+}
+
+// runEvents implements `architect events [--entity e] [--id id]`: the audit
+// trail from the events outbox.
+func runEvents(args []string) {
+	f := newInspectFlags("events", "events [flags]")
+	entity := f.fs.String("entity", "", "Only show events for this entity type (task, agent, message, ...)")
+	entityID := f.fs.String("id", "", "Only show events for this entity ID")
+	limit := f.fs.Int("n", 50, "Number of events to show")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	events, err := db.ListEvents(ctx, pool, *entity, *entityID, *limit)
+	if err != nil {
+		log.Fatalf("failed to list events: %v", err)
+	}
+	if *f.asJSON {
+		printJSON(events)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "SEQ\tTIME\tTYPE\tENTITY\tPAYLOAD")
+	for _, e := range events {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			e.Seq, e.CreatedAt.Format("15:04:05"), e.EventType, e.EntityID, oneLine(string(e.Payload), 80))
+	}
+	w.Flush()
+}
+
+// runReplans implements `architect replans`: how the planner revised the
+// remaining plan after failures.
+func runReplans(args []string) {
+	f := newInspectFlags("replans", "replans [flags]")
+	limit := f.fs.Int("n", 20, "Number of revisions to show")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	replans, err := db.RecentReplans(ctx, pool, *limit)
+	if err != nil {
+		log.Fatalf("failed to list replans: %v", err)
+	}
+	if *f.asJSON {
+		printJSON(replans)
+		return
+	}
+
+	w := newTable()
+	fmt.Fprintln(w, "ID\tTIME\tTRIGGER\tTASK\tCHANGES")
+	for _, r := range replans {
+		task := ""
+		if r.TaskID != nil {
+			task = fmt.Sprint(*r.TaskID)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			r.ID, r.CreatedAt.Format("15:04:05"), r.Trigger, orDash(task), oneLine(replanSummary(r), 80))
+	}
+	w.Flush()
+}
+
+// replanSummary counts the changes of a revision, or says why there were none.
+func replanSummary(r db.Replan) string {
+	var diff dag.Diff
+	if len(r.Diff) > 0 {
+		if err := json.Unmarshal(r.Diff, &diff); err != nil {
+			return string(r.Diff)
+		}
+	}
+	summary := fmt.Sprintf("+%d tasks, -%d tasks, ~%d tasks, +%d/-%d edges",
+		len(diff.Added), len(diff.Cancelled), len(diff.Updated), len(diff.AddedEdges), len(diff.RemovedEdges))
+	if len(r.Diff) == 0 {
+		summary = "not applied"
+	}
+	if r.Error != "" {
+		summary += ": " + r.Error
+	}
+	return summary
+}
@@ -1,5 +1,7 @@
 package dag
 
+import "encoding/json"
+
 // Task represents a single unit of work in the DAG.
 type Task struct {
 	ID          int64   `json:"id"`
@@ -7,14 +9,39 @@ type Task struct {
 	Description string  `json:"description"`
 	RiskLevel   string  `json:"risk_level"`
 	BlockedBy   []int64 `json:"blocked_by"`
-	AssignedTo  string  `json:"-"`
-	Status      string  `json:"-"`
+	// ParentID is the epic the task belongs to, zero for top-level tasks.
+	// An epic is a task others name as their parent: no agent works on it,
+	// its status is rolled up from its children, and what blocks it blocks
+	// each of them.
+	ParentID int64 `json:"parent_id,omitempty"`
+	// Domains are the context/decision domains the task touches.
+	Domains            []string `json:"domains,omitempty"`
+	AcceptanceCriteria []string `json:"acceptance_criteria,omitempty"`
+	// PermissionProfile names the tool permissions the agent runs with.
+	PermissionProfile string `json:"permission_profile,omitempty"`
+	// MCPServers are extra MCP servers for this task's agent, in .mcp.json
+	// "mcpServers" form, merged over the project's own.
+	MCPServers map[string]json.RawMessage `json:"mcp_servers,omitempty"`
+	// FileScope lists the paths or globs the task expects to change (see
+	// ScopesOverlap). Tasks with overlapping scopes do not run at the same
+	// time unless one of them sets AllowOverlap.
+	FileScope    []string `json:"file_scope,omitempty"`
+	AllowOverlap bool     `json:"allow_overlap,omitempty"`
+	AssignedTo   string   `json:"-"`
+	Status       string   `json:"-"`
+	// Branch is set when an earlier agent left work-in-progress for this task.
+	Branch     string `json:"-"`
+	ResumeNote string `json:"-"`
+	// Output and FailureReason are what a finished task left behind; the
+	// planner sees them when it revises the plan.
+	Output        string `json:"-"`
+	FailureReason string `json:"-"`
 }
 
 // Edge represents a dependency between two tasks.
 type Edge struct {
-	From int64
-	To   int64
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
 }
 
 // DAG holds the full task graph.
@@ -23,7 +50,9 @@ type DAG struct {
 	Edges []Edge
 }
 
-// ReadyTasks returns tasks that have no unfinished blockers and are unassigned.
+// ReadyTasks returns tasks that have no unfinished blockers and are
+// unassigned. Epics are never ready; their children are, once neither they
+// nor their epic wait on anything.
 func (d *DAG) ReadyTasks() []Task {
 	completed := make(map[int64]bool)
 	for _, t := range d.Tasks {
@@ -31,14 +60,19 @@ func (d *DAG) ReadyTasks() []Task {
 			completed[t.ID] = true
 		}
 	}
+	epics := Epics(d.Tasks)
+	byID := make(map[int64]Task, len(d.Tasks))
+	for _, t := range d.Tasks {
+		byID[t.ID] = t
+	}
 
 	var ready []Task
 	for _, t := range d.Tasks {
-		if t.Status != "pending" || t.AssignedTo != "" {
+		if t.Status != "pending" || t.AssignedTo != "" || epics[t.ID] {
 			continue
 		}
 		blocked := false
-		for _, dep := range t.BlockedBy {
+		for _, dep := range blockers(t, byID) {
 			if !completed[dep] {
 				blocked = true
 				break
@@ -1,6 +1,8 @@
 package dag
 
 import (
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -72,6 +74,44 @@ func TestReadyTasks_SkipsAssigned(t *testing.T) {
 	}
 }
 
+func TestReadyTasks_Epics(t *testing.T) {
+	d := &DAG{
+		Tasks: []Task{
+			{ID: 1, Title: "schema", Status: "pending"},
+			{ID: 2, Title: "api", Status: "pending", BlockedBy: []int64{1}},
+			{ID: 3, Title: "handlers", Status: "pending", ParentID: 2},
+			{ID: 4, Title: "routes", Status: "pending", ParentID: 2, BlockedBy: []int64{3}},
+		},
+	}
+	ready := d.ReadyTasks()
+	if len(ready) != 1 || ready[0].ID != 1 {
+		t.Fatalf("expected only task 1 to be ready, got %+v", ready)
+	}
+
+	// The epic's blocker holds back its tasks; the epic itself never runs.
+	d.Tasks[0].Status = "completed"
+	ready = d.ReadyTasks()
+	if len(ready) != 1 || ready[0].ID != 3 {
+		t.Fatalf("expected only task 3 to be ready, got %+v", ready)
+	}
+}
+
+func TestParentsFirst(t *testing.T) {
+	tasks := []Task{
+		{ID: 3, ParentID: 1},
+		{ID: 1},
+		{ID: 4, ParentID: 2},
+		{ID: 2},
+	}
+	var got []int64
+	for _, t := range ParentsFirst(tasks) {
+		got = append(got, t.ID)
+	}
+	if want := []int64{1, 2, 3, 4}; !slices.Equal(got, want) {
+		t.Errorf("ParentsFirst = %v, want %v", got, want)
+	}
+}
+
 func TestBuildDAG(t *testing.T) {
 	tasks := []Task{
 		{ID: 1, Title: "a", BlockedBy: nil},
@@ -92,3 +132,297 @@ func TestBuildDAG(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePlan(t *testing.T) {
+	d, err := ParsePlan([]byte(`{"tasks": [
+		{"id": 1, "title": "schema", "description": "add table", "risk_level": "low"},
+		{"id": 3, "title": "api", "description": "use table", "risk_level": "high", "blocked_by": [1]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Tasks) != 2 || len(d.Edges) != 1 || d.Edges[0] != (Edge{From: 1, To: 3}) {
+		t.Fatalf("unexpected DAG %+v", d)
+	}
+	if d.Tasks[0].Status != "pending" {
+		t.Errorf("status = %q, want pending", d.Tasks[0].Status)
+	}
+}
+
+func TestValidateTasks(t *testing.T) {
+	tests := []struct {
+		name  string
+		tasks []Task
+	}{
+		{"empty", nil},
+		{"duplicate id", []Task{{ID: 1, Title: "a", RiskLevel: "low"}, {ID: 1, Title: "b", RiskLevel: "low"}}},
+		{"no title", []Task{{ID: 1, RiskLevel: "low"}}},
+		{"bad risk", []Task{{ID: 1, Title: "a", RiskLevel: "extreme"}}},
+		{"unknown blocker", []Task{{ID: 1, Title: "a", RiskLevel: "low", BlockedBy: []int64{2}}}},
+		{"self blocker", []Task{{ID: 1, Title: "a", RiskLevel: "low", BlockedBy: []int64{1}}}},
+		{"cycle", []Task{
+			{ID: 1, Title: "a", RiskLevel: "low", BlockedBy: []int64{3}},
+			{ID: 2, Title: "b", RiskLevel: "low", BlockedBy: []int64{1}},
+			{ID: 3, Title: "c", RiskLevel: "low", BlockedBy: []int64{2}},
+		}},
+		{"own epic", []Task{{ID: 1, Title: "a", RiskLevel: "low", ParentID: 1}}},
+		{"unknown epic", []Task{{ID: 1, Title: "a", RiskLevel: "low", ParentID: 2}}},
+		{"nested epic", []Task{
+			{ID: 1, Title: "a", RiskLevel: "low"},
+			{ID: 2, Title: "b", RiskLevel: "low", ParentID: 1},
+			{ID: 3, Title: "c", RiskLevel: "low", ParentID: 2},
+		}},
+		{"epic blocked by its task", []Task{
+			{ID: 1, Title: "a", RiskLevel: "low", BlockedBy: []int64{2}},
+			{ID: 2, Title: "b", RiskLevel: "low", ParentID: 1},
+		}},
+		{"cycle through epic", []Task{
+			{ID: 1, Title: "a", RiskLevel: "low", BlockedBy: []int64{3}},
+			{ID: 2, Title: "b", RiskLevel: "low", ParentID: 1},
+			{ID: 3, Title: "c", RiskLevel: "low", BlockedBy: []int64{2}},
+		}},
+	}
+	for _, tt := range tests {
+		if err := ValidateTasks(tt.tasks); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestDiffPlan(t *testing.T) {
+	current := []Task{
+		{ID: 1, Title: "schema", RiskLevel: "low", Status: "completed"},
+		{ID: 2, Title: "api", RiskLevel: "medium", Status: "failed", BlockedBy: []int64{1}},
+		{ID: 3, Title: "client", RiskLevel: "low", Status: "pending", BlockedBy: []int64{2}},
+		{ID: 4, Title: "docs", RiskLevel: "low", Status: "pending", BlockedBy: []int64{3}},
+		{ID: 5, Title: "ui", RiskLevel: "low", Status: "in_progress", BlockedBy: []int64{1}},
+	}
+	// Redo the api as a new task, rewire the client to it and drop the docs.
+	diff, err := DiffPlan(current, []Task{
+		{ID: -1, Title: "api, smaller", RiskLevel: "medium", BlockedBy: []int64{1}},
+		{ID: 3, Title: "client", RiskLevel: "high", BlockedBy: []int64{-1, -1}},
+		{ID: 5, Title: "ignored", BlockedBy: []int64{2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Added) != 1 || diff.Added[0].ID != -1 {
+		t.Errorf("added = %+v", diff.Added)
+	}
+	if len(diff.Cancelled) != 1 || diff.Cancelled[0] != 4 {
+		t.Errorf("cancelled = %v, want [4]", diff.Cancelled)
+	}
+	if u := diff.Updated; len(u) != 1 || u[0].ID != 3 || u[0].RiskLevel != "high" || u[0].Title != "" {
+		t.Errorf("updated = %+v", diff.Updated)
+	}
+	wantAdded := []Edge{{From: 1, To: -1}, {From: -1, To: 3}}
+	if len(diff.AddedEdges) != 2 || diff.AddedEdges[0] != wantAdded[0] || diff.AddedEdges[1] != wantAdded[1] {
+		t.Errorf("added edges = %v, want %v", diff.AddedEdges, wantAdded)
+	}
+	if len(diff.RemovedEdges) != 1 || diff.RemovedEdges[0] != (Edge{From: 2, To: 3}) {
+		t.Errorf("removed edges = %v, want [{2 3}]", diff.RemovedEdges)
+	}
+
+	diff.Renumber(map[int64]int64{-1: 6})
+	if diff.Added[0].ID != 6 || diff.AddedEdges[0] != (Edge{From: 1, To: 6}) || diff.AddedEdges[1] != (Edge{From: 6, To: 3}) {
+		t.Errorf("renumbered diff = %+v", diff)
+	}
+
+	for name, revised := range map[string][]Task{
+		"blocked by failed":    {{ID: 3, BlockedBy: []int64{2}}},
+		"blocked by cancelled": {{ID: 3, BlockedBy: []int64{1}}, {ID: -1, Title: "x", RiskLevel: "low", BlockedBy: []int64{4}}},
+		"unknown task":         {{ID: 9}},
+		"unknown new blocker":  {{ID: 3, BlockedBy: []int64{-2}}},
+		"new without risk":     {{ID: -1, Title: "x"}},
+		"cycle":                {{ID: 3, BlockedBy: []int64{4}}, {ID: 4, BlockedBy: []int64{3}}},
+	} {
+		if _, err := DiffPlan(current, revised); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDiffPlan_Epics(t *testing.T) {
+	current := []Task{
+		{ID: 1, Title: "api", RiskLevel: "low", Status: "in_progress"},
+		{ID: 2, Title: "handlers", RiskLevel: "low", Status: "completed", ParentID: 1},
+		{ID: 3, Title: "routes", RiskLevel: "low", Status: "pending", ParentID: 1, BlockedBy: []int64{2}},
+		{ID: 4, Title: "docs", RiskLevel: "low", Status: "pending", BlockedBy: []int64{1}},
+		{ID: 5, Title: "done", RiskLevel: "low", Status: "completed"},
+		{ID: 6, Title: "old", RiskLevel: "low", Status: "completed", ParentID: 5},
+	}
+	// Add a task to the epic and a new epic; the epic itself is left out
+	// but not cancelled, and routes stays in its epic.
+	diff, err := DiffPlan(current, []Task{
+		{ID: 3, Title: "routes", RiskLevel: "low", BlockedBy: []int64{2}},
+		{ID: 4, Title: "docs", RiskLevel: "low", BlockedBy: []int64{1}},
+		{ID: -1, Title: "middleware", RiskLevel: "low", ParentID: 1},
+		{ID: -2, Title: "client", RiskLevel: "low", BlockedBy: []int64{1}},
+		{ID: -3, Title: "client types", RiskLevel: "low", ParentID: -2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Cancelled) != 0 {
+		t.Errorf("cancelled = %v, want none", diff.Cancelled)
+	}
+	if len(diff.Added) != 3 {
+		t.Fatalf("added = %+v", diff.Added)
+	}
+	diff.Renumber(map[int64]int64{-1: 7, -2: 8, -3: 9})
+	if diff.Added[0].ParentID != 1 || diff.Added[2].ParentID != 8 {
+		t.Errorf("renumbered added = %+v", diff.Added)
+	}
+
+	for name, revised := range map[string][]Task{
+		"finished epic": {{ID: -1, Title: "x", RiskLevel: "low", ParentID: 5}},
+		"not an epic":   {{ID: -1, Title: "x", RiskLevel: "low", ParentID: 4}},
+		"unknown epic":  {{ID: -1, Title: "x", RiskLevel: "low", ParentID: 9}},
+		"nested epic": {
+			{ID: -1, Title: "x", RiskLevel: "low", ParentID: 1},
+			{ID: -2, Title: "y", RiskLevel: "low", ParentID: -1},
+		},
+		"cycle through epic": {
+			{ID: 3, BlockedBy: []int64{2, -1}},
+			{ID: -1, Title: "x", RiskLevel: "low", BlockedBy: []int64{1}},
+		},
+	} {
+		if _, err := DiffPlan(current, revised); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestScopesOverlap(t *testing.T) {
+	cases := []struct {
+		a, b []string
+		want bool
+	}{
+		{[]string{"internal/auth/**"}, []string{"internal/auth/token.go"}, true},
+		{[]string{"internal/auth"}, []string{"internal/auth/token.go"}, true},
+		{[]string{"internal/auth/**"}, []string{"internal/db/**"}, false},
+		{[]string{"internal/*/handler.go"}, []string{"internal/auth/handler.go"}, true},
+		{[]string{"internal/*/handler.go"}, []string{"internal/auth/token.go"}, false},
+		{[]string{"go.mod"}, []string{"./go.mod"}, true},
+		{[]string{"*.md"}, []string{"*.go"}, true},
+		{nil, []string{"**"}, false},
+	}
+	for _, c := range cases {
+		if got := ScopesOverlap(c.a, c.b); got != c.want {
+			t.Errorf("ScopesOverlap(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestInScope(t *testing.T) {
+	scope := []string{"internal/auth/**", "cmd/*/main.go", "go.mod", "docs"}
+	cases := map[string]bool{
+		"internal/auth/token.go":      true,
+		"internal/auth/jwt/claims.go": true,
+		"cmd/server/main.go":          true,
+		"cmd/server/flags.go":         false,
+		"go.mod":                      true,
+		"go.sum":                      false,
+		"docs/auth.md":                true,
+		"internal/db/pool.go":         false,
+	}
+	for file, want := range cases {
+		if got := InScope(file, scope); got != want {
+			t.Errorf("InScope(%q) = %v, want %v", file, got, want)
+		}
+	}
+}
+
+func TestConflictsWith(t *testing.T) {
+	a := Task{ID: 1, FileScope: []string{"internal/auth/**"}}
+	b := Task{ID: 2, FileScope: []string{"internal/auth/token.go"}}
+	if !a.ConflictsWith(b) {
+		t.Error("expected overlapping scopes to conflict")
+	}
+	b.AllowOverlap = true
+	if a.ConflictsWith(b) {
+		t.Error("expected allow_overlap to prevent a conflict")
+	}
+	if a.ConflictsWith(Task{ID: 3}) {
+		t.Error("expected a task without a scope not to conflict")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("héllo", 2); got != "h [truncated]" {
+		t.Errorf("truncate in a character = %q", got)
+	}
+	if got := truncate("héllo", 3); got != "hé [truncated]" {
+		t.Errorf("truncate after a character = %q", got)
+	}
+	if got := truncate("hello", 5); got != "hello" {
+		t.Errorf("truncate of a short string = %q", got)
+	}
+}
+
+func TestParsePlannerOutput(t *testing.T) {
+	structured := `{"type":"result","subtype":"success","is_error":false,"result":"Here is the plan.",
+		"structured_output":{"tasks":[{"id":1,"title":"schema","description":"add table","risk_level":"low"}]}}`
+	tasks, err := parsePlannerOutput([]byte(structured))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "schema" {
+		t.Errorf("unexpected tasks %+v", tasks)
+	}
+
+	// Without structured output the result must be the plan itself.
+	fenced := `{"type":"result","subtype":"success","is_error":false,
+		"result":"` + "```json\\n" + `{\"tasks\":[{\"id\":1,\"title\":\"a\",\"description\":\"\",\"risk_level\":\"low\"}]}` + "\\n```" + `"}`
+	if _, err := parsePlannerOutput([]byte(fenced)); err != nil {
+		t.Errorf("fenced plan: %v", err)
+	}
+	twoBlocks := `{"type":"result","subtype":"success","is_error":false,
+		"result":"{\"tasks\":[]} and {\"tasks\":[]}"}`
+	if _, err := parsePlannerOutput([]byte(twoBlocks)); err == nil {
+		t.Error("expected an error for a result with two JSON blocks")
+	}
+	for _, empty := range []string{"", `{"type":"result","subtype":"success","is_error":false,"result":""}`} {
+		if _, err := parsePlannerOutput([]byte(empty)); err == nil || !strings.Contains(err.Error(), "no ") || strings.Contains(err.Error(), "EOF") {
+			t.Errorf("empty output %q: got %v, want an error saying there is no plan", empty, err)
+		}
+	}
+	failed := `{"type":"result","subtype":"error_max_turns","is_error":true,"result":""}`
+	if _, err := parsePlannerOutput([]byte(failed)); err == nil || !strings.Contains(err.Error(), "error_max_turns") {
+		t.Errorf("expected the failure subtype, got %v", err)
+	}
+}
+
+func TestPlanSchemaViolations(t *testing.T) {
+	tests := []struct {
+		plan, want string
+	}{
+		{`[]`, "plan: expected an object, got an array"},
+		{`{"tasks": [{"id": 1, "title": "a", "description": "", "risk_level": "urgent"}]}`,
+			`tasks[0].risk_level: "urgent" is not one of low, medium, high`},
+		{`{"tasks": [{"id": 1, "title": "a", "risk_level": "low"}]}`,
+			`tasks[0]: missing required property "description"`},
+		{`{"tasks": [{"id": 1.5, "title": "a", "description": "", "risk_level": "low"}]}`,
+			"tasks[0].id: expected an integer, got 1.5"},
+		{`{"tasks": [{"id": 1, "title": "a", "description": "", "risk_level": "low", "blocked_by": ["2"]}]}`,
+			"tasks[0].blocked_by[0]: expected an integer, got a string"},
+		{`{"tasks": [{"id": 1, "title": "a", "description": "", "risk_level": "low", "priority": 2}]}`,
+			`tasks[0]: unknown property "priority"`},
+		{`{"tasks": []} {"tasks": []}`, "unexpected data after the plan"},
+	}
+	for _, tt := range tests {
+		_, err := decodePlan([]byte(tt.plan))
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("decodePlan(%s) = %v, want %q", tt.plan, err, tt.want)
+		}
+	}
+
+	// A plan written by MarshalPlan, with its null lists, is valid.
+	data, err := MarshalPlan(&DAG{Tasks: []Task{{ID: 1, Title: "a", RiskLevel: "low"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePlan(data); err != nil {
+		t.Errorf("ParsePlan(MarshalPlan(...)): %v", err)
+	}
+}
@@ -1,11 +1,11 @@
 package dag
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
-	"regexp"
 	"strings"
 )
 
@@ -26,59 +26,103 @@ type decompositionResponse struct {
 	Tasks []Task `json:"tasks"`
 }
 
-// jsonBlockRe matches a JSON object in Claude's text output.
-var jsonBlockRe = regexp.MustCompile(`(?s)\{.*"tasks"\s*:\s*\[.*\]\s*\}`)
-
 // DecomposePrompt takes a user prompt and returns a structured DAG
-// by asking Claude Code to decompose it.
-func DecomposePrompt(prompt string, projectDir string) (*DAG, error) {
+// by asking Claude Code to decompose it in light of the repository.
+func DecomposePrompt(prompt string, repo RepoContext, projectDir string) (*DAG, error) {
 	plannerPrompt := fmt.Sprintf(`You are a task decomposition agent. Given the following user request,
 decompose it into a set of tasks that can be executed in parallel where possible.
-
-Output ONLY valid JSON in this exact format:
-{
-  "tasks": [
-    {
-      "id": 1,
-      "title": "short title",
-      "description": "detailed description of what to implement",
-      "risk_level": "low|medium|high",
-      "blocked_by": []
-    }
-  ]
-}
+Answer with the task list in the structured output format.
 
 Rules:
 - Each task should be independently implementable in its own git branch
 - Use blocked_by to express dependencies (array of task IDs)
 - Tasks with no blocked_by can run in parallel immediately
+- For a large request, group related tasks into epics: an epic is a task that other tasks name as their parent_id. No agent works on an epic; it completes when all of its tasks do. Epics cannot be nested
+- blocked_by on an epic applies to every task in it, and a task blocked by an epic waits for all of the epic's tasks
 - Keep tasks focused: one module/feature per task
 - Include verification/testing as separate tasks where appropriate
+- Build on the repository as it is: reuse its layout, conventions and the decisions already made
+- domains are short lowercase names for the areas a task touches; tasks in the same area share them, and known context uses them too
+- acceptance_criteria are concrete, checkable statements of what "done" means
+- file_scope lists the paths or globs the task will change ("**" matches any depth); tasks whose file_scope overlaps never run at the same time, so keep scopes tight
+- Set "allow_overlap": true only on a task whose edits to shared files are small and safe to merge, such as registering a route
+- Use permission_profile "read-only" for tasks that only investigate or review and must not change files
+- Omit mcp_servers unless a task needs an MCP server the project does not already configure; it uses the .mcp.json "mcpServers" form, e.g. {"docs": {"command": "docs-mcp"}}
 
-User request: %s`, prompt)
+%s
+User request: %s`, repo.section(), prompt)
+
+	tasks, err := runPlanner(plannerPrompt, projectDir)
+	if err != nil {
+		return nil, err
+	}
+	return buildDAG(tasks), nil
+}
+
+// plannerResult is the part of Claude Code's JSON output the planner needs.
+type plannerResult struct {
+	Subtype          string          `json:"subtype"`
+	IsError          bool            `json:"is_error"`
+	Result           string          `json:"result"`
+	StructuredOutput json.RawMessage `json:"structured_output"`
+}
 
-	cmd := exec.Command("claude", "--print", plannerPrompt)
+// runPlanner asks Claude Code for a task list in the plan schema and checks
+// its answer against the schema.
+func runPlanner(plannerPrompt, projectDir string) ([]Task, error) {
+	cmd := exec.Command("claude", "--print", "--output-format", "json", "--json-schema", planSchemaJSON, plannerPrompt)
 	cmd.Dir = projectDir
 	cmd.Env = filterEnv(os.Environ(), "CLAUDECODE")
 	var stderr strings.Builder
 	cmd.Stderr = &stderr
 	output, err := cmd.Output()
 	if err != nil {
-		return nil, fmt.Errorf("claude decompose: %w\nstderr: %s", err, stderr.String())
+		return nil, fmt.Errorf("claude planner: %w\nstderr: %s", err, stderr.String())
 	}
+	return parsePlannerOutput(output)
+}
 
-	// Extract JSON block from Claude's text output.
-	jsonBytes := jsonBlockRe.Find(output)
-	if jsonBytes == nil {
-		return nil, fmt.Errorf("no JSON block found in claude output: %s", output)
+// parsePlannerOutput reads the plan from Claude Code's JSON output. The plan
+// is the structured output; without one, the whole result text must be the
+// plan, optionally in a single fenced code block.
+func parsePlannerOutput(output []byte) ([]Task, error) {
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil, fmt.Errorf("claude planner returned no output")
+	}
+	var res plannerResult
+	if err := json.Unmarshal(output, &res); err != nil {
+		return nil, fmt.Errorf("parse claude output: %w", err)
+	}
+	if res.IsError {
+		return nil, fmt.Errorf("claude planner failed (%s): %s", res.Subtype, res.Result)
 	}
 
-	var resp decompositionResponse
-	if err := json.Unmarshal(jsonBytes, &resp); err != nil {
-		return nil, fmt.Errorf("parse decomposition JSON: %w", err)
+	plan := []byte(res.StructuredOutput)
+	if len(plan) == 0 || string(plan) == "null" {
+		plan = []byte(stripCodeFence(res.Result))
 	}
+	if len(plan) == 0 {
+		return nil, fmt.Errorf("the model returned no plan (result: %q)", res.Result)
+	}
+	tasks, err := decodePlan(plan)
+	if err != nil {
+		return nil, fmt.Errorf("planner output does not match the plan schema: %w", err)
+	}
+	return tasks, nil
+}
 
-	return buildDAG(resp.Tasks), nil
+// stripCodeFence returns the contents of s if it is a single fenced code
+// block, or s trimmed otherwise.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	body := strings.TrimSuffix(s[3:], "```")
+	if _, rest, ok := strings.Cut(body, "\n"); ok {
+		body = rest // drop the language tag line
+	}
+	return strings.TrimSpace(body)
 }
 
 // buildDAG converts a flat task list with blocked_by fields into a DAG with edges.
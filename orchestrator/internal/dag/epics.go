@@ -0,0 +1,68 @@
+package dag
+
+import "fmt"
+
+// Epics returns the IDs of the tasks that other tasks name as their parent.
+func Epics(tasks []Task) map[int64]bool {
+	epics := make(map[int64]bool)
+	for _, t := range tasks {
+		if t.ParentID != 0 {
+			epics[t.ParentID] = true
+		}
+	}
+	return epics
+}
+
+// ParentsFirst returns the tasks with every epic ahead of the tasks in it,
+// the order in which they can be created.
+func ParentsFirst(tasks []Task) []Task {
+	ordered := make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		if t.ParentID == 0 {
+			ordered = append(ordered, t)
+		}
+	}
+	for _, t := range tasks {
+		if t.ParentID != 0 {
+			ordered = append(ordered, t)
+		}
+	}
+	return ordered
+}
+
+// blockers returns what a task waits for: its own blockers and its epic's.
+func blockers(t Task, byID map[int64]Task) []int64 {
+	if t.ParentID == 0 {
+		return t.BlockedBy
+	}
+	parent := byID[t.ParentID].BlockedBy
+	if len(parent) == 0 {
+		return t.BlockedBy
+	}
+	return append(append([]int64{}, t.BlockedBy...), parent...)
+}
+
+// checkParents checks that every parent_id names another task of the plan
+// and that epics are not themselves part of an epic.
+func checkParents(tasks []Task) error {
+	byID := make(map[int64]Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	for _, t := range tasks {
+		if t.ParentID == 0 {
+			continue
+		}
+		parent, ok := byID[t.ParentID]
+		switch {
+		case t.ParentID == t.ID:
+			return fmt.Errorf("task %d is its own epic", t.ID)
+		case !ok:
+			return fmt.Errorf("task %d belongs to unknown epic %d", t.ID, t.ParentID)
+		case parent.ParentID != 0:
+			return fmt.Errorf("task %d belongs to task %d, which is itself part of epic %d; epics cannot be nested",
+				t.ID, t.ParentID, parent.ParentID)
+		}
+	}
+	return nil
+}
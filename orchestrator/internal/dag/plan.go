@@ -0,0 +1,122 @@
+package dag
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// riskLevels are the risk levels a task may have.
+var riskLevels = map[string]bool{"low": true, "medium": true, "high": true}
+
+// ParsePlan reads a plan in the decomposition format, {"tasks": [...]},
+// as stored for review or written by a reviewer, and checks it against
+// the plan schema and ValidateTasks.
+func ParsePlan(data []byte) (*DAG, error) {
+	tasks, err := decodePlan(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse plan: %w", err)
+	}
+	if err := ValidateTasks(tasks); err != nil {
+		return nil, err
+	}
+	return buildDAG(tasks), nil
+}
+
+// ParseRevision reads a revision of the remaining plan in the format the
+// planner answers re-planning with. DiffPlan checks it against the DAG.
+func ParseRevision(data []byte) ([]Task, error) {
+	tasks, err := decodePlan(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse revision: %w", err)
+	}
+	return tasks, nil
+}
+
+// MarshalPlan writes a DAG in the decomposition format read by ParsePlan.
+func MarshalPlan(d *DAG) ([]byte, error) {
+	return json.MarshalIndent(decompositionResponse{Tasks: d.Tasks}, "", "  ")
+}
+
+// ValidateTasks checks that a plan can be run: IDs are unique, every task
+// has a title and a known risk level, epics are one level deep, and
+// blocked_by only names other tasks of the plan without forming a cycle.
+func ValidateTasks(tasks []Task) error {
+	if len(tasks) == 0 {
+		return fmt.Errorf("plan has no tasks")
+	}
+	byID := make(map[int64]Task, len(tasks))
+	for _, t := range tasks {
+		if _, dup := byID[t.ID]; dup {
+			return fmt.Errorf("task id %d is used twice", t.ID)
+		}
+		if t.Title == "" {
+			return fmt.Errorf("task %d has no title", t.ID)
+		}
+		if !riskLevels[t.RiskLevel] {
+			return fmt.Errorf("task %d: unknown risk level %q (known: low, medium, high)", t.ID, t.RiskLevel)
+		}
+		byID[t.ID] = t
+	}
+	for _, t := range tasks {
+		for _, dep := range t.BlockedBy {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("task %d is blocked by unknown task %d", t.ID, dep)
+			}
+			if dep == t.ID {
+				return fmt.Errorf("task %d is blocked by itself", t.ID)
+			}
+		}
+	}
+	if err := checkParents(tasks); err != nil {
+		return err
+	}
+
+	return checkAcyclic(tasks)
+}
+
+// checkAcyclic reports a cycle in the blocked_by relation of tasks, whose
+// blockers and epics must all be among them. A task waits on its epic's
+// blockers as well as its own, and an epic waits on its children.
+func checkAcyclic(tasks []Task) error {
+	byID := make(map[int64]Task, len(tasks))
+	children := make(map[int64][]int64)
+	for _, t := range tasks {
+		byID[t.ID] = t
+		if t.ParentID != 0 {
+			children[t.ParentID] = append(children[t.ParentID], t.ID)
+		}
+	}
+
+	// Depth-first search for a cycle.
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[int64]int, len(tasks))
+	var visit func(id int64) error
+	visit = func(id int64) error {
+		switch state[id] {
+		case visiting:
+			return fmt.Errorf("dependency cycle through task %d", id)
+		case done:
+			return nil
+		}
+		state[id] = visiting
+		deps := append(slices.Clone(blockers(byID[id], byID)), children[id]...)
+		for _, dep := range deps {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[id] = done
+		return nil
+	}
+	for _, t := range tasks {
+		if err := visit(t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
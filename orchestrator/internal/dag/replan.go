@@ -0,0 +1,318 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Re-planning triggers.
+const (
+	ReplanTaskFailed = "task_failed" // a task failed for good
+	ReplanStuck      = "stuck"       // pending tasks remain but none can start
+)
+
+// maxPlannerOutput bounds how much of a task's output the planner is shown.
+const maxPlannerOutput = 2000
+
+// ReplanRequest is what the planner is told when it revises a running plan.
+type ReplanRequest struct {
+	Prompt  string // the user request the run was decomposed from
+	Trigger string // ReplanTaskFailed or ReplanStuck
+	TaskID  int64  // the failed task, for ReplanTaskFailed
+	Tasks   []Task // the current DAG, from LoadTasks
+}
+
+// LoadTasks returns every task with its status, output and blocking
+// dependencies, as the planner sees the running DAG.
+func LoadTasks(ctx context.Context, db *pgxpool.Pool) ([]Task, error) {
+	rows, err := db.Query(ctx, `
+		SELECT t.id, t.title, t.description, t.risk_level, t.status, t.file_scope, COALESCE(t.parent_id, 0),
+		       COALESCE(t.assigned_to, ''), COALESCE(t.output, ''), COALESCE(t.failure_reason, ''),
+		       COALESCE((SELECT array_agg(e.from_task ORDER BY e.from_task) FROM task_edges e
+		                 WHERE e.to_task = t.id AND e.edge_type = 'blocks'), '{}')
+		FROM tasks t
+		ORDER BY t.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		var t Task
+		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.RiskLevel, &t.Status, &t.FileScope, &t.ParentID,
+			&t.AssignedTo, &t.Output, &t.FailureReason, &t.BlockedBy); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// Replan asks Claude Code for a revised list of the remaining tasks. The
+// answer is checked and turned into changes by DiffPlan.
+func Replan(req ReplanRequest, projectDir string) ([]Task, error) {
+	return runPlanner(replanPrompt(req), projectDir)
+}
+
+func replanPrompt(req ReplanRequest) string {
+	var b strings.Builder
+	switch req.Trigger {
+	case ReplanTaskFailed:
+		fmt.Fprintf(&b, "Task #%d of a partly executed plan failed and will not be retried.\n", req.TaskID)
+	default:
+		b.WriteString("A partly executed plan is stuck: tasks are pending, but none can start and none is running.\n")
+	}
+	b.WriteString(`You are the task planning agent. Revise the remaining plan so the user request can still be met.
+
+Current tasks:
+`)
+	epics := Epics(req.Tasks)
+	for _, t := range req.Tasks {
+		status := t.Status
+		if t.FailureReason != "" {
+			status += ": " + t.FailureReason
+		}
+		kind := ""
+		if epics[t.ID] {
+			kind = "epic, "
+		}
+		fmt.Fprintf(&b, "\n#%d [%s] %s (%srisk: %s)\n", t.ID, status, t.Title, kind, t.RiskLevel)
+		if t.ParentID != 0 {
+			fmt.Fprintf(&b, "  part of epic: %d\n", t.ParentID)
+		}
+		if len(t.BlockedBy) > 0 {
+			ids := make([]string, len(t.BlockedBy))
+			for i, dep := range t.BlockedBy {
+				ids[i] = fmt.Sprint(dep)
+			}
+			fmt.Fprintf(&b, "  blocked by: %s\n", strings.Join(ids, ", "))
+		}
+		if len(t.FileScope) > 0 {
+			fmt.Fprintf(&b, "  file scope: %s\n", strings.Join(t.FileScope, ", "))
+		}
+		fmt.Fprintf(&b, "  description: %s\n", t.Description)
+		if t.Output != "" {
+			fmt.Fprintf(&b, "  output: %s\n", truncate(t.Output, maxPlannerOutput))
+		}
+	}
+	fmt.Fprintf(&b, `
+Answer with the remaining plan as a task list in the structured output format.
+
+Rules:
+- List every pending task that should still run under its current id; pending tasks you leave out are cancelled
+- You may change the title, description, risk_level and blocked_by of pending tasks
+- Add new tasks with negative ids (-1, -2, ...); blocked_by refers to them by these ids
+- blocked_by may name completed, running, pending or new tasks, but never failed or cancelled ones
+- Epics take their status from their tasks and cannot change; leave them out, and cancel an epic by leaving out its pending tasks
+- A new task may set parent_id to an unfinished epic or to a new task without a parent_id, which becomes an epic
+- Completed, running, failed and cancelled tasks cannot change; leave them out
+- file_scope lists the paths or globs a new task will change; tasks whose file_scope overlaps never run at the same time
+- To redo failed work, add a new task that accounts for why it failed
+
+User request: %s`, req.Prompt)
+	return b.String()
+}
+
+// Diff is a revision of the remaining plan, as applied to tasks and
+// task_edges.
+type Diff struct {
+	// Added are new tasks. Until Renumber is called their IDs are the
+	// planner's negative placeholders, which AddedEdges refer to as well.
+	Added     []Task  `json:"added,omitempty"`
+	Cancelled []int64 `json:"cancelled,omitempty"`
+	// Updated holds the changed title, description and risk level of
+	// pending tasks; fields left empty are unchanged.
+	Updated      []Task `json:"updated,omitempty"`
+	AddedEdges   []Edge `json:"added_edges,omitempty"`
+	RemovedEdges []Edge `json:"removed_edges,omitempty"`
+}
+
+// Empty reports whether the revision changes nothing.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Cancelled) == 0 && len(d.Updated) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Renumber replaces the placeholder IDs of added tasks with the IDs they
+// were created with.
+func (d *Diff) Renumber(ids map[int64]int64) {
+	id := func(old int64) int64 {
+		if n, ok := ids[old]; ok {
+			return n
+		}
+		return old
+	}
+	for i := range d.Added {
+		d.Added[i].ID = id(d.Added[i].ID)
+		d.Added[i].ParentID = id(d.Added[i].ParentID)
+		for j := range d.Added[i].BlockedBy {
+			d.Added[i].BlockedBy[j] = id(d.Added[i].BlockedBy[j])
+		}
+	}
+	for i := range d.AddedEdges {
+		d.AddedEdges[i] = Edge{From: id(d.AddedEdges[i].From), To: id(d.AddedEdges[i].To)}
+	}
+}
+
+// DiffPlan compares the planner's revised remaining tasks with the current
+// DAG (from LoadTasks). Pending tasks left out are cancelled and tasks with
+// negative IDs are added; tasks that are no longer pending cannot change and
+// are ignored, as are epics, whose status follows their tasks. A revision
+// that leaves a task blocked by a failed or cancelled task, that puts a new
+// task in anything but an unfinished epic or a new top-level task, or that
+// forms a cycle, is an error.
+func DiffPlan(current, revised []Task) (Diff, error) {
+	var diff Diff
+	byID := make(map[int64]Task, len(current))
+	for _, t := range current {
+		byID[t.ID] = t
+	}
+	epics := Epics(current)
+	revisedByID := make(map[int64]Task, len(revised))
+	for _, r := range revised {
+		revisedByID[r.ID] = r
+	}
+
+	kept := make(map[int64]bool)
+	added := make(map[int64]bool)
+	var remaining []Task
+	for _, r := range revised {
+		switch c, ok := byID[r.ID]; {
+		case r.ID < 0:
+			if added[r.ID] {
+				return Diff{}, fmt.Errorf("task id %d is used twice", r.ID)
+			}
+			added[r.ID] = true
+		case !ok:
+			return Diff{}, fmt.Errorf("unknown task %d", r.ID)
+		case c.Status != "pending", epics[r.ID]:
+			continue
+		case kept[r.ID]:
+			return Diff{}, fmt.Errorf("task id %d is used twice", r.ID)
+		default:
+			kept[r.ID] = true
+		}
+		remaining = append(remaining, r)
+	}
+	cancelled := make(map[int64]bool)
+	for _, c := range current {
+		if c.Status == "pending" && !kept[c.ID] && !epics[c.ID] {
+			cancelled[c.ID] = true
+			diff.Cancelled = append(diff.Cancelled, c.ID)
+		}
+	}
+
+	// The DAG as it will be: unchangeable tasks as they are, plus the revision.
+	var result []Task
+	for _, c := range current {
+		if c.Status != "pending" || epics[c.ID] {
+			result = append(result, Task{ID: c.ID, BlockedBy: c.BlockedBy, ParentID: c.ParentID})
+		}
+	}
+	for _, r := range remaining {
+		for _, dep := range r.BlockedBy {
+			d, ok := byID[dep]
+			switch {
+			case dep == r.ID:
+				return Diff{}, fmt.Errorf("task %d is blocked by itself", r.ID)
+			case dep < 0 && !added[dep], dep >= 0 && !ok:
+				return Diff{}, fmt.Errorf("task %d is blocked by unknown task %d", r.ID, dep)
+			case d.Status == "failed" || d.Status == "cancelled":
+				return Diff{}, fmt.Errorf("task %d is blocked by task %d, which is %s", r.ID, dep, d.Status)
+			case cancelled[dep]:
+				return Diff{}, fmt.Errorf("task %d is blocked by task %d, which the revision cancels", r.ID, dep)
+			}
+		}
+		c := byID[r.ID]
+		if r.ID >= 0 {
+			// Tasks stay in the epic they were planned in.
+			r.ParentID = c.ParentID
+		}
+		result = append(result, Task{ID: r.ID, BlockedBy: r.BlockedBy, ParentID: r.ParentID})
+
+		if r.ID < 0 {
+			if r.Title == "" {
+				return Diff{}, fmt.Errorf("new task %d has no title", r.ID)
+			}
+			if err := checkNewParent(r, byID, epics, revisedByID, added); err != nil {
+				return Diff{}, err
+			}
+			if !riskLevels[r.RiskLevel] {
+				return Diff{}, fmt.Errorf("new task %d: unknown risk level %q (known: low, medium, high)", r.ID, r.RiskLevel)
+			}
+			diff.Added = append(diff.Added, r)
+			c = Task{}
+		} else {
+			update := Task{ID: r.ID}
+			if r.Title != "" && r.Title != c.Title {
+				update.Title = r.Title
+			}
+			if r.Description != "" && r.Description != c.Description {
+				update.Description = r.Description
+			}
+			if r.RiskLevel != "" && r.RiskLevel != c.RiskLevel {
+				if !riskLevels[r.RiskLevel] {
+					return Diff{}, fmt.Errorf("task %d: unknown risk level %q (known: low, medium, high)", r.ID, r.RiskLevel)
+				}
+				update.RiskLevel = r.RiskLevel
+			}
+			if update.Title != "" || update.Description != "" || update.RiskLevel != "" {
+				diff.Updated = append(diff.Updated, update)
+			}
+		}
+
+		was := make(map[int64]bool, len(c.BlockedBy))
+		for _, dep := range c.BlockedBy {
+			was[dep] = true
+		}
+		is := make(map[int64]bool, len(r.BlockedBy))
+		for _, dep := range r.BlockedBy {
+			if !is[dep] && !was[dep] {
+				diff.AddedEdges = append(diff.AddedEdges, Edge{From: dep, To: r.ID})
+			}
+			is[dep] = true
+		}
+		for _, dep := range c.BlockedBy {
+			if !is[dep] {
+				diff.RemovedEdges = append(diff.RemovedEdges, Edge{From: dep, To: r.ID})
+			}
+		}
+	}
+	if err := checkAcyclic(result); err != nil {
+		return Diff{}, err
+	}
+	return diff, nil
+}
+
+// checkNewParent checks the epic a new task is put in: an existing epic
+// that has not finished, or a new task that is not itself in an epic.
+func checkNewParent(r Task, current map[int64]Task, epics map[int64]bool, revised map[int64]Task, added map[int64]bool) error {
+	switch p := r.ParentID; {
+	case p == 0:
+		return nil
+	case p == r.ID:
+		return fmt.Errorf("new task %d is its own epic", r.ID)
+	case p < 0:
+		if !added[p] {
+			return fmt.Errorf("new task %d belongs to unknown task %d", r.ID, p)
+		}
+		if pp := revised[p].ParentID; pp != 0 {
+			return fmt.Errorf("new task %d belongs to task %d, which is itself part of epic %d; epics cannot be nested", r.ID, p, pp)
+		}
+	default:
+		c, ok := current[p]
+		switch {
+		case !ok:
+			return fmt.Errorf("new task %d belongs to unknown task %d", r.ID, p)
+		case !epics[p]:
+			return fmt.Errorf("new task %d belongs to task %d, which is not an epic", r.ID, p)
+		case c.Status == "completed" || c.Status == "failed" || c.Status == "cancelled":
+			return fmt.Errorf("new task %d belongs to epic %d, which is %s", r.ID, p, c.Status)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Bounds on how much repository context the planner is shown.
+const (
+	maxClaudeMD      = 8000
+	maxContextRows   = 50
+	maxDecisionRows  = 30
+	maxRecentCommits = 20
+)
+
+// RepoContext is what the planner is told about the repository it plans
+// for. Parts that cannot be read are left empty.
+type RepoContext struct {
+	// Tree lists the tracked top-level entries; directories end in "/".
+	Tree     []string
+	ClaudeMD string
+	// Context and Decisions are rows of the context and decisions tables,
+	// formatted one per line.
+	Context   []string
+	Decisions []string
+	// Commits are the latest commits, one line each, newest first.
+	Commits []string
+}
+
+// LoadRepoContext gathers the repository context for decomposition.
+func LoadRepoContext(ctx context.Context, db *pgxpool.Pool, projectDir string) (RepoContext, error) {
+	var rc RepoContext
+	rc.Tree = topLevelTree(projectDir)
+	if data, err := os.ReadFile(filepath.Join(projectDir, "CLAUDE.md")); err == nil {
+		rc.ClaudeMD = truncate(strings.TrimSpace(string(data)), maxClaudeMD)
+	}
+	rc.Commits = gitLines(projectDir, "log", "--oneline", "--no-decorate", fmt.Sprintf("-%d", maxRecentCommits))
+
+	rows, err := db.Query(ctx, `
+		SELECT domain, key_name, value
+		FROM context
+		ORDER BY updated_at DESC
+		LIMIT $1`, maxContextRows)
+	if err != nil {
+		return rc, err
+	}
+	for rows.Next() {
+		var domain, key, value string
+		if err := rows.Scan(&domain, &key, &value); err != nil {
+			rows.Close()
+			return rc, err
+		}
+		rc.Context = append(rc.Context, fmt.Sprintf("%s/%s: %s", domain, key, oneLine(value)))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rc, err
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT domain, decision, rationale
+		FROM decisions
+		ORDER BY created_at DESC
+		LIMIT $1`, maxDecisionRows)
+	if err != nil {
+		return rc, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain, decision, rationale string
+		if err := rows.Scan(&domain, &decision, &rationale); err != nil {
+			return rc, err
+		}
+		rc.Decisions = append(rc.Decisions, fmt.Sprintf("[%s] %s — %s", domain, oneLine(decision), oneLine(rationale)))
+	}
+	return rc, rows.Err()
+}
+
+// topLevelTree lists the tracked entries at the root of the repository.
+func topLevelTree(projectDir string) []string {
+	var tree []string
+	for _, line := range gitLines(projectDir, "ls-tree", "HEAD") {
+		// <mode> <type> <object>\t<name>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		if fields := strings.Fields(meta); len(fields) == 3 && fields[1] == "tree" {
+			name += "/"
+		}
+		tree = append(tree, name)
+	}
+	return tree
+}
+
+// gitLines runs git in dir and returns its non-empty output lines, or nil
+// if git fails.
+func gitLines(dir string, args ...string) []string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+	var lines []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate cuts s to at most n bytes, without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + " [truncated]"
+}
+
+// section renders the context as the "Repository" part of a planner prompt.
+func (rc RepoContext) section() string {
+	var b strings.Builder
+	b.WriteString("Repository:\n")
+	list := func(title string, lines []string) {
+		if len(lines) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, l := range lines {
+			fmt.Fprintf(&b, "- %s\n", l)
+		}
+	}
+	list("Top-level files and directories", rc.Tree)
+	list("Recent commits", rc.Commits)
+	list("Known context (domain/key: value)", rc.Context)
+	list("Decisions already made", rc.Decisions)
+	if rc.ClaudeMD != "" {
+		fmt.Fprintf(&b, "\nThe project's CLAUDE.md:\n%s\n", rc.ClaudeMD)
+	}
+	return b.String()
+}
@@ -6,22 +6,25 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// ReadyTasks queries Postgres for tasks that are pending, unassigned,
-// and have all blocking tasks completed.
+// ReadyTasks queries Postgres for tasks that are pending, unassigned, not
+// epics, and have all blocking tasks, their own and their epic's, completed.
 func ReadyTasks(ctx context.Context, db *pgxpool.Pool) ([]Task, error) {
 	query := `
-		SELECT t.id, t.title, t.description, t.risk_level
+		SELECT t.id, t.title, t.description, t.risk_level,
+		       COALESCE(t.branch, ''), COALESCE(t.resume_note, ''),
+		       t.domains, t.acceptance_criteria, t.permission_profile, t.mcp_servers,
+		       t.file_scope, t.allow_overlap, COALESCE(t.parent_id, 0)
 		FROM tasks t
 		WHERE t.status = 'pending'
 		  AND t.assigned_to IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = t.id)
 		  AND NOT EXISTS (
-		      SELECT 1 FROM task_edges e
-		      JOIN tasks blocker ON e.from_task = blocker.id
-		      WHERE e.to_task = t.id
-		        AND e.edge_type = 'blocks'
+		      SELECT 1 FROM task_blockers b
+		      JOIN tasks blocker ON b.blocker_id = blocker.id
+		      WHERE b.task_id = t.id
 		        AND blocker.status != 'completed'
 		  )
-		ORDER BY t.id
+		ORDER BY t.priority DESC, t.id
 	`
 
 	rows, err := db.Query(ctx, query)
@@ -33,7 +36,34 @@ func ReadyTasks(ctx context.Context, db *pgxpool.Pool) ([]Task, error) {
 	var tasks []Task
 	for rows.Next() {
 		var t Task
-		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.RiskLevel); err != nil {
+		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.RiskLevel, &t.Branch, &t.ResumeNote,
+			&t.Domains, &t.AcceptanceCriteria, &t.PermissionProfile, &t.MCPServers,
+			&t.FileScope, &t.AllowOverlap, &t.ParentID); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// RunningTasks returns the tasks being worked on, with the file scopes the
+// scheduler keeps ready tasks clear of.
+func RunningTasks(ctx context.Context, db *pgxpool.Pool) ([]Task, error) {
+	rows, err := db.Query(ctx, `
+		SELECT id, title, status, COALESCE(assigned_to, ''), file_scope, allow_overlap
+		FROM tasks
+		WHERE status IN ('in_progress', 'blocked')
+		  AND assigned_to IS NOT NULL
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []Task
+	for rows.Next() {
+		var t Task
+		if err := rows.Scan(&t.ID, &t.Title, &t.Status, &t.AssignedTo, &t.FileScope, &t.AllowOverlap); err != nil {
 			return nil, err
 		}
 		tasks = append(tasks, t)
@@ -0,0 +1,209 @@
+package dag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// schema is the subset of JSON Schema the plan format needs. It is given
+// to the planner as its output format and checked here, since the planner
+// is not bound to follow it.
+type schema struct {
+	Type                 string             `json:"type"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            int                `json:"minLength,omitempty"`
+}
+
+// closed is AdditionalProperties for objects that take no other properties.
+var closed = new(bool)
+
+func stringList(description string) *schema {
+	return &schema{Type: "array", Description: description, Items: &schema{Type: "string"}}
+}
+
+// taskSchema describes one task of the plan format, as Task marshals it.
+var taskSchema = &schema{
+	Type: "object",
+	Properties: map[string]*schema{
+		"id":          {Type: "integer", Description: "Unique within the plan; blocked_by refers to tasks by it"},
+		"title":       {Type: "string", MinLength: 1, Description: "Short title"},
+		"description": {Type: "string", Description: "Detailed description of what to implement"},
+		"risk_level":  {Type: "string", Enum: []string{"low", "medium", "high"}},
+		"blocked_by": {Type: "array", Items: &schema{Type: "integer"},
+			Description: "IDs of the tasks that must complete before this one starts"},
+		"parent_id": {Type: "integer",
+			Description: "ID of the epic the task belongs to; an epic is a task that other tasks name here"},
+		"domains":             stringList("Short lowercase names of the areas the task touches"),
+		"acceptance_criteria": stringList("Concrete, checkable statements of what done means"),
+		"permission_profile": {Type: "string",
+			Description: `Tool permissions of the task's agent: "default", or "read-only" for tasks that must not change files`},
+		"mcp_servers": {Type: "object",
+			Description: `Extra MCP servers for the task's agent, in the .mcp.json "mcpServers" form`},
+		"file_scope":    stringList(`Paths or globs relative to the repository root that the task will change; "**" matches any depth`),
+		"allow_overlap": {Type: "boolean", Description: "Whether the task may run alongside tasks whose file_scope overlaps its own"},
+	},
+	Required:             []string{"id", "title", "description", "risk_level"},
+	AdditionalProperties: closed,
+}
+
+// planSchema describes the decomposition format, {"tasks": [...]}.
+var planSchema = &schema{
+	Type: "object",
+	Properties: map[string]*schema{
+		"tasks": {Type: "array", Items: taskSchema},
+	},
+	Required:             []string{"tasks"},
+	AdditionalProperties: closed,
+}
+
+// planSchemaJSON is planSchema as passed to the planner.
+var planSchemaJSON = func() string {
+	data, err := json.Marshal(planSchema)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}()
+
+// decodePlan decodes a plan in the decomposition format, reporting where it
+// violates planSchema.
+func decodePlan(data []byte) ([]Task, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the plan")
+	}
+	if err := planSchema.validate("", v); err != nil {
+		return nil, err
+	}
+	var resp decompositionResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Tasks, nil
+}
+
+// validate checks a value decoded with UseNumber. Errors name the offending
+// value by its path, e.g. tasks[2].risk_level.
+func (s *schema) validate(path string, v any) error {
+	at := func(format string, args ...any) error {
+		where := path
+		if where == "" {
+			where = "plan"
+		}
+		return fmt.Errorf("%s: %s", where, fmt.Sprintf(format, args...))
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return at("expected an object, got %s", jsonType(v))
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return at("missing required property %q", name)
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			// Optional properties may be null, as Task writes empty lists.
+			if ok && obj[name] == nil && !slices.Contains(s.Required, name) {
+				continue
+			}
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return at("unknown property %q", name)
+				}
+				continue
+			}
+			if err := prop.validate(propertyPath(path, name), obj[name]); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			return at("expected an array, got %s", jsonType(v))
+		}
+		if s.Items != nil {
+			for i, item := range arr {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return at("expected a string, got %s", jsonType(v))
+		}
+		if len(str) < s.MinLength {
+			return at("must not be empty")
+		}
+		if len(s.Enum) > 0 && !slices.Contains(s.Enum, str) {
+			return at("%q is not one of %s", str, strings.Join(s.Enum, ", "))
+		}
+
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return at("expected an integer, got %s", jsonType(v))
+		}
+		if _, err := n.Int64(); err != nil {
+			return at("expected an integer, got %s", n)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return at("expected a boolean, got %s", jsonType(v))
+		}
+	}
+	return nil
+}
+
+func propertyPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "an object"
+	case []any:
+		return "an array"
+	case string:
+		return "a string"
+	case json.Number:
+		return "a number"
+	case bool:
+		return "a boolean"
+	}
+	return fmt.Sprintf("%T", v)
+}
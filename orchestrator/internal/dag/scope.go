@@ -0,0 +1,111 @@
+package dag
+
+import (
+	"path"
+	"strings"
+)
+
+// A file scope is a list of slash-separated paths or globs relative to the
+// repository root, naming the files a task expects to change. "*", "?" and
+// "[...]" match within one path segment, "**" matches any number of
+// segments, and a pattern matches everything below a directory it names.
+
+// ConflictsWith reports whether two tasks must not run at the same time
+// because their file scopes overlap. Tasks without a scope, and tasks
+// allowed to overlap, conflict with nothing.
+func (t Task) ConflictsWith(other Task) bool {
+	if t.AllowOverlap || other.AllowOverlap {
+		return false
+	}
+	return ScopesOverlap(t.FileScope, other.FileScope)
+}
+
+// ScopesOverlap reports whether some file could be in both scopes. Where
+// that cannot be decided, e.g. two wildcards in the same segment, it
+// assumes the scopes overlap.
+func ScopesOverlap(a, b []string) bool {
+	for _, p := range a {
+		for _, q := range b {
+			if segmentsOverlap(splitPattern(p), splitPattern(q)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// InScope reports whether file matches a pattern of scope.
+func InScope(file string, scope []string) bool {
+	f := splitPattern(file)
+	for _, p := range scope {
+		if matchSegments(splitPattern(p), f) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitPattern(p string) []string {
+	p = path.Clean(strings.TrimPrefix(p, "./"))
+	if p == "." || p == "/" {
+		return nil
+	}
+	return strings.Split(strings.TrimPrefix(p, "/"), "/")
+}
+
+func hasMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// segmentsOverlap compares two patterns segment by segment. Running out of
+// one pattern means it names a directory containing the rest of the other.
+func segmentsOverlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	if a[0] == "**" || b[0] == "**" {
+		return true
+	}
+	if !segmentOverlaps(a[0], b[0]) {
+		return false
+	}
+	return segmentsOverlap(a[1:], b[1:])
+}
+
+func segmentOverlaps(x, y string) bool {
+	switch {
+	case x == y:
+		return true
+	case hasMeta(x) && hasMeta(y):
+		return true
+	case hasMeta(x):
+		ok, _ := path.Match(x, y)
+		return ok
+	case hasMeta(y):
+		ok, _ := path.Match(y, x)
+		return ok
+	}
+	return false
+}
+
+// matchSegments matches a file path against a pattern.
+func matchSegments(pattern, file []string) bool {
+	if len(pattern) == 0 {
+		return true
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(file); i++ {
+			if matchSegments(pattern[1:], file[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(file) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], file[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], file[1:])
+}
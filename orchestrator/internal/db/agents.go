@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -34,6 +36,202 @@ func UpdateAgentStatus(ctx context.Context, pool *pgxpool.Pool, agentID string,
 	return err
 }
 
+// FinishAgent records the final status and process exit code of an agent.
+func FinishAgent(ctx context.Context, pool *pgxpool.Pool, agentID string, status string, exitCode int) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE agents SET status = $1, exit_code = $2, finished_at = NOW() WHERE agent_id = $3`,
+		status, exitCode, agentID,
+	)
+	return err
+}
+
+// IdleAgent is an agent whose task is finished but whose process is still running.
+type IdleAgent struct {
+	AgentID      string
+	TaskID       int64
+	WorktreePath string
+	// PermissionProfile is the profile of the finished task, which the
+	// running process was started with.
+	PermissionProfile string
+	// RiskLevel is the risk level of the finished task, which chose the
+	// running process's resource limits.
+	RiskLevel string
+}
+
+// IdleParentAgents returns idle agents whose finished task directly blocks
+// the given task or its epic.
+func IdleParentAgents(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]IdleAgent, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT a.agent_id, a.current_task_id, a.worktree_path, t.permission_profile, t.risk_level
+		FROM task_blockers b
+		JOIN agents a ON a.current_task_id = b.blocker_id
+		JOIN tasks t ON t.id = b.blocker_id
+		WHERE b.task_id = $1
+		  AND a.status = 'idle'
+		  AND t.status = 'completed'
+		  AND a.worktree_path IS NOT NULL
+		ORDER BY b.blocker_id`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var idle []IdleAgent
+	for rows.Next() {
+		var a IdleAgent
+		if err := rows.Scan(&a.AgentID, &a.TaskID, &a.WorktreePath, &a.PermissionProfile, &a.RiskLevel); err != nil {
+			return nil, err
+		}
+		idle = append(idle, a)
+	}
+	return idle, rows.Err()
+}
+
+// AcquireIdleAgent atomically moves an idle agent onto a new task,
+// returning false if the agent is no longer idle.
+func AcquireIdleAgent(ctx context.Context, pool *pgxpool.Pool, agentID string, taskID int64) (bool, error) {
+	tag, err := pool.Exec(ctx,
+		`UPDATE agents SET status = 'working', current_task_id = $1
+		 WHERE agent_id = $2 AND status = 'idle'`,
+		taskID, agentID,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// SetAgentTask points an agent at a task with the given status.
+func SetAgentTask(ctx context.Context, pool *pgxpool.Pool, agentID string, taskID int64, status string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE agents SET current_task_id = $1, status = $2 WHERE agent_id = $3`,
+		taskID, status, agentID,
+	)
+	return err
+}
+
+// AgentWorktreePath returns the worktree an agent works in.
+func AgentWorktreePath(ctx context.Context, pool *pgxpool.Pool, agentID string) (string, error) {
+	var path *string
+	err := pool.QueryRow(ctx, `SELECT worktree_path FROM agents WHERE agent_id = $1`, agentID).Scan(&path)
+	if err != nil || path == nil {
+		return "", err
+	}
+	return *path, nil
+}
+
+// PausableStatuses are the agent statuses a pause applies to.
+var PausableStatuses = []string{"starting", "working", "blocked"}
+
+// PauseAgents pauses the listed agents that are in one of PausableStatuses,
+// remembering their status for ResumeAgents, and returns the IDs that changed.
+func PauseAgents(ctx context.Context, pool *pgxpool.Pool, agentIDs []string) ([]string, error) {
+	return updateAgentIDs(ctx, pool,
+		`UPDATE agents SET status = 'paused', paused_from = status
+		 WHERE agent_id = ANY($1) AND status = ANY($2)
+		 RETURNING agent_id`,
+		agentIDs, PausableStatuses)
+}
+
+// ResumeAgents returns the listed paused agents to the status they had
+// before the pause, and returns the IDs that changed.
+func ResumeAgents(ctx context.Context, pool *pgxpool.Pool, agentIDs []string) ([]string, error) {
+	return updateAgentIDs(ctx, pool,
+		`UPDATE agents SET status = COALESCE(paused_from, 'working'), paused_from = NULL
+		 WHERE agent_id = ANY($1) AND status = 'paused'
+		 RETURNING agent_id`,
+		agentIDs)
+}
+
+// updateAgentIDs runs an UPDATE ... RETURNING agent_id and collects the IDs.
+func updateAgentIDs(ctx context.Context, pool *pgxpool.Pool, sql string, args ...any) ([]string, error) {
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changed []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		changed = append(changed, id)
+	}
+	return changed, rows.Err()
+}
+
+// ResolveAgentID expands a unique agent ID prefix (such as the 8-character
+// short IDs shown in logs) to the full agent ID.
+func ResolveAgentID(ctx context.Context, pool *pgxpool.Pool, prefix string) (string, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT agent_id FROM agents WHERE agent_id LIKE $1 || '%' ORDER BY started_at LIMIT 2`,
+		prefix,
+	)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return "", err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	switch len(ids) {
+	case 0:
+		return "", fmt.Errorf("no agent matches %q", prefix)
+	case 1:
+		return ids[0], nil
+	default:
+		return "", fmt.Errorf("agent ID %q is ambiguous", prefix)
+	}
+}
+
+// AgentInfo is a row of the agents table.
+type AgentInfo struct {
+	AgentID       string     `json:"agent_id"`
+	PID           int        `json:"pid"`
+	Status        string     `json:"status"`
+	CurrentTaskID *int64     `json:"current_task_id"`
+	WorktreePath  string     `json:"worktree_path,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	LastHeartbeat time.Time  `json:"last_heartbeat"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+	ExitCode      *int       `json:"exit_code,omitempty"`
+}
+
+// ListAgents returns all agents, oldest first.
+func ListAgents(ctx context.Context, pool *pgxpool.Pool) ([]AgentInfo, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agent_id, pid, status, current_task_id, COALESCE(worktree_path, ''),
+		       started_at, last_heartbeat, finished_at, exit_code
+		FROM agents
+		ORDER BY started_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var agents []AgentInfo
+	for rows.Next() {
+		var a AgentInfo
+		if err := rows.Scan(&a.AgentID, &a.PID, &a.Status, &a.CurrentTaskID, &a.WorktreePath,
+			&a.StartedAt, &a.LastHeartbeat, &a.FinishedAt, &a.ExitCode); err != nil {
+			return nil, err
+		}
+		agents = append(agents, a)
+	}
+	return agents, rows.Err()
+}
+
 // DeadAgent holds info about an agent detected as dead.
 type DeadAgent struct {
 	AgentID string
@@ -63,3 +261,67 @@ func MarkDeadAgents(ctx context.Context, pool *pgxpool.Pool, timeoutInterval str
 	}
 	return dead, rows.Err()
 }
+
+// AgentWorktree describes an agent that still has a worktree on disk.
+type AgentWorktree struct {
+	AgentID      string
+	Status       string
+	TaskID       *int64
+	TaskStatus   *string
+	WorktreePath string
+	// Branches are the branches of every task the agent worked on; an agent
+	// reused for follow-on tasks has one branch per task.
+	Branches   []string
+	StartedAt  time.Time
+	FinishedAt *time.Time
+	// HasPendingDependents is true when a task blocked by this agent's task has
+	// not started yet and will need this worktree's branch as its base.
+	HasPendingDependents bool
+}
+
+// ListAgentWorktrees returns every agent whose worktree has not been cleaned up.
+func ListAgentWorktrees(ctx context.Context, pool *pgxpool.Pool) ([]AgentWorktree, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT a.agent_id, a.status, a.current_task_id, t.status,
+		       a.worktree_path,
+		       ARRAY(SELECT branch FROM tasks
+		             WHERE assigned_to = a.agent_id AND branch IS NOT NULL
+		             ORDER BY id),
+		       a.started_at, a.finished_at,
+		       EXISTS (
+		           SELECT 1 FROM task_edges e
+		           JOIN tasks p ON e.from_task = p.id
+		           JOIN tasks c ON e.to_task = c.id
+		           WHERE p.assigned_to = a.agent_id
+		             AND e.edge_type = 'blocks'
+		             AND c.status = 'pending'
+		       )
+		FROM agents a
+		LEFT JOIN tasks t ON a.current_task_id = t.id
+		WHERE a.worktree_path IS NOT NULL
+		ORDER BY a.started_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []AgentWorktree
+	for rows.Next() {
+		var w AgentWorktree
+		if err := rows.Scan(&w.AgentID, &w.Status, &w.TaskID, &w.TaskStatus,
+			&w.WorktreePath, &w.Branches, &w.StartedAt, &w.FinishedAt, &w.HasPendingDependents); err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	return out, rows.Err()
+}
+
+// ClearAgentWorktree forgets an agent's worktree path once it has been removed.
+func ClearAgentWorktree(ctx context.Context, pool *pgxpool.Pool, agentID string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE agents SET worktree_path = NULL WHERE agent_id = $1`,
+		agentID,
+	)
+	return err
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Command is a runtime instruction for the orchestrator, issued by inserting
+// a row into orchestrator_commands.
+type Command struct {
+	ID       int64
+	Command  string
+	Args     json.RawMessage
+	IssuedBy string
+}
+
+// CommandResult is the orchestrator's acknowledgement of a command.
+type CommandResult struct {
+	CommandID int64
+	Applied   bool
+	Reason    string
+	Result    json.RawMessage
+}
+
+// IssueCommand queues a command for the orchestrator and returns its ID.
+func IssueCommand(ctx context.Context, pool *pgxpool.Pool, command string, args any, issuedBy string) (int64, error) {
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = pool.QueryRow(ctx,
+		`INSERT INTO orchestrator_commands (command, args, issued_by)
+		 VALUES ($1, $2, $3)
+		 RETURNING id`,
+		command, argsJSON, issuedBy,
+	).Scan(&id)
+	return id, err
+}
+
+// GetCommand fetches a command by ID.
+func GetCommand(ctx context.Context, pool *pgxpool.Pool, id int64) (Command, error) {
+	var c Command
+	err := pool.QueryRow(ctx,
+		`SELECT id, command, args, issued_by FROM orchestrator_commands WHERE id = $1`, id,
+	).Scan(&c.ID, &c.Command, &c.Args, &c.IssuedBy)
+	return c, err
+}
+
+// PendingCommands returns commands that have no result yet, oldest first.
+func PendingCommands(ctx context.Context, pool *pgxpool.Pool) ([]Command, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT c.id, c.command, c.args, c.issued_by
+		FROM orchestrator_commands c
+		LEFT JOIN command_results r ON r.command_id = c.id
+		WHERE r.command_id IS NULL
+		ORDER BY c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cmds []Command
+	for rows.Next() {
+		var c Command
+		if err := rows.Scan(&c.ID, &c.Command, &c.Args, &c.IssuedBy); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, c)
+	}
+	return cmds, rows.Err()
+}
+
+// CommandHandled reports whether a command already has a result.
+func CommandHandled(ctx context.Context, pool *pgxpool.Pool, id int64) (bool, error) {
+	var handled bool
+	err := pool.QueryRow(ctx,
+		`SELECT EXISTS(SELECT 1 FROM command_results WHERE command_id = $1)`, id,
+	).Scan(&handled)
+	return handled, err
+}
+
+// RecordCommandResult acknowledges a command. result may be nil.
+func RecordCommandResult(ctx context.Context, pool *pgxpool.Pool, id int64, applied bool, reason string, result any) error {
+	var resultJSON []byte
+	if result != nil {
+		var err error
+		if resultJSON, err = json.Marshal(result); err != nil {
+			return err
+		}
+	}
+	_, err := pool.Exec(ctx,
+		`INSERT INTO command_results (command_id, applied, reason, result)
+		 VALUES ($1, $2, NULLIF($3, ''), $4)
+		 ON CONFLICT (command_id) DO NOTHING`,
+		id, applied, reason, resultJSON,
+	)
+	return err
+}
+
+// WaitCommandResult polls for a command's result until it arrives or timeout
+// elapses, returning pgx.ErrNoRows on timeout.
+func WaitCommandResult(ctx context.Context, pool *pgxpool.Pool, id int64, timeout time.Duration) (CommandResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var r CommandResult
+		var reason *string
+		err := pool.QueryRow(ctx,
+			`SELECT command_id, applied, reason, result FROM command_results WHERE command_id = $1`, id,
+		).Scan(&r.CommandID, &r.Applied, &reason, &r.Result)
+		if err == nil {
+			if reason != nil {
+				r.Reason = *reason
+			}
+			return r, nil
+		}
+		if err != pgx.ErrNoRows || time.Now().After(deadline) {
+			return r, err
+		}
+		select {
+		case <-ctx.Done():
+			return r, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ActiveBranch is the branch of a task an agent is working on.
+type ActiveBranch struct {
+	TaskID  int64
+	Title   string
+	AgentID string
+	Branch  string
+	BaseSHA string
+}
+
+// ActiveBranches returns the branches of tasks in progress or blocked,
+// ordered by task ID.
+func ActiveBranches(ctx context.Context, pool *pgxpool.Pool) ([]ActiveBranch, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT id, title, assigned_to, branch, COALESCE(base_sha, '')
+		 FROM tasks
+		 WHERE status IN ('in_progress', 'blocked')
+		   AND branch IS NOT NULL
+		   AND assigned_to IS NOT NULL
+		 ORDER BY id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var branches []ActiveBranch
+	for rows.Next() {
+		var b ActiveBranch
+		if err := rows.Scan(&b.TaskID, &b.Title, &b.AgentID, &b.Branch, &b.BaseSHA); err != nil {
+			return nil, err
+		}
+		branches = append(branches, b)
+	}
+	return branches, rows.Err()
+}
+
+// BranchConflict is a recorded collision between two tasks' branches.
+type BranchConflict struct {
+	TaskA   int64
+	TaskB   int64
+	BranchA string
+	BranchB string
+	Kind    string
+	Files   []string
+}
+
+// RecordConflict records a collision between two branches, with c.TaskA
+// the lower task ID. It returns the conflict's ID, and whether it is new:
+// not recorded before, resolved since, or now on different files.
+func RecordConflict(ctx context.Context, pool *pgxpool.Pool, c BranchConflict) (int64, bool, error) {
+	var id int64
+	err := pool.QueryRow(ctx,
+		`INSERT INTO branch_conflicts (task_a, task_b, branch_a, branch_b, kind, files)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (task_a, task_b) DO UPDATE
+		   SET branch_a = EXCLUDED.branch_a,
+		       branch_b = EXCLUDED.branch_b,
+		       kind = EXCLUDED.kind,
+		       files = EXCLUDED.files,
+		       detected_at = NOW(),
+		       resolved_at = NULL
+		   WHERE branch_conflicts.resolved_at IS NOT NULL
+		      OR branch_conflicts.kind != EXCLUDED.kind
+		      OR branch_conflicts.files != EXCLUDED.files
+		 RETURNING id`,
+		c.TaskA, c.TaskB, c.BranchA, c.BranchB, c.Kind, c.Files,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		err = pool.QueryRow(ctx,
+			`SELECT id FROM branch_conflicts WHERE task_a = $1 AND task_b = $2`,
+			c.TaskA, c.TaskB,
+		).Scan(&id)
+		return id, false, err
+	}
+	return id, err == nil, err
+}
+
+// ResolveConflicts marks every unresolved conflict not in current as
+// resolved.
+func ResolveConflicts(ctx context.Context, pool *pgxpool.Pool, current []int64) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE branch_conflicts SET resolved_at = NOW()
+		 WHERE resolved_at IS NULL AND id != ALL(COALESCE($1, ARRAY[]::BIGINT[]))`,
+		current,
+	)
+	return err
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ContextEntry is a piece of shared knowledge written by an agent.
+type ContextEntry struct {
+	AgentID    string
+	Domain     string
+	KeyName    string
+	Value      string
+	Confidence float32
+	SourceFile string
+}
+
+// ContextInDomains returns the context entries of the given domains.
+func ContextInDomains(ctx context.Context, pool *pgxpool.Pool, domains []string) ([]ContextEntry, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT agent_id, domain, key_name, value, confidence, COALESCE(source_file, '')
+		FROM context
+		WHERE domain = ANY($1)
+		ORDER BY domain, key_name`, domains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ContextEntry
+	for rows.Next() {
+		var c ContextEntry
+		if err := rows.Scan(&c.AgentID, &c.Domain, &c.KeyName, &c.Value, &c.Confidence, &c.SourceFile); err != nil {
+			return nil, err
+		}
+		entries = append(entries, c)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Decision is an architectural decision recorded by an agent.
+type Decision struct {
+	ID           int64     `json:"id"`
+	AgentID      string    `json:"agent_id"`
+	Domain       string    `json:"domain"`
+	Decision     string    `json:"decision"`
+	Rationale    string    `json:"rationale"`
+	Alternatives string    `json:"alternatives_considered,omitempty"`
+	RiskLevel    string    `json:"risk_level"`
+	Branch       string    `json:"branch,omitempty"`
+	GitSHA       string    `json:"git_sha,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RecentDecisions fetches the most recent decisions, newest first. An empty
+// domain matches every domain.
+func RecentDecisions(ctx context.Context, pool *pgxpool.Pool, domain string, limit int) ([]Decision, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, agent_id, domain, decision, rationale, COALESCE(alternatives_considered, ''),
+		       risk_level, COALESCE(branch, ''), COALESCE(git_sha, ''), created_at
+		FROM decisions
+		WHERE $1 = '' OR domain = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, domain, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []Decision
+	for rows.Next() {
+		var d Decision
+		if err := rows.Scan(&d.ID, &d.AgentID, &d.Domain, &d.Decision, &d.Rationale, &d.Alternatives,
+			&d.RiskLevel, &d.Branch, &d.GitSHA, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
+
+// DecisionsInDomains fetches the most recent decisions in any of the given
+// domains, newest first.
+func DecisionsInDomains(ctx context.Context, pool *pgxpool.Pool, domains []string, limit int) ([]Decision, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, agent_id, domain, decision, rationale, COALESCE(alternatives_considered, ''),
+		       risk_level, COALESCE(branch, ''), COALESCE(git_sha, ''), created_at
+		FROM decisions
+		WHERE domain = ANY($1)
+		ORDER BY created_at DESC
+		LIMIT $2`, domains, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []Decision
+	for rows.Next() {
+		var d Decision
+		if err := rows.Scan(&d.ID, &d.AgentID, &d.Domain, &d.Decision, &d.Rationale, &d.Alternatives,
+			&d.RiskLevel, &d.Branch, &d.GitSHA, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		decisions = append(decisions, d)
+	}
+	return decisions, rows.Err()
+}
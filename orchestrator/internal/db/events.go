@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/pglisten"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OrchestratorConsumer is the orchestrator's name in event_consumers.
+const OrchestratorConsumer = "orchestrator"
+
+// Event is an entry of the events outbox. Channel names the notify trigger
+// that recorded it (task_updates, agent_messages, ...) and Payload is that
+// trigger's summary of the change. Old and New are the changed row before
+// and after, where the trigger records them.
+type Event struct {
+	Seq       int64
+	Channel   string
+	Payload   string
+	Old       json.RawMessage
+	New       json.RawMessage
+	CreatedAt time.Time
+}
+
+// StartEventStream sends outbox events the orchestrator has not yet
+// acknowledged to eventCh, in sequence order, and keeps following the outbox
+// until ctx is cancelled. Handled events must be acknowledged with AckEvent.
+// onReconnect, if not nil, is called whenever the LISTEN connection is
+// re-established.
+func StartEventStream(ctx context.Context, pool *pgxpool.Pool, connStr string, eventCh chan<- Event, onReconnect func()) error {
+	events := make(chan pglisten.Event)
+	go func() {
+		for e := range events {
+			eventCh <- Event{Seq: e.Seq, Channel: e.Channel, Payload: string(e.Payload),
+				Old: e.Old, New: e.New, CreatedAt: e.CreatedAt}
+		}
+	}()
+	defer close(events)
+
+	c := &pglisten.Consumer{Name: OrchestratorConsumer, Pool: pool, ConnString: connStr,
+		Logger: logging.For("pglisten"), OnReconnect: onReconnect}
+	return c.Run(ctx, events)
+}
+
+// AckEvent records that the orchestrator has handled every event up to seq.
+func AckEvent(ctx context.Context, pool *pgxpool.Pool, seq int64) error {
+	c := &pglisten.Consumer{Name: OrchestratorConsumer, Pool: pool}
+	return c.Ack(ctx, seq)
+}
+
+// ListEvents returns the last limit outbox events, oldest first, optionally
+// restricted to one entity type and ID.
+func ListEvents(ctx context.Context, pool *pgxpool.Pool, entity, entityID string, limit int) ([]pglisten.Event, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT * FROM (
+			SELECT seq, channel, event_type, entity, entity_id, old_value, new_value, payload, created_at
+			FROM events
+			WHERE ($1 = '' OR entity = $1) AND ($2 = '' OR entity_id = $2)
+			ORDER BY seq DESC
+			LIMIT $3
+		) recent ORDER BY seq`, entity, entityID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []pglisten.Event
+	for rows.Next() {
+		var e pglisten.Event
+		var oldValue, newValue, payload []byte
+		if err := rows.Scan(&e.Seq, &e.Channel, &e.EventType, &e.Entity, &e.EntityID,
+			&oldValue, &newValue, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Old, e.New, e.Payload = oldValue, newValue, payload
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
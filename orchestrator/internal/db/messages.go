@@ -2,25 +2,28 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Message represents a message from an agent.
 type Message struct {
-	ID      int64
-	AgentID string
-	Channel string
-	MsgType string
-	Content string
+	ID        int64     `json:"id"`
+	AgentID   string    `json:"agent_id"`
+	Channel   string    `json:"channel"`
+	MsgType   string    `json:"msg_type"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
-// RecentMessages fetches the most recent messages from a channel.
+// RecentMessages fetches the most recent messages from a channel, newest
+// first. An empty channel matches every channel.
 func RecentMessages(ctx context.Context, pool *pgxpool.Pool, channel string, limit int) ([]Message, error) {
 	rows, err := pool.Query(ctx, `
-		SELECT id, agent_id, channel, msg_type, content
+		SELECT id, agent_id, channel, msg_type, content, created_at
 		FROM messages
-		WHERE channel = $1
+		WHERE $1 = '' OR channel = $1
 		ORDER BY created_at DESC
 		LIMIT $2`, channel, limit)
 	if err != nil {
@@ -31,7 +34,7 @@ func RecentMessages(ctx context.Context, pool *pgxpool.Pool, channel string, lim
 	var msgs []Message
 	for rows.Next() {
 		var m Message
-		if err := rows.Scan(&m.ID, &m.AgentID, &m.Channel, &m.MsgType, &m.Content); err != nil {
+		if err := rows.Scan(&m.ID, &m.AgentID, &m.Channel, &m.MsgType, &m.Content, &m.CreatedAt); err != nil {
 			return nil, err
 		}
 		msgs = append(msgs, m)
@@ -39,6 +42,17 @@ func RecentMessages(ctx context.Context, pool *pgxpool.Pool, channel string, lim
 	return msgs, rows.Err()
 }
 
+// PostMessage posts a message on behalf of the orchestrator or a human.
+// refTaskID is zero if the message is not about a task.
+func PostMessage(ctx context.Context, pool *pgxpool.Pool, agentID, channel, msgType, content string, refTaskID int64) error {
+	_, err := pool.Exec(ctx,
+		`INSERT INTO messages (agent_id, channel, content, msg_type, ref_task_id)
+		 VALUES ($1, $2, $3, $4, NULLIF($5, 0))`,
+		agentID, channel, content, msgType, refTaskID,
+	)
+	return err
+}
+
 // GetMessageContent fetches the content of a single message by ID.
 func GetMessageContent(ctx context.Context, pool *pgxpool.Pool, messageID int64) (string, error) {
 	var content string
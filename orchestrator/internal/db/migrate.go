@@ -4,15 +4,17 @@ import (
 	"context"
 	"embed"
 	"fmt"
-	"log"
 	"net/url"
 	"sort"
 	"strings"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var logger = logging.For("db")
+
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
@@ -56,7 +58,7 @@ func EnsureDatabase(connStr string) error {
 		if err != nil {
 			return fmt.Errorf("create database %s: %w", targetDB, err)
 		}
-		log.Printf("created database %q", targetDB)
+		logger.Info("created database", "database", targetDB)
 	}
 
 	return nil
@@ -125,7 +127,7 @@ func RunMigrations(ctx context.Context, pool *pgxpool.Pool) error {
 			return fmt.Errorf("commit migration %s: %w", name, err)
 		}
 
-		log.Printf("applied migration: %s", name)
+		logger.Info("applied migration", "migration", name)
 	}
 
 	// Re-apply all triggers (idempotent via CREATE OR REPLACE + DROP TRIGGER IF EXISTS).
@@ -0,0 +1,15 @@
+ALTER TABLE agents DROP CONSTRAINT IF EXISTS agents_status_check;
+ALTER TABLE agents ADD CONSTRAINT agents_status_check CHECK (status IN ('starting', 'idle', 'working', 'blocked', 'paused', 'dead', 'stopped'));
+
+-- Active time on a task is NOW() - started_at minus the time its agent spent paused.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS started_at TIMESTAMPTZ NULL;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS paused_at TIMESTAMPTZ NULL;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS paused_seconds DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+-- Single-row table holding swarm-wide run state.
+CREATE TABLE IF NOT EXISTS swarm_state (
+    id          BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    paused      BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+INSERT INTO swarm_state (id) VALUES (TRUE) ON CONFLICT DO NOTHING;
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS events (
+    seq         BIGSERIAL PRIMARY KEY,
+    channel     VARCHAR(64) NOT NULL,
+    event_type  VARCHAR(64) NOT NULL,
+    entity      VARCHAR(32) NOT NULL,
+    entity_id   TEXT NOT NULL,
+    old_value   JSONB NULL,
+    new_value   JSONB NULL,
+    payload     JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_events_entity ON events(entity, entity_id, seq);
+
+CREATE TABLE IF NOT EXISTS event_consumers (
+    consumer    VARCHAR(64) PRIMARY KEY,
+    last_seq    BIGINT NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- record_event appends to the outbox and wakes consumers. The advisory lock
+-- serialises writers until commit, so sequence numbers become visible in
+-- order and a consumer reading seq > last_seq never skips a late commit.
+CREATE OR REPLACE FUNCTION record_event(
+    p_channel TEXT, p_event_type TEXT, p_entity TEXT, p_entity_id TEXT,
+    p_old JSONB, p_new JSONB, p_payload JSONB
+) RETURNS BIGINT AS $$
+DECLARE
+    v_seq BIGINT;
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('architect_events'));
+    INSERT INTO events (channel, event_type, entity, entity_id, old_value, new_value, payload)
+    VALUES (p_channel, p_event_type, p_entity, p_entity_id, p_old, p_new, p_payload)
+    RETURNING seq INTO v_seq;
+    PERFORM pg_notify('events', v_seq::text);
+    RETURN v_seq;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS mcp_servers JSONB NOT NULL DEFAULT '{}';
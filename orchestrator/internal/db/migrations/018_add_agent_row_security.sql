@@ -0,0 +1,53 @@
+-- Each agent logs in as its own role, architect_agent_<agent id with
+-- underscores>, a member of architect_agent (see db.CreateAgentRole).
+-- current_agent_id returns that agent's ID, or NULL for any other role.
+CREATE OR REPLACE FUNCTION current_agent_id() RETURNS TEXT AS $$
+    SELECT CASE WHEN current_user::text LIKE 'architect\_agent\_%'
+                THEN replace(substr(current_user::text, 17), '_', '-') END
+$$ LANGUAGE sql STABLE;
+
+-- Agents may read everything but only write their own rows. Other roles
+-- are unrestricted; the tables' owner bypasses these policies anyway.
+ALTER TABLE tasks ENABLE ROW LEVEL SECURITY;
+CREATE POLICY tasks_orchestrator ON tasks USING (current_agent_id() IS NULL);
+CREATE POLICY tasks_read ON tasks FOR SELECT USING (true);
+-- Claiming an unassigned task counts as writing one's own.
+CREATE POLICY tasks_agent_update ON tasks FOR UPDATE
+    USING (assigned_to IS NULL OR assigned_to = current_agent_id())
+    WITH CHECK (assigned_to = current_agent_id());
+
+ALTER TABLE messages ENABLE ROW LEVEL SECURITY;
+CREATE POLICY messages_orchestrator ON messages USING (current_agent_id() IS NULL);
+CREATE POLICY messages_read ON messages FOR SELECT USING (true);
+CREATE POLICY messages_agent_insert ON messages FOR INSERT
+    WITH CHECK (agent_id = current_agent_id());
+
+ALTER TABLE decisions ENABLE ROW LEVEL SECURITY;
+CREATE POLICY decisions_orchestrator ON decisions USING (current_agent_id() IS NULL);
+CREATE POLICY decisions_read ON decisions FOR SELECT USING (true);
+CREATE POLICY decisions_agent_insert ON decisions FOR INSERT
+    WITH CHECK (agent_id = current_agent_id());
+
+-- Context is shared: an agent may overwrite any key, and becomes its author.
+ALTER TABLE context ENABLE ROW LEVEL SECURITY;
+CREATE POLICY context_orchestrator ON context USING (current_agent_id() IS NULL);
+CREATE POLICY context_read ON context FOR SELECT USING (true);
+CREATE POLICY context_agent_insert ON context FOR INSERT
+    WITH CHECK (agent_id = current_agent_id());
+CREATE POLICY context_agent_update ON context FOR UPDATE
+    USING (true)
+    WITH CHECK (agent_id = current_agent_id());
+
+ALTER TABLE agents ENABLE ROW LEVEL SECURITY;
+CREATE POLICY agents_orchestrator ON agents USING (current_agent_id() IS NULL);
+CREATE POLICY agents_read ON agents FOR SELECT USING (true);
+CREATE POLICY agents_agent_insert ON agents FOR INSERT
+    WITH CHECK (agent_id = current_agent_id());
+CREATE POLICY agents_agent_update ON agents FOR UPDATE
+    USING (agent_id = current_agent_id())
+    WITH CHECK (agent_id = current_agent_id());
+
+-- Triggers on agent writes append to the events outbox, which agents have
+-- no privileges on; record_event runs as its owner instead.
+ALTER FUNCTION record_event(TEXT, TEXT, TEXT, TEXT, JSONB, JSONB, JSONB)
+    SECURITY DEFINER SET search_path = public, pg_temp;
@@ -0,0 +1,14 @@
+-- Plans proposed by decomposition, held for review before any task exists.
+-- proposed and approved are in the decomposition format, {"tasks": [...]};
+-- approved is the proposed plan or the reviewer's edit of it.
+CREATE TABLE IF NOT EXISTS plans (
+    id           BIGSERIAL PRIMARY KEY,
+    prompt       TEXT NOT NULL,
+    status       VARCHAR(32) NOT NULL DEFAULT 'pending_review' CHECK (status IN ('pending_review', 'approved', 'rejected')),
+    proposed     JSONB NOT NULL,
+    approved     JSONB NULL,
+    review_error TEXT NULL,
+    reviewed_by  VARCHAR(64) NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    reviewed_at  TIMESTAMPTZ NULL
+);
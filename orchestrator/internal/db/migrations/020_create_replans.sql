@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS replans (
+    id         BIGSERIAL PRIMARY KEY,
+    trigger    VARCHAR(32) NOT NULL CHECK (trigger IN ('task_failed', 'stuck')),
+    task_id    BIGINT NULL REFERENCES tasks(id),
+    diff       JSONB NULL,
+    error      TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,52 @@
+-- Advisory leases agents take on files they are editing, so others can see
+-- who is changing what. A lease is one agent's until it expires or is
+-- released; expired leases may be taken over by anyone.
+CREATE TABLE IF NOT EXISTS file_leases (
+    path        VARCHAR(512) PRIMARY KEY,
+    agent_id    VARCHAR(64) NOT NULL,
+    task_id     BIGINT NULL REFERENCES tasks(id),
+    reason      TEXT NULL,
+    acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at  TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_file_leases_agent ON file_leases(agent_id);
+CREATE INDEX IF NOT EXISTS idx_file_leases_task ON file_leases(task_id);
+
+ALTER TABLE file_leases ENABLE ROW LEVEL SECURITY;
+CREATE POLICY file_leases_orchestrator ON file_leases USING (current_agent_id() IS NULL);
+CREATE POLICY file_leases_read ON file_leases FOR SELECT USING (true);
+CREATE POLICY file_leases_agent_insert ON file_leases FOR INSERT
+    WITH CHECK (agent_id = current_agent_id());
+CREATE POLICY file_leases_agent_update ON file_leases FOR UPDATE
+    USING (agent_id = current_agent_id() OR expires_at <= NOW())
+    WITH CHECK (agent_id = current_agent_id());
+CREATE POLICY file_leases_agent_delete ON file_leases FOR DELETE
+    USING (agent_id = current_agent_id());
+
+-- Leases are released when their task finishes or their agent exits. Tasks
+-- are finished by agents too, so the release runs as the table's owner.
+CREATE OR REPLACE FUNCTION release_task_leases() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM file_leases WHERE task_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public, pg_temp;
+
+DROP TRIGGER IF EXISTS trg_task_release_leases ON tasks;
+CREATE TRIGGER trg_task_release_leases AFTER UPDATE ON tasks
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.status IN ('completed', 'failed', 'cancelled'))
+EXECUTE FUNCTION release_task_leases();
+
+CREATE OR REPLACE FUNCTION release_agent_leases() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM file_leases WHERE agent_id = NEW.agent_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public, pg_temp;
+
+DROP TRIGGER IF EXISTS trg_agent_release_leases ON agents;
+CREATE TRIGGER trg_agent_release_leases AFTER UPDATE ON agents
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.status IN ('dead', 'stopped'))
+EXECUTE FUNCTION release_agent_leases();
@@ -0,0 +1,18 @@
+-- Collisions between the committed changes of two running tasks' branches,
+-- found before either is merged. task_a is the lower task ID. kind is
+-- 'merge' if a trial merge fails, 'overlap' if the changes only touch the
+-- same lines. A conflict is resolved once the branches no longer collide or
+-- either task has finished.
+CREATE TABLE IF NOT EXISTS branch_conflicts (
+    id          BIGSERIAL PRIMARY KEY,
+    task_a      BIGINT NOT NULL REFERENCES tasks(id),
+    task_b      BIGINT NOT NULL REFERENCES tasks(id),
+    branch_a    VARCHAR(256) NOT NULL,
+    branch_b    VARCHAR(256) NOT NULL,
+    kind        VARCHAR(16) NOT NULL CHECK (kind IN ('overlap', 'merge')),
+    files       TEXT[] NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ NULL,
+    UNIQUE (task_a, task_b),
+    CHECK (task_a < task_b)
+);
@@ -0,0 +1,2 @@
+-- The status a paused agent had before its pause, restored when it resumes.
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS paused_from VARCHAR(16) NULL;
@@ -0,0 +1,5 @@
+-- A plan still awaiting review when its orchestrator stopped has no one
+-- left to run it; the next orchestrator marks it expired.
+ALTER TABLE plans DROP CONSTRAINT IF EXISTS plans_status_check;
+ALTER TABLE plans ADD CONSTRAINT plans_status_check
+    CHECK (status IN ('pending_review', 'approved', 'rejected', 'expired'));
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Plan is a decomposition held for review (see migration 019).
+type Plan struct {
+	ID          int64           `json:"id"`
+	Prompt      string          `json:"prompt"`
+	Status      string          `json:"status"`
+	Proposed    json.RawMessage `json:"proposed"`
+	Approved    json.RawMessage `json:"approved,omitempty"`
+	ReviewError string          `json:"review_error,omitempty"`
+	ReviewedBy  string          `json:"reviewed_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+const planColumns = `id, prompt, status, proposed, approved,
+	COALESCE(review_error, ''), COALESCE(reviewed_by, ''), created_at`
+
+func scanPlan(row interface{ Scan(...any) error }) (Plan, error) {
+	var p Plan
+	err := row.Scan(&p.ID, &p.Prompt, &p.Status, &p.Proposed, &p.Approved,
+		&p.ReviewError, &p.ReviewedBy, &p.CreatedAt)
+	return p, err
+}
+
+// CreatePlan stores a proposed plan awaiting review and returns its ID.
+func CreatePlan(ctx context.Context, pool *pgxpool.Pool, prompt string, proposed []byte) (int64, error) {
+	var id int64
+	err := pool.QueryRow(ctx,
+		`INSERT INTO plans (prompt, proposed) VALUES ($1, $2) RETURNING id`,
+		prompt, proposed,
+	).Scan(&id)
+	return id, err
+}
+
+// GetPlan fetches a plan by ID.
+func GetPlan(ctx context.Context, pool *pgxpool.Pool, id int64) (Plan, error) {
+	return scanPlan(pool.QueryRow(ctx, `SELECT `+planColumns+` FROM plans WHERE id = $1`, id))
+}
+
+// LatestPendingPlan returns the newest plan awaiting review.
+func LatestPendingPlan(ctx context.Context, pool *pgxpool.Pool) (Plan, error) {
+	return scanPlan(pool.QueryRow(ctx,
+		`SELECT `+planColumns+` FROM plans WHERE status = 'pending_review' ORDER BY id DESC LIMIT 1`))
+}
+
+// ReviewPlan approves or rejects a plan awaiting review. An approval with
+// edited set replaces the proposed plan. It reports false if the plan was
+// not awaiting review.
+func ReviewPlan(ctx context.Context, pool *pgxpool.Pool, id int64, approve bool, edited []byte, reviewedBy string) (bool, error) {
+	status := "rejected"
+	if approve {
+		status = "approved"
+	}
+	tag, err := pool.Exec(ctx,
+		`UPDATE plans
+		 SET status = $2,
+		     approved = CASE WHEN $2 = 'approved' THEN COALESCE($3::jsonb, proposed) END,
+		     review_error = NULL, reviewed_by = $4, reviewed_at = NOW()
+		 WHERE id = $1 AND status = 'pending_review'`,
+		id, status, edited, reviewedBy,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// ReturnPlan sends an approved plan the orchestrator cannot run back for
+// review, with the reason. The approved version becomes the proposal, so a
+// reviewer can fix their edit rather than start over.
+func ReturnPlan(ctx context.Context, pool *pgxpool.Pool, id int64, reason string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE plans
+		 SET status = 'pending_review', proposed = COALESCE(approved, proposed),
+		     approved = NULL, review_error = $2
+		 WHERE id = $1`,
+		id, reason,
+	)
+	return err
+}
+
+// ExpirePendingPlans marks every plan awaiting review as expired and
+// returns how many there were. It runs at startup: a pending plan is left
+// behind by an orchestrator that stopped before it was reviewed, and no
+// one would ever run it.
+func ExpirePendingPlans(ctx context.Context, pool *pgxpool.Pool) (int64, error) {
+	tag, err := pool.Exec(ctx,
+		`UPDATE plans SET status = 'expired', reviewed_at = NOW() WHERE status = 'pending_review'`)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// WaitPlanReview polls a plan until it is no longer awaiting review.
+func WaitPlanReview(ctx context.Context, pool *pgxpool.Pool, id int64) (Plan, error) {
+	for {
+		p, err := GetPlan(ctx, pool, id)
+		if err != nil || p.Status != "pending_review" {
+			return p, err
+		}
+		select {
+		case <-ctx.Done():
+			return p, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/dbtest"
+	"github.com/jackc/pgx/v5"
+)
+
+const proposed = `{"tasks": [{"id": 1, "title": "proposed"}]}`
+
+func TestPlanReview(t *testing.T) {
+	pool := dbtest.Open(t, "db")
+	ctx := context.Background()
+
+	id, err := db.CreatePlan(ctx, pool, "build it", []byte(proposed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := db.LatestPendingPlan(ctx, pool)
+	if err != nil || p.ID != id || p.Status != "pending_review" || p.Prompt != "build it" {
+		t.Fatalf("latest pending plan = %+v, %v", p, err)
+	}
+
+	edited := []byte(`{"tasks": [{"id": 1, "title": "edited"}]}`)
+	if ok, err := db.ReviewPlan(ctx, pool, id, true, edited, "test"); err != nil || !ok {
+		t.Fatalf("approve: %v, %v", ok, err)
+	}
+	p, err = db.GetPlan(ctx, pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != "approved" || p.ReviewedBy != "test" || !sameJSON(t, p.Approved, edited) {
+		t.Errorf("approved plan = %+v", p)
+	}
+	if ok, err := db.ReviewPlan(ctx, pool, id, false, nil, "test"); err != nil || ok {
+		t.Errorf("a reviewed plan should not be reviewed again: %v, %v", ok, err)
+	}
+
+	// A plan the orchestrator cannot run goes back with the reviewer's edit.
+	if err := db.ReturnPlan(ctx, pool, id, "task 1 has no risk level"); err != nil {
+		t.Fatal(err)
+	}
+	p, err = db.GetPlan(ctx, pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != "pending_review" || p.ReviewError != "task 1 has no risk level" ||
+		!sameJSON(t, p.Proposed, edited) || p.Approved != nil {
+		t.Errorf("returned plan = %+v", p)
+	}
+
+	if ok, err := db.ReviewPlan(ctx, pool, id, false, nil, "test"); err != nil || !ok {
+		t.Fatalf("reject: %v, %v", ok, err)
+	}
+	p, err = db.GetPlan(ctx, pool, id)
+	if err != nil || p.Status != "rejected" || p.Approved != nil || p.ReviewError != "" {
+		t.Errorf("rejected plan = %+v, %v", p, err)
+	}
+}
+
+func TestWaitPlanReview(t *testing.T) {
+	pool := dbtest.Open(t, "db")
+	ctx := context.Background()
+	id, err := db.CreatePlan(ctx, pool, "build it", []byte(proposed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go db.ReviewPlan(ctx, pool, id, true, nil, "test")
+	p, err := db.WaitPlanReview(ctx, pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Status != "approved" || !sameJSON(t, p.Approved, []byte(proposed)) {
+		t.Errorf("plan = %+v", p)
+	}
+}
+
+// A plan left awaiting review by a stopped orchestrator is expired at the
+// next start, and can no longer be approved.
+func TestExpirePendingPlans(t *testing.T) {
+	pool := dbtest.Open(t, "db")
+	ctx := context.Background()
+	rejected, err := db.CreatePlan(ctx, pool, "old", []byte(proposed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ReviewPlan(ctx, pool, rejected, false, nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := db.CreatePlan(ctx, pool, "left behind", []byte(proposed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := db.ExpirePendingPlans(ctx, pool); err != nil || n != 1 {
+		t.Fatalf("expired %d plans, %v; want 1", n, err)
+	}
+	for id, want := range map[int64]string{rejected: "rejected", pending: "expired"} {
+		if p, err := db.GetPlan(ctx, pool, id); err != nil || p.Status != want {
+			t.Errorf("plan %d: status %q, %v; want %q", id, p.Status, err, want)
+		}
+	}
+	if _, err := db.LatestPendingPlan(ctx, pool); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("expected no pending plan, got %v", err)
+	}
+	if ok, err := db.ReviewPlan(ctx, pool, pending, true, nil, "test"); err != nil || ok {
+		t.Errorf("an expired plan should not be approved: %v, %v", ok, err)
+	}
+}
+
+// sameJSON reports whether two JSON documents are equal, ignoring
+// formatting, as jsonb normalises it.
+func sameJSON(t *testing.T, a, b []byte) bool {
+	t.Helper()
+	var x, y any
+	if err := json.Unmarshal(a, &x); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &y); err != nil {
+		t.Fatal(err)
+	}
+	ax, _ := json.Marshal(x)
+	by, _ := json.Marshal(y)
+	return string(ax) == string(by)
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Replan is the record of one revision of the remaining plan: what
+// triggered it and the changes made, or why none were.
+type Replan struct {
+	ID      int64           `json:"id"`
+	Trigger string          `json:"trigger"`
+	TaskID  *int64          `json:"task_id,omitempty"`
+	Diff    json.RawMessage `json:"diff,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	// CreatedAt is when the revision was applied or given up on.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RecordReplan records a revision of the remaining plan. taskID is zero
+// unless a failed task triggered it; diff may be nil.
+func RecordReplan(ctx context.Context, pool *pgxpool.Pool, trigger string, taskID int64, diff any, reason string) error {
+	var diffJSON []byte
+	if diff != nil {
+		var err error
+		if diffJSON, err = json.Marshal(diff); err != nil {
+			return err
+		}
+	}
+	_, err := pool.Exec(ctx,
+		`INSERT INTO replans (trigger, task_id, diff, error)
+		 VALUES ($1, NULLIF($2, 0), $3, NULLIF($4, ''))`,
+		trigger, taskID, diffJSON, reason,
+	)
+	return err
+}
+
+// RecentReplans fetches the most recent revisions, newest first.
+func RecentReplans(ctx context.Context, pool *pgxpool.Pool, limit int) ([]Replan, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, trigger, task_id, diff, COALESCE(error, ''), created_at
+		FROM replans
+		ORDER BY id DESC
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var replans []Replan
+	for rows.Next() {
+		var r Replan
+		if err := rows.Scan(&r.ID, &r.Trigger, &r.TaskID, &r.Diff, &r.Error, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		replans = append(replans, r)
+	}
+	return replans, rows.Err()
+}
+
+// TasksStuck reports whether pending tasks remain but none is running and
+// none can start, because each waits on a task that will never complete.
+// Epics only ever wait on their children.
+func TasksStuck(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var stuck bool
+	err := pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM tasks WHERE status = 'pending')
+		   AND NOT EXISTS (SELECT 1 FROM tasks WHERE status IN ('in_progress', 'blocked'))
+		   AND NOT EXISTS (
+		       SELECT 1 FROM tasks t
+		       WHERE t.status = 'pending'
+		         AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = t.id)
+		         AND NOT EXISTS (
+		             SELECT 1 FROM task_blockers b
+		             JOIN tasks blocker ON b.blocker_id = blocker.id
+		             WHERE b.task_id = t.id
+		               AND blocker.status != 'completed'
+		         )
+		   )`,
+	).Scan(&stuck)
+	return stuck, err
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// agentRoleGroup is the role every agent's login role is a member of. The
+// row-level security policies (migration 018) recognise agents by the
+// agentRoleGroup + "_" prefix of their role names.
+const agentRoleGroup = "architect_agent"
+
+// agentGrants are the privileges the mcp-pg tools need. Row-level security
+// then limits writes to the agent's own rows.
+var agentGrants = []string{
+	`GRANT USAGE ON SCHEMA public TO architect_agent`,
+	`GRANT SELECT ON tasks, task_edges, messages, context, decisions, agents TO architect_agent`,
+	`GRANT UPDATE (status, output, assigned_to, updated_at) ON tasks TO architect_agent`,
+	`GRANT INSERT ON messages, decisions TO architect_agent`,
+	`GRANT INSERT, UPDATE ON context TO architect_agent`,
+	`GRANT INSERT (agent_id, pid, status, last_heartbeat), UPDATE (last_heartbeat) ON agents TO architect_agent`,
+	`GRANT SELECT, INSERT, UPDATE, DELETE ON file_leases TO architect_agent`,
+	`GRANT USAGE ON SEQUENCE messages_id_seq, context_id_seq, decisions_id_seq TO architect_agent`,
+}
+
+// SetupAgentRoles creates the agent group role and grants it what mcp-pg
+// needs. It reports false, changing nothing, if the database user may not
+// create roles.
+func SetupAgentRoles(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var canCreate bool
+	err := pool.QueryRow(ctx,
+		`SELECT rolsuper OR rolcreaterole FROM pg_roles WHERE rolname = current_user`,
+	).Scan(&canCreate)
+	if err != nil {
+		return false, fmt.Errorf("check role privileges: %w", err)
+	}
+	if !canCreate {
+		return false, nil
+	}
+
+	_, err = pool.Exec(ctx, `
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = 'architect_agent') THEN
+				CREATE ROLE architect_agent NOLOGIN;
+			END IF;
+		END
+		$$`)
+	if err != nil {
+		return false, fmt.Errorf("create role %s: %w", agentRoleGroup, err)
+	}
+	for _, grant := range agentGrants {
+		if _, err := pool.Exec(ctx, grant); err != nil {
+			return false, fmt.Errorf("%s: %w", grant, err)
+		}
+	}
+	return true, nil
+}
+
+// AgentRoleName returns the name of an agent's database role.
+func AgentRoleName(agentID string) string {
+	return agentRoleGroup + "_" + strings.ReplaceAll(agentID, "-", "_")
+}
+
+// CreateAgentRole creates a login role for one agent and returns its name
+// and a random password.
+func CreateAgentRole(ctx context.Context, pool *pgxpool.Pool, agentID string) (string, string, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	role, password := AgentRoleName(agentID), hex.EncodeToString(secret)
+
+	// Role statements take no parameters; the password is plain hex.
+	_, err := pool.Exec(ctx, fmt.Sprintf(`CREATE ROLE %s LOGIN PASSWORD '%s' IN ROLE %s`,
+		pgx.Identifier{role}.Sanitize(), password, agentRoleGroup))
+	if err != nil {
+		return "", "", fmt.Errorf("create role %s: %w", role, err)
+	}
+	return role, password, nil
+}
+
+// DropAgentRole disconnects an agent's remaining sessions and drops its role.
+func DropAgentRole(ctx context.Context, pool *pgxpool.Pool, agentID string) error {
+	return dropRole(ctx, pool, AgentRoleName(agentID))
+}
+
+// DropStaleAgentRoles drops the roles of agents from earlier runs, which
+// no longer have a process to serve, and returns how many it dropped.
+func DropStaleAgentRoles(ctx context.Context, pool *pgxpool.Pool) (int, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT r.rolname
+		 FROM pg_roles r
+		 JOIN pg_auth_members m ON m.member = r.oid
+		 JOIN pg_roles g ON g.oid = m.roleid
+		 WHERE g.rolname = $1`,
+		agentRoleGroup,
+	)
+	if err != nil {
+		return 0, err
+	}
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+	for _, role := range roles {
+		if err := dropRole(ctx, pool, role); err != nil {
+			return 0, err
+		}
+	}
+	return len(roles), nil
+}
+
+func dropRole(ctx context.Context, pool *pgxpool.Pool, role string) error {
+	// Dropping a role does not end its sessions. Terminating them needs
+	// privileges the orchestrator may lack, in which case the sessions
+	// linger until the agent's mcp-pg exits.
+	_, _ = pool.Exec(ctx,
+		`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE usename = $1`, role)
+	if _, err := pool.Exec(ctx, "DROP ROLE IF EXISTS "+pgx.Identifier{role}.Sanitize()); err != nil {
+		return fmt.Errorf("drop role %s: %w", role, err)
+	}
+	return nil
+}
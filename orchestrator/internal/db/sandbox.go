@@ -0,0 +1,16 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RecordSandboxViolation records that an agent's tool ran into the sandbox.
+func RecordSandboxViolation(ctx context.Context, pool *pgxpool.Pool, agentID string, taskID int64, detail string) error {
+	_, err := pool.Exec(ctx,
+		`INSERT INTO sandbox_violations (agent_id, task_id, detail) VALUES ($1, $2, $3)`,
+		agentID, taskID, detail,
+	)
+	return err
+}
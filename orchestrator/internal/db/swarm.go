@@ -0,0 +1,23 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SwarmPaused reports whether the whole swarm is paused.
+func SwarmPaused(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	var paused bool
+	err := pool.QueryRow(ctx, `SELECT paused FROM swarm_state`).Scan(&paused)
+	return paused, err
+}
+
+// SetSwarmPaused pauses or resumes the whole swarm.
+func SetSwarmPaused(ctx context.Context, pool *pgxpool.Pool, paused bool) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE swarm_state SET paused = $1, updated_at = NOW()`,
+		paused,
+	)
+	return err
+}
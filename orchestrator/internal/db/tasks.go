@@ -2,25 +2,126 @@ package db
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // InsertTask creates a new task in Postgres and returns the assigned ID.
 func InsertTask(ctx context.Context, pool *pgxpool.Pool, title, description, riskLevel string) (int64, error) {
+	return CreateTask(ctx, pool, NewTask{Title: title, Description: description, RiskLevel: riskLevel})
+}
+
+// NewTask holds the fields of a task to create.
+type NewTask struct {
+	Title       string
+	Description string
+	RiskLevel   string
+	// Priority orders ready tasks; higher runs first.
+	Priority           int
+	Domains            []string
+	AcceptanceCriteria []string
+	// PermissionProfile defaults to "default" when empty.
+	PermissionProfile string
+	// MCPServers are extra MCP servers for the task's agent.
+	MCPServers map[string]json.RawMessage
+	// FileScope lists the paths or globs the task expects to change.
+	FileScope    []string
+	AllowOverlap bool
+	// ParentID is the epic the task belongs to; zero for none.
+	ParentID int64
+}
+
+// CreateTask inserts a pending task and returns the assigned ID.
+func CreateTask(ctx context.Context, conn Conn, t NewTask) (int64, error) {
+	if t.Domains == nil {
+		t.Domains = []string{}
+	}
+	if t.AcceptanceCriteria == nil {
+		t.AcceptanceCriteria = []string{}
+	}
+	if t.MCPServers == nil {
+		t.MCPServers = map[string]json.RawMessage{}
+	}
+	if t.FileScope == nil {
+		t.FileScope = []string{}
+	}
 	var id int64
-	err := pool.QueryRow(ctx,
-		`INSERT INTO tasks (title, description, risk_level, status)
-		 VALUES ($1, $2, $3, 'pending')
+	err := conn.QueryRow(ctx,
+		`INSERT INTO tasks (title, description, risk_level, priority, domains, acceptance_criteria, permission_profile, mcp_servers,
+		                    file_scope, allow_overlap, parent_id, status)
+		 VALUES ($1, $2, $3, $4, $5, $6, COALESCE(NULLIF($7, ''), 'default'), $8, $9, $10, NULLIF($11, 0), 'pending')
 		 RETURNING id`,
-		title, description, riskLevel,
+		t.Title, t.Description, t.RiskLevel, t.Priority, t.Domains, t.AcceptanceCriteria, t.PermissionProfile, t.MCPServers,
+		t.FileScope, t.AllowOverlap, t.ParentID,
 	).Scan(&id)
 	return id, err
 }
 
+// TaskInfo is the orchestrator's view of a task row.
+type TaskInfo struct {
+	ID          int64   `json:"id"`
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	Status      string  `json:"status"`
+	AssignedTo  *string `json:"assigned_to"`
+	RiskLevel   string  `json:"risk_level"`
+	Priority    int     `json:"priority"`
+	Branch      string  `json:"branch,omitempty"`
+	// ParentID is the epic the task belongs to.
+	ParentID *int64 `json:"parent_id,omitempty"`
+	// Epic is set on tasks that other tasks belong to.
+	Epic bool `json:"epic,omitempty"`
+	// FailureReason is set when the orchestrator failed the task (see FailTask).
+	FailureReason string    `json:"failure_reason,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+const taskInfoColumns = `id, title, description, status, assigned_to, risk_level, priority,
+	COALESCE(branch, ''), parent_id, EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = tasks.id),
+	COALESCE(failure_reason, ''), updated_at`
+
+func scanTaskInfo(row pgx.Row) (TaskInfo, error) {
+	var t TaskInfo
+	err := row.Scan(&t.ID, &t.Title, &t.Description, &t.Status, &t.AssignedTo,
+		&t.RiskLevel, &t.Priority, &t.Branch, &t.ParentID, &t.Epic, &t.FailureReason, &t.UpdatedAt)
+	return t, err
+}
+
+// GetTask fetches a task by ID.
+func GetTask(ctx context.Context, pool *pgxpool.Pool, taskID int64) (TaskInfo, error) {
+	return scanTaskInfo(pool.QueryRow(ctx,
+		`SELECT `+taskInfoColumns+` FROM tasks WHERE id = $1`, taskID))
+}
+
+// ListTasks returns all tasks ordered by ID, or only those with the given
+// status if status is non-empty.
+func ListTasks(ctx context.Context, pool *pgxpool.Pool, status string) ([]TaskInfo, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+taskInfoColumns+` FROM tasks
+		 WHERE $1 = '' OR status = $1
+		 ORDER BY id`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TaskInfo
+	for rows.Next() {
+		t, err := scanTaskInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
 // InsertEdge creates a dependency edge between two tasks.
-func InsertEdge(ctx context.Context, pool *pgxpool.Pool, fromTask, toTask int64) error {
-	_, err := pool.Exec(ctx,
+func InsertEdge(ctx context.Context, conn Conn, fromTask, toTask int64) error {
+	_, err := conn.Exec(ctx,
 		`INSERT INTO task_edges (from_task, to_task, edge_type) VALUES ($1, $2, 'blocks')`,
 		fromTask, toTask,
 	)
@@ -30,7 +131,8 @@ func InsertEdge(ctx context.Context, pool *pgxpool.Pool, fromTask, toTask int64)
 // ClaimTask atomically assigns a task to an agent, returning false if already claimed.
 func ClaimTask(ctx context.Context, pool *pgxpool.Pool, taskID int64, status string, agentID string) (bool, error) {
 	tag, err := pool.Exec(ctx,
-		`UPDATE tasks SET status = $1, assigned_to = $2
+		`UPDATE tasks SET status = $1, assigned_to = $2,
+		        started_at = NOW(), paused_at = NULL, paused_seconds = 0
 		 WHERE id = $3 AND assigned_to IS NULL`,
 		status, agentID, taskID,
 	)
@@ -59,18 +161,316 @@ func CompleteTask(ctx context.Context, pool *pgxpool.Pool, taskID int64, agentID
 	return err
 }
 
-// ParentBranches returns the worktree_path values of agents that completed
-// the direct dependencies (blocking tasks) of the given task.
+// Task failure reasons, recorded in tasks.failure_reason when the
+// orchestrator (rather than the agent) fails a task.
+const (
+	FailureExit        = "exit"         // the agent exited with an error
+	FailureTimeout     = "timeout"      // see TimeOutTask
+	FailureMemoryLimit = "memory_limit" // killed for exceeding its memory limit
+	FailurePidsLimit   = "pids_limit"   // ran out of processes
+)
+
+// FailTask marks a task as failed by its assigned agent. A non-empty
+// detail replaces the task's output.
+func FailTask(ctx context.Context, pool *pgxpool.Pool, taskID int64, agentID, reason, detail string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET status = 'failed', failure_reason = $3,
+		     output = COALESCE(NULLIF($4, ''), output), updated_at = NOW()
+		 WHERE id = $1 AND assigned_to = $2`,
+		taskID, agentID, reason, detail,
+	)
+	return err
+}
+
+// MarkTaskPaused starts the pause clock of a task whose agent was paused.
+func MarkTaskPaused(ctx context.Context, pool *pgxpool.Pool, taskID int64) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET paused_at = NOW() WHERE id = $1 AND paused_at IS NULL`,
+		taskID,
+	)
+	return err
+}
+
+// MarkTaskResumed stops the pause clock, adding the paused time to the task's total.
+func MarkTaskResumed(ctx context.Context, pool *pgxpool.Pool, taskID int64) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks
+		 SET paused_seconds = paused_seconds + EXTRACT(EPOCH FROM NOW() - paused_at),
+		     paused_at = NULL
+		 WHERE id = $1 AND paused_at IS NOT NULL`,
+		taskID,
+	)
+	return err
+}
+
+// CancelTask marks an unfinished task cancelled.
+func CancelTask(ctx context.Context, conn Conn, taskID int64) error {
+	_, err := conn.Exec(ctx,
+		`UPDATE tasks SET status = 'cancelled', updated_at = NOW()
+		 WHERE id = $1 AND status NOT IN ('completed', 'failed', 'cancelled')`,
+		taskID,
+	)
+	return err
+}
+
+// CancelDependents cancels the pending tasks that wait on taskID through
+// blocking edges, directly or through other tasks cancelled here, and
+// returns their IDs. A cancelled task never completes, so they could
+// never start. An epic whose tasks are all cancelled is cancelled with
+// them, and what waits on it is cancelled in turn.
+func CancelDependents(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]int64, error) {
+	var cancelled []int64
+	frontier := []int64{taskID}
+	for len(frontier) > 0 {
+		rows, err := pool.Query(ctx,
+			`UPDATE tasks t SET status = 'cancelled', updated_at = NOW()
+			 WHERE t.status = 'pending'
+			   AND NOT EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = t.id)
+			   AND t.id IN (SELECT task_id FROM task_blockers WHERE blocker_id = ANY($1))
+			 RETURNING t.id`,
+			frontier,
+		)
+		if err != nil {
+			return cancelled, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil || len(ids) == 0 {
+			return cancelled, err
+		}
+		cancelled = append(cancelled, ids...)
+
+		rows, err = pool.Query(ctx,
+			`SELECT DISTINCT e.id FROM tasks e
+			 JOIN tasks c ON c.parent_id = e.id
+			 WHERE c.id = ANY($1) AND e.status = 'cancelled'`,
+			ids,
+		)
+		if err != nil {
+			return cancelled, err
+		}
+		epics, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+		if err != nil {
+			return cancelled, err
+		}
+		frontier = append(ids, epics...)
+	}
+	return cancelled, nil
+}
+
+// RetryTask returns a failed or cancelled task to pending so it is scheduled again.
+func RetryTask(ctx context.Context, pool *pgxpool.Pool, taskID int64) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET status = 'pending', assigned_to = NULL, output = NULL, failure_reason = NULL, updated_at = NOW()
+		 WHERE id = $1 AND status IN ('failed', 'cancelled')`,
+		taskID,
+	)
+	return err
+}
+
+// UpdateTaskFields changes a task's editable fields; nil fields are left as they are.
+func UpdateTaskFields(ctx context.Context, conn Conn, taskID int64, title, description, riskLevel *string, priority *int) error {
+	_, err := conn.Exec(ctx,
+		`UPDATE tasks
+		 SET title = COALESCE($1, title),
+		     description = COALESCE($2, description),
+		     risk_level = COALESCE($3, risk_level),
+		     priority = COALESCE($4, priority),
+		     updated_at = NOW()
+		 WHERE id = $5`,
+		title, description, riskLevel, priority, taskID,
+	)
+	return err
+}
+
+// InsertTypedEdge creates an edge of the given type between two tasks.
+func InsertTypedEdge(ctx context.Context, pool *pgxpool.Pool, fromTask, toTask int64, edgeType string) error {
+	_, err := pool.Exec(ctx,
+		`INSERT INTO task_edges (from_task, to_task, edge_type) VALUES ($1, $2, $3)`,
+		fromTask, toTask, edgeType,
+	)
+	return err
+}
+
+// DeleteEdge removes the edge between two tasks, returning false if there was none.
+func DeleteEdge(ctx context.Context, conn Conn, fromTask, toTask int64) (bool, error) {
+	tag, err := conn.Exec(ctx,
+		`DELETE FROM task_edges WHERE from_task = $1 AND to_task = $2`,
+		fromTask, toTask,
+	)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// EdgeCreatesCycle reports whether adding fromTask → toTask would create a
+// cycle, i.e. whether fromTask is already reachable from toTask or, if
+// toTask is an epic, from one of its children. Edges into an epic reach its
+// children, and an epic is reached from each of its children.
+func EdgeCreatesCycle(ctx context.Context, pool *pgxpool.Pool, fromTask, toTask int64) (bool, error) {
+	var cycle bool
+	err := pool.QueryRow(ctx, `
+		WITH RECURSIVE waits(from_id, to_id) AS (
+			SELECT from_task, to_task FROM task_edges
+			UNION ALL
+			SELECT e.from_task, c.id FROM task_edges e JOIN tasks c ON c.parent_id = e.to_task
+			UNION ALL
+			SELECT id, parent_id FROM tasks WHERE parent_id IS NOT NULL
+		), reachable(id) AS (
+			SELECT $2::bigint
+			UNION
+			SELECT id FROM tasks WHERE parent_id = $2
+			UNION
+			SELECT w.to_id FROM waits w JOIN reachable r ON w.from_id = r.id
+		)
+		SELECT EXISTS(SELECT 1 FROM reachable WHERE id = $1)`,
+		fromTask, toTask,
+	).Scan(&cycle)
+	return cycle, err
+}
+
+// ChildTasks returns the tasks of an epic ordered by ID.
+func ChildTasks(ctx context.Context, pool *pgxpool.Pool, epicID int64) ([]TaskInfo, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT `+taskInfoColumns+` FROM tasks
+		 WHERE parent_id = $1
+		 ORDER BY id`, epicID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TaskInfo
+	for rows.Next() {
+		t, err := scanTaskInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// TaskStatus returns the current status of a task.
+func TaskStatus(ctx context.Context, pool *pgxpool.Pool, taskID int64) (string, error) {
+	var status string
+	err := pool.QueryRow(ctx, `SELECT status FROM tasks WHERE id = $1`, taskID).Scan(&status)
+	return status, err
+}
+
+// IsTerminalStatus reports whether a task status means no further work will happen.
+func IsTerminalStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+// SetTaskBranch records the git branch a task's work lives on.
+func SetTaskBranch(ctx context.Context, pool *pgxpool.Pool, taskID int64, branch string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET branch = $1 WHERE id = $2`,
+		branch, taskID,
+	)
+	return err
+}
+
+// SetTaskBase records the commit a task's work started from, against which
+// its changed files are measured.
+func SetTaskBase(ctx context.Context, pool *pgxpool.Pool, taskID int64, sha string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET base_sha = $1 WHERE id = $2`,
+		sha, taskID,
+	)
+	return err
+}
+
+// ScopedTask is a task in progress that declared a file scope.
+type ScopedTask struct {
+	ID           int64
+	AgentID      string
+	WorktreePath string
+	BaseSHA      string
+	FileScope    []string
+}
+
+// ScopedTasks returns the tasks in progress that have a file scope and a
+// recorded base commit, with the worktree of the agent working on each.
+func ScopedTasks(ctx context.Context, pool *pgxpool.Pool) ([]ScopedTask, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT t.id, t.assigned_to, a.worktree_path, t.base_sha, t.file_scope
+		 FROM tasks t
+		 JOIN agents a ON a.agent_id = t.assigned_to
+		 WHERE t.status = 'in_progress'
+		   AND cardinality(t.file_scope) > 0
+		   AND t.base_sha IS NOT NULL
+		   AND a.worktree_path IS NOT NULL
+		 ORDER BY t.id`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []ScopedTask
+	for rows.Next() {
+		var t ScopedTask
+		if err := rows.Scan(&t.ID, &t.AgentID, &t.WorktreePath, &t.BaseSHA, &t.FileScope); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// ParentBranches returns the branches of the completed direct dependencies
+// (blocking tasks) of the given task and of its epic. A blocking epic stands
+// for the branches of its children.
 func ParentBranches(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]string, error) {
 	rows, err := pool.Query(ctx,
-		`SELECT DISTINCT a.worktree_path
+		`SELECT DISTINCT t.id, t.branch
+		 FROM task_blockers b
+		 JOIN tasks blocker ON blocker.id = b.blocker_id
+		 JOIN tasks t ON t.id = blocker.id OR t.parent_id = blocker.id
+		 WHERE b.task_id = $1
+		   AND blocker.status = 'completed'
+		   AND t.status = 'completed'
+		   AND t.branch IS NOT NULL
+		 ORDER BY t.id`,
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var branches []string
+	for rows.Next() {
+		var id int64
+		var b string
+		if err := rows.Scan(&id, &b); err != nil {
+			return nil, err
+		}
+		branches = append(branches, b)
+	}
+	return branches, rows.Err()
+}
+
+// UpstreamTask is a direct dependency of a task, with what it produced.
+type UpstreamTask struct {
+	ID       int64
+	Title    string
+	Status   string
+	EdgeType string
+	Output   string
+	Branch   string
+}
+
+// UpstreamTasks returns the direct dependencies of a task, blocking or informing.
+func UpstreamTasks(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]UpstreamTask, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT t.id, t.title, t.status, e.edge_type, COALESCE(t.output, ''), COALESCE(t.branch, '')
 		 FROM task_edges e
 		 JOIN tasks t ON e.from_task = t.id
-		 JOIN agents a ON t.assigned_to = a.agent_id
 		 WHERE e.to_task = $1
-		   AND e.edge_type = 'blocks'
-		   AND t.status = 'completed'
-		   AND a.worktree_path IS NOT NULL`,
+		 ORDER BY t.id`,
 		taskID,
 	)
 	if err != nil {
@@ -78,15 +478,61 @@ func ParentBranches(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]st
 	}
 	defer rows.Close()
 
-	var paths []string
+	var tasks []UpstreamTask
 	for rows.Next() {
-		var p string
-		if err := rows.Scan(&p); err != nil {
+		var t UpstreamTask
+		if err := rows.Scan(&t.ID, &t.Title, &t.Status, &t.EdgeType, &t.Output, &t.Branch); err != nil {
 			return nil, err
 		}
-		paths = append(paths, p)
+		tasks = append(tasks, t)
 	}
-	return paths, rows.Err()
+	return tasks, rows.Err()
+}
+
+// SiblingTask is another task being worked on at the same time.
+type SiblingTask struct {
+	ID         int64
+	Title      string
+	AssignedTo string
+	Branch     string
+	Domains    []string
+}
+
+// SiblingTasks returns the tasks in progress other than taskID, leaving out
+// epics, which no agent works on.
+func SiblingTasks(ctx context.Context, pool *pgxpool.Pool, taskID int64) ([]SiblingTask, error) {
+	rows, err := pool.Query(ctx,
+		`SELECT id, title, COALESCE(assigned_to, ''), COALESCE(branch, ''), domains
+		 FROM tasks
+		 WHERE status = 'in_progress' AND id != $1 AND assigned_to IS NOT NULL
+		 ORDER BY id`,
+		taskID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []SiblingTask
+	for rows.Next() {
+		var t SiblingTask
+		if err := rows.Scan(&t.ID, &t.Title, &t.AssignedTo, &t.Branch, &t.Domains); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// ResetTaskForResume returns an interrupted task to pending, keeping its branch
+// so the next agent can pick up the work-in-progress, and records a note for it.
+func ResetTaskForResume(ctx context.Context, pool *pgxpool.Pool, taskID int64, note string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET status = 'pending', assigned_to = NULL, resume_note = $1, updated_at = NOW()
+		 WHERE id = $2`,
+		note, taskID,
+	)
+	return err
 }
 
 // ReclaimTask resets a task to pending and clears its assignment.
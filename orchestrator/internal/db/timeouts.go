@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TimedOutTask is an in-progress task that has run longer than allowed.
+type TimedOutTask struct {
+	ID         int64
+	AssignedTo string
+}
+
+// TimedOutTasks returns in-progress tasks whose active time, excluding time
+// spent paused, exceeds timeout.
+func TimedOutTasks(ctx context.Context, pool *pgxpool.Pool, timeout time.Duration) ([]TimedOutTask, error) {
+	rows, err := pool.Query(ctx, `
+		SELECT id, assigned_to
+		FROM tasks
+		WHERE status = 'in_progress'
+		  AND assigned_to IS NOT NULL
+		  AND started_at IS NOT NULL
+		  AND paused_at IS NULL
+		  AND EXTRACT(EPOCH FROM NOW() - started_at) - paused_seconds > $1
+		ORDER BY id`, timeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TimedOutTask
+	for rows.Next() {
+		var t TimedOutTask
+		if err := rows.Scan(&t.ID, &t.AssignedTo); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// TimeOutTask fails an in-progress task, recording why in its output.
+func TimeOutTask(ctx context.Context, pool *pgxpool.Pool, taskID int64, reason string) error {
+	_, err := pool.Exec(ctx,
+		`UPDATE tasks SET status = 'failed', failure_reason = 'timeout', output = $1, updated_at = NOW()
+		 WHERE id = $2 AND status = 'in_progress'`,
+		reason, taskID,
+	)
+	return err
+}
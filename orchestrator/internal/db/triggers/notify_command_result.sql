@@ -0,0 +1,21 @@
+CREATE OR REPLACE FUNCTION notify_command_result() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM record_event(
+        'command_results',
+        'command_result.' || lower(TG_OP),
+        'command_result',
+        (NEW.command_id)::text,
+        NULL,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'command_id', NEW.command_id,
+            'applied', NEW.applied,
+            'reason', NEW.reason
+        )
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_command_result_notify ON command_results;
+CREATE TRIGGER trg_command_result_notify AFTER INSERT ON command_results FOR EACH ROW EXECUTE FUNCTION notify_command_result();
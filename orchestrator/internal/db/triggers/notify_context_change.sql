@@ -1,10 +1,18 @@
 CREATE OR REPLACE FUNCTION notify_context_change() RETURNS TRIGGER AS $$
 BEGIN
-    PERFORM pg_notify('context_updates', json_build_object(
-        'domain', NEW.domain,
-        'key_name', NEW.key_name,
-        'agent_id', NEW.agent_id
-    )::text);
+    PERFORM record_event(
+        'context_updates',
+        'context.' || lower(TG_OP),
+        'context',
+        (NEW.id)::text,
+        CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'domain', NEW.domain,
+            'key_name', NEW.key_name,
+            'agent_id', NEW.agent_id
+        )
+    );
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
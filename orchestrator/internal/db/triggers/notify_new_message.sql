@@ -1,11 +1,19 @@
 CREATE OR REPLACE FUNCTION notify_new_message() RETURNS TRIGGER AS $$
 BEGIN
-    PERFORM pg_notify('agent_messages', json_build_object(
-        'id', NEW.id,
-        'agent_id', NEW.agent_id,
-        'channel', NEW.channel,
-        'msg_type', NEW.msg_type
-    )::text);
+    PERFORM record_event(
+        'agent_messages',
+        'message.' || lower(TG_OP),
+        'message',
+        (NEW.id)::text,
+        NULL,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'id', NEW.id,
+            'agent_id', NEW.agent_id,
+            'channel', NEW.channel,
+            'msg_type', NEW.msg_type
+        )
+    );
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
@@ -0,0 +1,20 @@
+CREATE OR REPLACE FUNCTION notify_orchestrator_command() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM record_event(
+        'orchestrator_commands',
+        'command.' || lower(TG_OP),
+        'command',
+        (NEW.id)::text,
+        NULL,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'id', NEW.id,
+            'command', NEW.command
+        )
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_orchestrator_command_notify ON orchestrator_commands;
+CREATE TRIGGER trg_orchestrator_command_notify AFTER INSERT ON orchestrator_commands FOR EACH ROW EXECUTE FUNCTION notify_orchestrator_command();
@@ -0,0 +1,22 @@
+CREATE OR REPLACE FUNCTION notify_sandbox_violation() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM record_event(
+        'sandbox_violations',
+        'sandbox_violation.' || lower(TG_OP),
+        'sandbox_violation',
+        (NEW.id)::text,
+        NULL,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'id', NEW.id,
+            'agent_id', NEW.agent_id,
+            'task_id', NEW.task_id,
+            'detail', NEW.detail
+        )
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_sandbox_violation_notify ON sandbox_violations;
+CREATE TRIGGER trg_sandbox_violation_notify AFTER INSERT ON sandbox_violations FOR EACH ROW EXECUTE FUNCTION notify_sandbox_violation();
@@ -0,0 +1,54 @@
+// Package dbtest gives tests a migrated, empty Postgres database. Tests
+// that need one are skipped unless TEST_DATABASE_URL is set.
+package dbtest
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Open returns a pool on the database named by TEST_DATABASE_URL with
+// suffix appended to its name, migrated and emptied. Each package passes
+// its own suffix, so packages tested in parallel do not empty each
+// other's tables.
+func Open(t *testing.T, suffix string) *pgxpool.Pool {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	u.Path += "_" + suffix
+	return Reset(context.Background(), t, u.String())
+}
+
+// Reset migrates the database at dbURL, creating it if needed, and empties
+// its tables as schema/clean.sh does.
+func Reset(ctx context.Context, t *testing.T, dbURL string) *pgxpool.Pool {
+	t.Helper()
+	if err := db.EnsureDatabase(dbURL); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := db.NewPool(ctx, dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if err := db.RunMigrations(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Exec(ctx, `TRUNCATE events, event_consumers, branch_conflicts, file_leases, replans, plans,
+		sandbox_violations, command_results, orchestrator_commands, task_edges, messages, context, decisions,
+		agents, tasks RESTART IDENTITY CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
@@ -0,0 +1,217 @@
+package gc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var logger = logging.For("gc")
+
+// Options controls which worktrees are collected.
+type Options struct {
+	// DryRun reports what would be removed without touching anything.
+	DryRun bool
+	// KeepFailed is how long worktrees of failed tasks or dead agents are kept
+	// for inspection after the agent finished.
+	KeepFailed time.Duration
+	// KeepUnmerged keeps worktrees whose branch has commits not on the base branch.
+	KeepUnmerged bool
+}
+
+// Result describes what happened (or would happen) to one agent's worktree.
+type Result struct {
+	AgentID      string
+	WorktreePath string
+	Branches     []string
+	Removed      bool
+	Reason       string
+}
+
+// activeStatuses are agent statuses whose process may still be using the worktree.
+var activeStatuses = map[string]bool{
+	"starting": true,
+	"working":  true,
+	"blocked":  true,
+	"paused":   true,
+}
+
+// Decide applies the retention policy to a single agent worktree.
+// ahead is the number of commits on the agent's branches that are not on the base branch.
+func Decide(w db.AgentWorktree, ahead int, now time.Time, opts Options) (bool, string) {
+	if activeStatuses[w.Status] {
+		return false, "agent is " + w.Status
+	}
+	// An idle agent whose session is still open may be handed another task.
+	if w.Status == "idle" && w.FinishedAt == nil {
+		return false, "agent is idle and may be reused"
+	}
+	if w.HasPendingDependents {
+		return false, "pending tasks build on this branch"
+	}
+	if opts.KeepUnmerged && ahead > 0 {
+		return false, fmt.Sprintf("%d unmerged commit(s)", ahead)
+	}
+
+	taskStatus := ""
+	if w.TaskStatus != nil {
+		taskStatus = *w.TaskStatus
+	}
+	failed := w.Status == "dead" || taskStatus == "failed"
+	if failed {
+		finished := w.StartedAt
+		if w.FinishedAt != nil {
+			finished = *w.FinishedAt
+		}
+		if age := now.Sub(finished); age < opts.KeepFailed {
+			return false, fmt.Sprintf("failed %s ago, kept for %s", age.Round(time.Minute), opts.KeepFailed)
+		}
+	}
+
+	switch {
+	case taskStatus == "cancelled":
+		return true, "cancelled"
+	case failed:
+		return true, "failed, past retention"
+	case ahead == 0 && taskStatus == "completed":
+		return true, "merged"
+	default:
+		return true, "agent " + w.Status
+	}
+}
+
+// Run collects worktrees and branches of finished agents under projectDir,
+// archiving each agent.log before removal, then prunes stale worktree metadata.
+func Run(ctx context.Context, pool *pgxpool.Pool, projectDir string, opts Options) ([]Result, error) {
+	worktrees, err := db.ListAgentWorktrees(ctx, pool)
+	if err != nil {
+		return nil, fmt.Errorf("list agent worktrees: %w", err)
+	}
+
+	base := spawn.DefaultBranch(projectDir)
+	now := time.Now()
+
+	var results []Result
+	for _, w := range worktrees {
+		r := Result{AgentID: w.AgentID, WorktreePath: w.WorktreePath}
+
+		ahead, err := commitsAhead(projectDir, base, w.Branches)
+		if err != nil {
+			logger.Warn("gc: cannot compare branches", logging.AgentID, w.AgentID, "err", err)
+			r.Reason = "cannot compare with " + base
+			results = append(results, r)
+			continue
+		}
+		for _, b := range w.Branches {
+			if spawn.BranchExists(projectDir, b) {
+				r.Branches = append(r.Branches, b)
+			}
+		}
+
+		remove, reason := Decide(w, ahead, now, opts)
+		r.Reason = reason
+		if !remove || opts.DryRun {
+			r.Removed = remove
+			results = append(results, r)
+			continue
+		}
+
+		if err := removeAgent(ctx, pool, projectDir, w, r.Branches); err != nil {
+			logger.Warn("gc: failed to remove agent", logging.AgentID, w.AgentID, "err", err)
+			r.Reason = err.Error()
+			results = append(results, r)
+			continue
+		}
+		r.Removed = true
+		results = append(results, r)
+	}
+
+	if !opts.DryRun {
+		if err := spawn.PruneWorktrees(projectDir); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// commitsAhead sums the commits on each existing branch that base does not have.
+// Commits shared between an agent's successive branches are counted once per
+// branch, which is fine since only zero versus non-zero matters.
+func commitsAhead(projectDir string, base string, branches []string) (int, error) {
+	total := 0
+	for _, b := range branches {
+		if !spawn.BranchExists(projectDir, b) {
+			continue
+		}
+		n, err := spawn.CommitsAhead(projectDir, base, b)
+		if err != nil {
+			return 0, fmt.Errorf("compare %s with %s: %w", b, base, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// removeAgent archives the agent's logs, then deletes its worktree and branches.
+func removeAgent(ctx context.Context, pool *pgxpool.Pool, projectDir string, w db.AgentWorktree, branches []string) error {
+	if _, err := os.Stat(w.WorktreePath); err == nil {
+		if err := archiveLog(filepath.Join(w.WorktreePath, "agent.log"), ArchivePath(projectDir, w.AgentID)); err != nil {
+			return fmt.Errorf("archive agent.log: %w", err)
+		}
+		if err := archiveLog(filepath.Join(w.WorktreePath, spawn.MCPLogFile), MCPLogArchivePath(projectDir, w.AgentID)); err != nil {
+			return fmt.Errorf("archive %s: %w", spawn.MCPLogFile, err)
+		}
+		if err := spawn.RemoveWorktree(projectDir, w.WorktreePath); err != nil {
+			return err
+		}
+	}
+	for _, b := range branches {
+		if err := spawn.DeleteBranch(projectDir, b); err != nil {
+			return err
+		}
+	}
+	return db.ClearAgentWorktree(ctx, pool, w.AgentID)
+}
+
+// ArchivePath returns where an agent's log is kept after its worktree is removed.
+func ArchivePath(projectDir string, agentID string) string {
+	return filepath.Join(projectDir, ".worktrees", "logs", agentID+".log")
+}
+
+// MCPLogArchivePath returns where an agent's mcp-pg log is kept after its
+// worktree is removed.
+func MCPLogArchivePath(projectDir string, agentID string) string {
+	return filepath.Join(projectDir, ".worktrees", "logs", agentID+"."+spawn.MCPLogFile)
+}
+
+func archiveLog(srcPath, dst string) error {
+	src, err := os.Open(srcPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
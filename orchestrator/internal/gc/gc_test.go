@@ -0,0 +1,47 @@
+package gc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestDecide(t *testing.T) {
+	now := time.Now()
+	recent := now.Add(-time.Hour)
+	old := now.Add(-30 * 24 * time.Hour)
+	opts := Options{KeepFailed: 7 * 24 * time.Hour, KeepUnmerged: true}
+
+	tests := []struct {
+		name   string
+		w      db.AgentWorktree
+		ahead  int
+		remove bool
+	}{
+		{"working agent", db.AgentWorktree{Status: "working", TaskStatus: strPtr("in_progress")}, 0, false},
+		{"idle live agent", db.AgentWorktree{Status: "idle", TaskStatus: strPtr("completed")}, 0, false},
+		{"merged", db.AgentWorktree{Status: "idle", TaskStatus: strPtr("completed"), FinishedAt: &recent}, 0, true},
+		{"unmerged commits", db.AgentWorktree{Status: "idle", TaskStatus: strPtr("completed"), FinishedAt: &old}, 3, false},
+		{"pending dependents", db.AgentWorktree{Status: "idle", TaskStatus: strPtr("completed"), FinishedAt: &recent, HasPendingDependents: true}, 0, false},
+		{"recently failed", db.AgentWorktree{Status: "dead", TaskStatus: strPtr("failed"), FinishedAt: &recent}, 0, false},
+		{"failed past retention", db.AgentWorktree{Status: "dead", TaskStatus: strPtr("failed"), FinishedAt: &old}, 0, true},
+		{"cancelled", db.AgentWorktree{Status: "idle", TaskStatus: strPtr("cancelled"), FinishedAt: &recent}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remove, reason := Decide(tt.w, tt.ahead, now, opts)
+			if remove != tt.remove {
+				t.Errorf("expected remove=%v, got %v (%s)", tt.remove, remove, reason)
+			}
+		})
+	}
+
+	// Without KeepUnmerged, branches with commits are collected too.
+	w := db.AgentWorktree{Status: "idle", TaskStatus: strPtr("completed"), FinishedAt: &old}
+	if remove, _ := Decide(w, 3, now, Options{}); !remove {
+		t.Error("expected unmerged worktree to be removed when KeepUnmerged is false")
+	}
+}
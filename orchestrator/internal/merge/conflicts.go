@@ -0,0 +1,244 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Conflict describes how the committed changes of two branches collide.
+type Conflict struct {
+	// Files are the files both branches changed in colliding ways.
+	Files []string
+	// Merge is true if a trial merge of the branches fails, rather than
+	// their changes only touching the same lines.
+	Merge bool
+}
+
+// lineRange is a range of lines [Start, End) of a file at the merge base.
+type lineRange struct {
+	Start, End int
+}
+
+// Branch is a task's branch and the commit its work started from.
+type Branch struct {
+	Name string
+	// Base is the commit the task started from; empty if unknown.
+	Base string
+}
+
+// CheckBranches compares the changes two branches made since their merge
+// base. Hunks that overlap or touch are reported, as are the files a trial
+// merge of the branches fails on. Only files both tasks changed themselves
+// count: changes a branch inherited from its parents are not its own.
+// Without a git that can merge in memory (see TrialMergeSupported), only
+// overlapping hunks are reported.
+func CheckBranches(projectDir string, a, b Branch) (Conflict, error) {
+	base, err := mergeBase(projectDir, a.Name, b.Name)
+	if err != nil {
+		return Conflict{}, err
+	}
+	hunksA, err := diffHunks(projectDir, base, a.Name)
+	if err != nil {
+		return Conflict{}, err
+	}
+	hunksB, err := diffHunks(projectDir, base, b.Name)
+	if err != nil {
+		return Conflict{}, err
+	}
+	ownA, err := ownFiles(projectDir, a)
+	if err != nil {
+		return Conflict{}, err
+	}
+	ownB, err := ownFiles(projectDir, b)
+	if err != nil {
+		return Conflict{}, err
+	}
+	own := func(file string) bool {
+		return (ownA == nil || ownA[file]) && (ownB == nil || ownB[file])
+	}
+
+	files := map[string]bool{}
+	shared := false
+	for file, ra := range hunksA {
+		rb, ok := hunksB[file]
+		if !ok || !own(file) {
+			continue
+		}
+		shared = true
+		if rangesOverlap(ra, rb) {
+			files[file] = true
+		}
+	}
+	// Branches that change different files always merge cleanly.
+	if !shared {
+		return Conflict{}, nil
+	}
+
+	var conflicted []string
+	if TrialMergeSupported() {
+		if conflicted, err = trialMerge(projectDir, a.Name, b.Name); err != nil {
+			return Conflict{}, err
+		}
+	}
+	var c Conflict
+	for _, f := range conflicted {
+		if own(f) {
+			files[f] = true
+			c.Merge = true
+		}
+	}
+	for f := range files {
+		c.Files = append(c.Files, f)
+	}
+	sort.Strings(c.Files)
+	return c, nil
+}
+
+// ownFiles returns the files a branch changed since its task's base, or nil
+// if the base is unknown.
+func ownFiles(projectDir string, b Branch) (map[string]bool, error) {
+	if b.Base == "" {
+		return nil, nil
+	}
+	cmd := exec.Command("git", "diff", "--name-only", "--no-renames", b.Base, b.Name, "--")
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s %s: %w", b.Base, b.Name, err)
+	}
+	files := map[string]bool{}
+	for _, f := range strings.Split(string(out), "\n") {
+		if f != "" {
+			files[f] = true
+		}
+	}
+	return files, nil
+}
+
+func mergeBase(projectDir string, a, b string) (string, error) {
+	cmd := exec.Command("git", "merge-base", a, b)
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git merge-base %s %s: %w", a, b, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// diffHunks returns, per file, the lines of base that branch changed.
+func diffHunks(projectDir string, base, branch string) (map[string][]lineRange, error) {
+	cmd := exec.Command("git", "diff", "-U0", "--no-renames", "--no-color", base, branch, "--")
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s %s: %w", base, branch, err)
+	}
+	return parseHunks(string(out)), nil
+}
+
+// parseHunks reads the hunk headers of a zero-context diff. A hunk that
+// only adds lines is taken to cover the line it adds after.
+func parseHunks(diff string) map[string][]lineRange {
+	hunks := map[string][]lineRange{}
+	var file string
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			file = ""
+		case strings.HasPrefix(line, "--- a/"):
+			file = strings.TrimPrefix(line, "--- a/")
+		case strings.HasPrefix(line, "+++ b/") && file == "":
+			// A new file: there is no old side to name it.
+			file = strings.TrimPrefix(line, "+++ b/")
+		case strings.HasPrefix(line, "@@ ") && file != "":
+			fields := strings.Fields(line)
+			if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+				continue
+			}
+			start, count := parseRange(strings.TrimPrefix(fields[1], "-"))
+			hunks[file] = append(hunks[file], lineRange{Start: start, End: start + max(count, 1)})
+		}
+	}
+	return hunks
+}
+
+// parseRange parses a hunk range "start[,count]"; count defaults to 1.
+func parseRange(s string) (int, int) {
+	startStr, countStr, found := strings.Cut(s, ",")
+	start, _ := strconv.Atoi(startStr)
+	count := 1
+	if found {
+		count, _ = strconv.Atoi(countStr)
+	}
+	return start, count
+}
+
+// rangesOverlap reports whether some range of a overlaps or touches one of
+// b; git does not merge changes to adjacent lines either.
+func rangesOverlap(a, b []lineRange) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x.Start <= y.End && y.Start <= x.End {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// TrialMergeSupported reports whether the installed git can merge branches
+// in memory: git merge-tree --write-tree needs git 2.38 or later.
+var TrialMergeSupported = sync.OnceValue(func() bool {
+	out, err := exec.Command("git", "version").Output()
+	if err != nil {
+		return false
+	}
+	major, minor, ok := parseGitVersion(string(out))
+	return ok && (major > 2 || major == 2 && minor >= 38)
+})
+
+// parseGitVersion parses the output of git version, such as "git version
+// 2.39.5" or "git version 2.39.3 (Apple Git-146)".
+func parseGitVersion(s string) (major, minor int, ok bool) {
+	fields := strings.Fields(s)
+	if len(fields) < 3 || fields[0] != "git" || fields[1] != "version" {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(fields[2], ".", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	major, errMajor := strconv.Atoi(parts[0])
+	minor, errMinor := strconv.Atoi(parts[1])
+	return major, minor, errMajor == nil && errMinor == nil
+}
+
+// trialMerge merges a and b in memory, without touching any worktree, and
+// returns the files that conflict.
+func trialMerge(projectDir string, a, b string) ([]string, error) {
+	cmd := exec.Command("git", "merge-tree", "--write-tree", "--name-only", "--no-messages", a, b)
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		// Exit status 1: the merge has conflicts. The first line is the
+		// tree written, the rest the conflicted files.
+		lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+		var files []string
+		for _, f := range lines[1:] {
+			if f != "" {
+				files = append(files, f)
+			}
+		}
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("git merge-tree %s %s: %w", a, b, err)
+	}
+	return nil, nil
+}
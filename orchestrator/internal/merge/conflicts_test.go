@@ -0,0 +1,140 @@
+package merge
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commit writes files on branch and commits them.
+func commit(t *testing.T, dir, branch string, files map[string]string) {
+	t.Helper()
+	git(t, dir, "checkout", "-q", branch)
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	git(t, dir, "add", "-A")
+	git(t, dir, "commit", "-q", "-m", "change on "+branch)
+}
+
+func TestParseHunks(t *testing.T) {
+	diff := `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -3 +3 @@ func a() {
+-	old
++	new
+@@ -10,0 +11,2 @@ func b() {
++	added
++	added
+diff --git a/new.go b/new.go
+new file mode 100644
+index 0000000..3333333
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1,2 @@
++package x
++
+`
+	want := map[string][]lineRange{
+		"a.go":   {{Start: 3, End: 4}, {Start: 10, End: 11}},
+		"new.go": {{Start: 0, End: 1}},
+	}
+	if got := parseHunks(diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseHunks = %v, want %v", got, want)
+	}
+}
+
+func TestParseGitVersion(t *testing.T) {
+	tests := []struct {
+		out          string
+		major, minor int
+		ok           bool
+	}{
+		{"git version 2.39.5\n", 2, 39, true},
+		{"git version 2.37.1 (Apple Git-137.1)\n", 2, 37, true},
+		{"git version 2.45.1.windows.1\n", 2, 45, true},
+		{"git version 3.0\n", 3, 0, true},
+		{"hub version 2.14.2\n", 0, 0, false},
+		{"git version unknown\n", 0, 0, false},
+	}
+	for _, tt := range tests {
+		major, minor, ok := parseGitVersion(tt.out)
+		if major != tt.major || minor != tt.minor || ok != tt.ok {
+			t.Errorf("parseGitVersion(%q) = %d, %d, %v; want %d, %d, %v", tt.out, major, minor, ok, tt.major, tt.minor, tt.ok)
+		}
+	}
+}
+
+func TestCheckBranches(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	git(t, repo, "init", "-q", "-b", "main")
+	lines := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	os.WriteFile(filepath.Join(repo, "shared.txt"), []byte(lines), 0644)
+	os.WriteFile(filepath.Join(repo, "other.txt"), []byte("x\n"), 0644)
+	git(t, repo, "add", "-A")
+	git(t, repo, "commit", "-q", "-m", "init")
+	base := git(t, repo, "rev-parse", "HEAD")
+	for _, b := range []string{"a", "b", "c", "d"} {
+		git(t, repo, "branch", b)
+	}
+
+	commit(t, repo, "a", map[string]string{"shared.txt": strings.Replace(lines, "two", "TWO", 1)})
+	commit(t, repo, "b", map[string]string{"shared.txt": strings.Replace(lines, "two", "deux", 1)})
+	commit(t, repo, "c", map[string]string{"shared.txt": strings.Replace(lines, "nine", "NINE", 1)})
+	commit(t, repo, "d", map[string]string{"other.txt": "y\n"})
+
+	check := func(x, y string) Conflict {
+		t.Helper()
+		c, err := CheckBranches(repo, Branch{Name: x, Base: base}, Branch{Name: y, Base: base})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Without a trial merge the overlapping lines are still found.
+	if c := check("a", "b"); c.Merge != TrialMergeSupported() || !reflect.DeepEqual(c.Files, []string{"shared.txt"}) {
+		t.Errorf("a and b: got %+v, want a conflict on shared.txt", c)
+	}
+	if c := check("a", "c"); len(c.Files) != 0 {
+		t.Errorf("a and c change distant lines, got %+v", c)
+	}
+	if c := check("a", "d"); len(c.Files) != 0 {
+		t.Errorf("a and d change different files, got %+v", c)
+	}
+
+	// e inherits a's change from its parent task; only its own work counts.
+	git(t, repo, "checkout", "-q", "a")
+	git(t, repo, "checkout", "-q", "-b", "e")
+	eBase := git(t, repo, "rev-parse", "HEAD")
+	commit(t, repo, "e", map[string]string{"other.txt": "z\n"})
+	c, err := CheckBranches(repo, Branch{Name: "b", Base: base}, Branch{Name: "e", Base: eBase})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Files) != 0 {
+		t.Errorf("b and e: got %+v, want no conflict from e's inherited change", c)
+	}
+}
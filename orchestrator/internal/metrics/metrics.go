@@ -0,0 +1,129 @@
+// Package metrics holds the orchestrator's Prometheus metrics. They are kept
+// up to date from the events the orchestrator already handles, and served
+// with --metrics-addr.
+package metrics
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/promtext"
+)
+
+// Registry holds every orchestrator metric.
+var Registry = promtext.NewRegistry()
+
+var (
+	Tasks  = Registry.Gauge("architect_tasks", "Tasks by status.", "status")
+	Agents = Registry.Gauge("architect_agents", "Agents by status.", "status")
+
+	Spawns = Registry.Counter("architect_agent_spawns_total",
+		"Agent sessions started, by reason: new, resume (from an interrupted task's branch) or reuse (an idle agent).", "reason")
+	Exits = Registry.Counter("architect_agent_exits_total",
+		"Agent processes that exited, by reason.", "reason")
+
+	TaskDuration = Registry.Histogram("architect_task_duration_seconds",
+		"Time finished tasks were worked on, excluding paused time, by final status.", promtext.DefaultBuckets, "status")
+	QueueDepth = Registry.Gauge("architect_ready_tasks",
+		"Ready tasks waiting for an agent.")
+
+	Blockers = Registry.Counter("architect_blockers_total",
+		"Blockers reported by agents.")
+	BlockerLatency = Registry.Histogram("architect_blocker_latency_seconds",
+		"Time from an agent reporting a blocker to the orchestrator answering it.",
+		[]float64{0.1, 0.5, 1, 5, 15, 60, 300, 900})
+
+	ListenReconnects = Registry.Counter("architect_listen_reconnects_total",
+		"Times the LISTEN connection to Postgres was re-established.")
+)
+
+// Exit reasons other than a task's failure reason (see db.FailTask).
+const (
+	ExitCompleted = "completed" // the task completed
+	ExitCancelled = "cancelled" // the task was cancelled
+	ExitFailed    = "failed"    // the agent reported failure
+	ExitTimeout   = "timeout"   // the task timed out (see db.TimeOutTask)
+	ExitShutdown  = "shutdown"  // stopped by an orchestrator shutdown
+)
+
+var (
+	taskStatuses  = newStatusSet(Tasks)
+	agentStatuses = newStatusSet(Agents)
+)
+
+// SeedTasks sets the task gauges from the tasks' current statuses, keyed by ID.
+func SeedTasks(statuses map[int64]string) {
+	for id, status := range statuses {
+		taskStatuses.set(strconv.FormatInt(id, 10), status)
+	}
+}
+
+// SeedAgents sets the agent gauges from the agents' current statuses.
+func SeedAgents(statuses map[string]string) {
+	for id, status := range statuses {
+		agentStatuses.set(id, status)
+	}
+}
+
+// row holds the columns of an outbox event's old or new row that metrics use.
+type row struct {
+	ID            json.Number `json:"id"`
+	AgentID       string      `json:"agent_id"`
+	Status        string      `json:"status"`
+	StartedAt     *time.Time  `json:"started_at"`
+	PausedSeconds float64     `json:"paused_seconds"`
+}
+
+// ObserveEvent updates the status gauges and task durations from an outbox event.
+func ObserveEvent(event db.Event) {
+	var before, after row
+	if len(event.New) == 0 || json.Unmarshal(event.New, &after) != nil {
+		return
+	}
+	if len(event.Old) > 0 && json.Unmarshal(event.Old, &before) != nil {
+		return
+	}
+
+	switch event.Channel {
+	case "task_updates":
+		changed := taskStatuses.set(after.ID.String(), after.Status)
+		if changed && !db.IsTerminalStatus(before.Status) && db.IsTerminalStatus(after.Status) && after.StartedAt != nil {
+			active := event.CreatedAt.Sub(*after.StartedAt).Seconds() - after.PausedSeconds
+			TaskDuration.Observe(max(active, 0), after.Status)
+		}
+	case "agent_updates":
+		agentStatuses.set(after.AgentID, after.Status)
+	}
+}
+
+// statusSet keeps a gauge by status in step with the last known status of
+// each task or agent, so a replayed event does not count an entity twice.
+type statusSet struct {
+	gauge *promtext.Gauge
+
+	mu    sync.Mutex
+	known map[string]string
+}
+
+func newStatusSet(g *promtext.Gauge) *statusSet {
+	return &statusSet{gauge: g, known: map[string]string{}}
+}
+
+// set moves id to status and reports whether its status changed.
+func (s *statusSet) set(id, status string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.known[id]
+	s.known[id] = status
+	if prev == status {
+		return false
+	}
+	if prev != "" {
+		s.gauge.Add(-1, prev)
+	}
+	s.gauge.Add(1, status)
+	return true
+}
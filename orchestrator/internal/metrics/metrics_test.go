@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/affanhamid/editor/promtext"
+)
+
+func TestStatusSet(t *testing.T) {
+	r := promtext.NewRegistry()
+	s := newStatusSet(r.Gauge("tasks", "Tasks.", "status"))
+
+	s.set("1", "pending")
+	s.set("2", "pending")
+	if !s.set("1", "in_progress") {
+		t.Error("pending -> in_progress: want a change")
+	}
+	// A replayed event must not count the task twice.
+	if s.set("1", "in_progress") {
+		t.Error("repeated status: want no change")
+	}
+	s.set("2", "completed")
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`tasks{status="pending"} 0`,
+		`tasks{status="in_progress"} 1`,
+		`tasks{status="completed"} 1`,
+	} {
+		if !strings.Contains(b.String(), want+"\n") {
+			t.Errorf("missing %q in:\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,481 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CommandPayload is the JSON payload from orchestrator_commands notifications.
+type CommandPayload struct {
+	ID      int64  `json:"id"`
+	Command string `json:"command"`
+}
+
+// addTaskArgs are the arguments of an add_task command.
+type addTaskArgs struct {
+	Title       string  `json:"title"`
+	Description string  `json:"description"`
+	RiskLevel   string  `json:"risk_level"`
+	Priority    int     `json:"priority"`
+	BlockedBy   []int64 `json:"blocked_by"`
+	// ParentID puts the task in an epic. A pending task nobody is working
+	// on becomes an epic when it is given its first task.
+	ParentID int64 `json:"parent_id"`
+
+	Domains            []string                   `json:"domains"`
+	AcceptanceCriteria []string                   `json:"acceptance_criteria"`
+	PermissionProfile  string                     `json:"permission_profile"`
+	MCPServers         map[string]json.RawMessage `json:"mcp_servers"`
+	FileScope          []string                   `json:"file_scope"`
+	AllowOverlap       bool                       `json:"allow_overlap"`
+}
+
+// taskArgs are the arguments of cancel_task and retry_task.
+type taskArgs struct {
+	TaskID int64 `json:"task_id"`
+}
+
+// updateTaskArgs are the arguments of an update_task command; omitted fields are unchanged.
+type updateTaskArgs struct {
+	TaskID      int64   `json:"task_id"`
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	RiskLevel   *string `json:"risk_level"`
+	Priority    *int    `json:"priority"`
+}
+
+// edgeArgs are the arguments of add_edge and remove_edge.
+type edgeArgs struct {
+	FromTask int64  `json:"from_task"`
+	ToTask   int64  `json:"to_task"`
+	EdgeType string `json:"edge_type"`
+}
+
+// agentArgs are the arguments of kill_agent, pause_agent and resume_agent.
+type agentArgs struct {
+	AgentID string `json:"agent_id"`
+}
+
+// errRejected marks a command that was understood but not applied; its
+// message is recorded as the reason.
+type errRejected struct{ reason string }
+
+func (e errRejected) Error() string { return e.reason }
+
+func rejectf(format string, args ...any) error {
+	return errRejected{fmt.Sprintf(format, args...)}
+}
+
+// ProcessPendingCommands handles commands issued while the orchestrator was not running.
+func ProcessPendingCommands(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, projectDir string, config spawn.Config) {
+	cmds, err := db.PendingCommands(ctx, pool)
+	if err != nil {
+		logger.Error("failed to read pending commands", "err", err)
+		return
+	}
+	for _, cmd := range cmds {
+		handleCommand(ctx, pool, registry, cmd, projectDir, config)
+	}
+}
+
+// HandleCommand applies a runtime command and records whether it was
+// applied. Commands that already have a result are ignored, so a command
+// seen both at startup and via NOTIFY is applied once.
+func HandleCommand(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, payload CommandPayload, projectDir string, config spawn.Config) {
+	handled, err := db.CommandHandled(ctx, pool, payload.ID)
+	if err != nil {
+		logger.Error("failed to check command", "command_id", payload.ID, "err", err)
+		return
+	}
+	if handled {
+		return
+	}
+	cmd, err := db.GetCommand(ctx, pool, payload.ID)
+	if err != nil {
+		logger.Error("failed to read command", "command_id", payload.ID, "err", err)
+		return
+	}
+	handleCommand(ctx, pool, registry, cmd, projectDir, config)
+}
+
+func handleCommand(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, cmd db.Command, projectDir string, config spawn.Config) {
+	result, err := applyCommand(ctx, pool, registry, cmd)
+
+	applied, reason := err == nil, ""
+	if err != nil {
+		reason = err.Error()
+		var rejected errRejected
+		if !errors.As(err, &rejected) {
+			reason = "error: " + reason
+		}
+		logger.Warn("command not applied", "command_id", cmd.ID, "command", cmd.Command, "issued_by", cmd.IssuedBy, "reason", reason)
+	} else {
+		logger.Info("command applied", "command_id", cmd.ID, "command", cmd.Command, "issued_by", cmd.IssuedBy)
+	}
+	if err := db.RecordCommandResult(ctx, pool, cmd.ID, applied, reason, result); err != nil {
+		logger.Error("failed to record command result", "command_id", cmd.ID, "err", err)
+	}
+
+	if applied {
+		ScheduleReady(ctx, pool, registry, projectDir, config)
+	}
+}
+
+// applyCommand dispatches a command, returning an optional result object.
+func applyCommand(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, cmd db.Command) (any, error) {
+	switch cmd.Command {
+	case "add_task":
+		var args addTaskArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return addTask(ctx, pool, args)
+	case "cancel_task":
+		var args taskArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		dependents, err := cancelTask(ctx, pool, registry, args.TaskID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]int64{"cancelled_dependents": dependents}, nil
+	case "retry_task":
+		var args taskArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, retryTask(ctx, pool, args.TaskID)
+	case "update_task":
+		var args updateTaskArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, updateTask(ctx, pool, registry, args)
+	case "add_edge":
+		var args edgeArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, addEdge(ctx, pool, args)
+	case "remove_edge":
+		var args edgeArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, removeEdge(ctx, pool, args)
+	case "kill_agent":
+		var args agentArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, killAgent(ctx, pool, registry, args.AgentID)
+	case "pause_agent", "resume_agent":
+		var args agentArgs
+		if err := decodeArgs(cmd, &args); err != nil {
+			return nil, err
+		}
+		return nil, pauseAgent(ctx, pool, args.AgentID, cmd.Command == "pause_agent")
+	case "pause_swarm", "resume_swarm":
+		return nil, pauseSwarm(ctx, pool, cmd.Command == "pause_swarm")
+	default:
+		return nil, rejectf("unknown command %q", cmd.Command)
+	}
+}
+
+func decodeArgs(cmd db.Command, v any) error {
+	if len(cmd.Args) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(cmd.Args, v); err != nil {
+		return rejectf("invalid args: %v", err)
+	}
+	return nil
+}
+
+// getTask fetches a task, turning a missing task into a rejection.
+func getTask(ctx context.Context, pool *pgxpool.Pool, taskID int64) (db.TaskInfo, error) {
+	task, err := db.GetTask(ctx, pool, taskID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return task, rejectf("task %d does not exist", taskID)
+	}
+	return task, err
+}
+
+func validRiskLevel(risk string) bool {
+	return risk == "low" || risk == "medium" || risk == "high"
+}
+
+func addTask(ctx context.Context, pool *pgxpool.Pool, args addTaskArgs) (any, error) {
+	if args.Title == "" {
+		return nil, rejectf("title is required")
+	}
+	if args.RiskLevel == "" {
+		args.RiskLevel = "low"
+	}
+	if !validRiskLevel(args.RiskLevel) {
+		return nil, rejectf("invalid risk_level %q", args.RiskLevel)
+	}
+	if _, err := spawn.LookupPermissionProfile(args.PermissionProfile); err != nil {
+		return nil, rejectf("%v", err)
+	}
+	if err := spawn.ValidateMCPServers(args.MCPServers); err != nil {
+		return nil, rejectf("%v", err)
+	}
+	for _, dep := range args.BlockedBy {
+		if _, err := getTask(ctx, pool, dep); err != nil {
+			return nil, err
+		}
+	}
+	if args.ParentID != 0 {
+		parent, err := getTask(ctx, pool, args.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case parent.ParentID != nil:
+			return nil, rejectf("task %d is part of epic %d; epics cannot be nested", args.ParentID, *parent.ParentID)
+		case db.IsTerminalStatus(parent.Status):
+			return nil, rejectf("task %d is already %s", args.ParentID, parent.Status)
+		case !parent.Epic && (parent.Status != "pending" || parent.AssignedTo != nil):
+			return nil, rejectf("task %d is %s; only epics and pending tasks can be given tasks", args.ParentID, parent.Status)
+		}
+	}
+
+	id, err := db.CreateTask(ctx, pool, db.NewTask{
+		Title:              args.Title,
+		Description:        args.Description,
+		RiskLevel:          args.RiskLevel,
+		Priority:           args.Priority,
+		Domains:            args.Domains,
+		AcceptanceCriteria: args.AcceptanceCriteria,
+		PermissionProfile:  args.PermissionProfile,
+		MCPServers:         args.MCPServers,
+		FileScope:          args.FileScope,
+		AllowOverlap:       args.AllowOverlap,
+		ParentID:           args.ParentID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, dep := range args.BlockedBy {
+		if err := db.InsertEdge(ctx, pool, dep, id); err != nil {
+			return nil, fmt.Errorf("add edge %d → %d: %w", dep, id, err)
+		}
+	}
+	logger.Info("added task", logging.TaskID, id, "title", args.Title)
+	return map[string]int64{"task_id": id}, nil
+}
+
+// cancelTask cancels a task, or every unfinished task of an epic, and the
+// pending tasks that can then never start. It returns the IDs of the latter.
+func cancelTask(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, taskID int64) ([]int64, error) {
+	task, err := getTask(ctx, pool, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if db.IsTerminalStatus(task.Status) {
+		return nil, rejectf("task %d is already %s", taskID, task.Status)
+	}
+	if task.Epic {
+		// The epic's status follows its tasks.
+		children, err := db.ChildTasks(ctx, pool, taskID)
+		if err != nil {
+			return nil, err
+		}
+		var dependents []int64
+		for _, child := range children {
+			// Re-read the status: an earlier child's dependents may include this one.
+			status, err := db.TaskStatus(ctx, pool, child.ID)
+			if err != nil {
+				return dependents, err
+			}
+			if db.IsTerminalStatus(status) {
+				continue
+			}
+			cancelled, err := cancelTask(ctx, pool, registry, child.ID)
+			dependents = append(dependents, cancelled...)
+			if err != nil {
+				return dependents, err
+			}
+		}
+		return dependents, nil
+	}
+	if err := db.CancelTask(ctx, pool, taskID); err != nil {
+		return nil, err
+	}
+
+	// Stop the agent working on it; finishSession marks it stopped.
+	if task.AssignedTo != nil && registry.IsAlive(*task.AssignedTo) {
+		if current, ok := registry.TaskID(*task.AssignedTo); ok && current == taskID {
+			agentID := *task.AssignedTo
+			_ = registry.Resume(agentID)
+			if err := registry.Signal(agentID, syscall.SIGTERM); err != nil {
+				logger.Error("failed to stop agent", logging.AgentID, agentID, logging.TaskID, taskID, "err", err)
+			}
+		}
+	}
+
+	dependents, err := db.CancelDependents(ctx, pool, taskID)
+	if err != nil {
+		return dependents, fmt.Errorf("cancel dependents of task %d: %w", taskID, err)
+	}
+	if len(dependents) > 0 {
+		logger.Info("cancelled tasks waiting on a cancelled task", logging.TaskID, taskID, "dependents", dependents)
+	}
+	return dependents, nil
+}
+
+func retryTask(ctx context.Context, pool *pgxpool.Pool, taskID int64) error {
+	task, err := getTask(ctx, pool, taskID)
+	if err != nil {
+		return err
+	}
+	if task.Status != "failed" && task.Status != "cancelled" {
+		return rejectf("task %d is %s; only failed or cancelled tasks can be retried", taskID, task.Status)
+	}
+	if task.Epic {
+		children, err := db.ChildTasks(ctx, pool, taskID)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			if child.Status != "failed" && child.Status != "cancelled" {
+				continue
+			}
+			if err := db.RetryTask(ctx, pool, child.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return db.RetryTask(ctx, pool, taskID)
+}
+
+func updateTask(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, args updateTaskArgs) error {
+	task, err := getTask(ctx, pool, args.TaskID)
+	if err != nil {
+		return err
+	}
+	if db.IsTerminalStatus(task.Status) {
+		return rejectf("task %d is already %s", args.TaskID, task.Status)
+	}
+	if args.Title == nil && args.Description == nil && args.RiskLevel == nil && args.Priority == nil {
+		return rejectf("nothing to update")
+	}
+	if args.RiskLevel != nil && !validRiskLevel(*args.RiskLevel) {
+		return rejectf("invalid risk_level %q", *args.RiskLevel)
+	}
+	if err := db.UpdateTaskFields(ctx, pool, args.TaskID, args.Title, args.Description, args.RiskLevel, args.Priority); err != nil {
+		return err
+	}
+
+	// An agent already working on the task only sees the change if told.
+	if args.Description != nil && task.AssignedTo != nil && registry.IsOpen(*task.AssignedTo) {
+		msg := fmt.Sprintf("The description of your task #%d was updated by a human:\n\n%s\n\nAdjust your work accordingly.", args.TaskID, *args.Description)
+		if err := registry.Send(*task.AssignedTo, msg); err != nil {
+			logger.Error("failed to notify agent of task update", logging.AgentID, *task.AssignedTo, logging.TaskID, args.TaskID, "err", err)
+		}
+	}
+	return nil
+}
+
+func addEdge(ctx context.Context, pool *pgxpool.Pool, args edgeArgs) error {
+	if args.EdgeType == "" {
+		args.EdgeType = "blocks"
+	}
+	if args.EdgeType != "blocks" && args.EdgeType != "informs" {
+		return rejectf("invalid edge_type %q", args.EdgeType)
+	}
+	if args.FromTask == args.ToTask {
+		return rejectf("a task cannot depend on itself")
+	}
+	if _, err := getTask(ctx, pool, args.FromTask); err != nil {
+		return err
+	}
+	to, err := getTask(ctx, pool, args.ToTask)
+	if err != nil {
+		return err
+	}
+	if args.EdgeType == "blocks" && to.Status != "pending" {
+		return rejectf("task %d is already %s; only pending tasks can gain blockers", args.ToTask, to.Status)
+	}
+	cycle, err := db.EdgeCreatesCycle(ctx, pool, args.FromTask, args.ToTask)
+	if err != nil {
+		return err
+	}
+	if cycle {
+		return rejectf("edge %d → %d would create a cycle", args.FromTask, args.ToTask)
+	}
+	return db.InsertTypedEdge(ctx, pool, args.FromTask, args.ToTask, args.EdgeType)
+}
+
+func removeEdge(ctx context.Context, pool *pgxpool.Pool, args edgeArgs) error {
+	removed, err := db.DeleteEdge(ctx, pool, args.FromTask, args.ToTask)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return rejectf("no edge %d → %d", args.FromTask, args.ToTask)
+	}
+	return nil
+}
+
+func killAgent(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, agentID string) error {
+	if agentID == "" {
+		return rejectf("agent_id is required")
+	}
+	if !registry.IsAlive(agentID) {
+		return rejectf("agent %s is not running", agentID)
+	}
+	if err := registry.Signal(agentID, syscall.SIGKILL); err != nil {
+		return err
+	}
+	// The wait goroutine fails the task; the status is set here too so the
+	// dashboard reflects the kill immediately.
+	return db.UpdateAgentStatus(ctx, pool, agentID, "dead")
+}
+
+// pauseAgent records that an agent should be paused or resumed, as
+// `architect pause` does; HandleAgentPause applies it to the process.
+func pauseAgent(ctx context.Context, pool *pgxpool.Pool, agentID string, pause bool) error {
+	if agentID == "" {
+		return rejectf("agent_id is required")
+	}
+	setStatus, state := db.ResumeAgents, "paused"
+	if pause {
+		setStatus, state = db.PauseAgents, "running"
+	}
+	changed, err := setStatus(ctx, pool, []string{agentID})
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return rejectf("agent %s is not %s", agentID, state)
+	}
+	return nil
+}
+
+// pauseSwarm pauses or resumes the whole swarm; HandleSwarmPause applies it.
+func pauseSwarm(ctx context.Context, pool *pgxpool.Pool, pause bool) error {
+	paused, err := db.SwarmPaused(ctx, pool)
+	if err != nil {
+		return err
+	}
+	if paused && pause {
+		return rejectf("swarm is already paused")
+	}
+	if !paused && !pause {
+		return rejectf("swarm is not paused")
+	}
+	return db.SetSwarmPaused(ctx, pool, pause)
+}
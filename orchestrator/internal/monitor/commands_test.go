@@ -0,0 +1,331 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/dbtest"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// apply runs a command through applyCommand.
+func apply(t *testing.T, pool *pgxpool.Pool, registry *spawn.AgentRegistry, command string, args any) (any, error) {
+	t.Helper()
+	raw, err := json.Marshal(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return applyCommand(context.Background(), pool, registry, db.Command{Command: command, Args: raw, IssuedBy: "test"})
+}
+
+// wantRejected fails the test unless err is a rejection mentioning want.
+func wantRejected(t *testing.T, err error, want string) {
+	t.Helper()
+	var rejected errRejected
+	if !errors.As(err, &rejected) {
+		t.Fatalf("expected a rejection containing %q, got %v", want, err)
+	}
+	if !strings.Contains(rejected.reason, want) {
+		t.Errorf("expected rejection containing %q, got %q", want, rejected.reason)
+	}
+}
+
+func newTask(t *testing.T, pool *pgxpool.Pool, title string, blockedBy ...int64) int64 {
+	t.Helper()
+	ctx := context.Background()
+	id, err := db.CreateTask(ctx, pool, db.NewTask{Title: title, RiskLevel: "low"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range blockedBy {
+		if err := db.InsertEdge(ctx, pool, dep, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return id
+}
+
+func taskStatus(t *testing.T, pool *pgxpool.Pool, id int64) string {
+	t.Helper()
+	status, err := db.TaskStatus(context.Background(), pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestUnknownCommandIsRecorded(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	ctx := context.Background()
+
+	id, err := db.IssueCommand(ctx, pool, "reticulate_splines", map[string]any{}, "test")
+	if err != nil {
+		t.Fatalf("an unknown command should be accepted for the orchestrator to reject: %v", err)
+	}
+	HandleCommand(ctx, pool, spawn.NewAgentRegistry(), CommandPayload{ID: id, Command: "reticulate_splines"}, t.TempDir(), spawn.Config{})
+
+	result, err := db.WaitCommandResult(ctx, pool, id, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Applied || !strings.Contains(result.Reason, `unknown command "reticulate_splines"`) {
+		t.Errorf("expected an unknown-command rejection, got applied=%v reason=%q", result.Applied, result.Reason)
+	}
+}
+
+func TestAddTaskCommand(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	dep := newTask(t, pool, "dependency")
+
+	result, err := apply(t, pool, registry, "add_task", addTaskArgs{Title: "new", Priority: 2, BlockedBy: []int64{dep}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := result.(map[string]int64)["task_id"]
+	task, err := db.GetTask(context.Background(), pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "new" || task.RiskLevel != "low" || task.Priority != 2 || task.Status != "pending" {
+		t.Errorf("unexpected task %+v", task)
+	}
+	upstream, err := db.UpstreamTasks(context.Background(), pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upstream) != 1 || upstream[0].ID != dep {
+		t.Errorf("expected task to be blocked by %d, got %+v", dep, upstream)
+	}
+
+	_, err = apply(t, pool, registry, "add_task", addTaskArgs{})
+	wantRejected(t, err, "title is required")
+	_, err = apply(t, pool, registry, "add_task", addTaskArgs{Title: "x", RiskLevel: "extreme"})
+	wantRejected(t, err, "invalid risk_level")
+	_, err = apply(t, pool, registry, "add_task", addTaskArgs{Title: "x", BlockedBy: []int64{999}})
+	wantRejected(t, err, "task 999 does not exist")
+}
+
+func TestCancelTaskCommandCancelsDependents(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	a := newTask(t, pool, "a")
+	b := newTask(t, pool, "b", a)
+	c := newTask(t, pool, "c", b)
+	other := newTask(t, pool, "unrelated")
+
+	result, err := apply(t, pool, registry, "cancel_task", taskArgs{TaskID: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.(map[string][]int64)["cancelled_dependents"]
+	slices.Sort(got)
+	if !slices.Equal(got, []int64{b, c}) {
+		t.Errorf("expected dependents %d and %d to be cancelled, got %v", b, c, got)
+	}
+	for _, id := range []int64{a, b, c} {
+		if status := taskStatus(t, pool, id); status != "cancelled" {
+			t.Errorf("task %d: expected cancelled, got %s", id, status)
+		}
+	}
+	if status := taskStatus(t, pool, other); status != "pending" {
+		t.Errorf("unrelated task: expected pending, got %s", status)
+	}
+
+	_, err = apply(t, pool, registry, "cancel_task", taskArgs{TaskID: a})
+	wantRejected(t, err, "already cancelled")
+	_, err = apply(t, pool, registry, "cancel_task", taskArgs{TaskID: 999})
+	wantRejected(t, err, "does not exist")
+}
+
+func TestCancelTaskCommandCascadesThroughEpics(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	ctx := context.Background()
+	a := newTask(t, pool, "a")
+	epic := newTask(t, pool, "epic", a)
+	child, err := db.CreateTask(ctx, pool, db.NewTask{Title: "child", RiskLevel: "low", ParentID: epic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := newTask(t, pool, "after the epic", epic)
+
+	result, err := apply(t, pool, registry, "cancel_task", taskArgs{TaskID: a})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := result.(map[string][]int64)["cancelled_dependents"]
+	slices.Sort(got)
+	if !slices.Equal(got, []int64{child, after}) {
+		t.Errorf("expected %d and %d to be cancelled, got %v", child, after, got)
+	}
+	if status := taskStatus(t, pool, epic); status != "cancelled" {
+		t.Errorf("epic: expected cancelled, got %s", status)
+	}
+}
+
+func TestRetryTaskCommand(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	id := newTask(t, pool, "a")
+
+	_, err := apply(t, pool, registry, "retry_task", taskArgs{TaskID: id})
+	wantRejected(t, err, "only failed or cancelled tasks can be retried")
+
+	if err := db.CancelTask(context.Background(), pool, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(t, pool, registry, "retry_task", taskArgs{TaskID: id}); err != nil {
+		t.Fatal(err)
+	}
+	if status := taskStatus(t, pool, id); status != "pending" {
+		t.Errorf("expected pending after retry, got %s", status)
+	}
+}
+
+func TestUpdateTaskCommand(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	id := newTask(t, pool, "a")
+
+	title, priority := "renamed", 5
+	if _, err := apply(t, pool, registry, "update_task", updateTaskArgs{TaskID: id, Title: &title, Priority: &priority}); err != nil {
+		t.Fatal(err)
+	}
+	task, err := db.GetTask(context.Background(), pool, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Title != "renamed" || task.Priority != 5 || task.RiskLevel != "low" {
+		t.Errorf("unexpected task after update %+v", task)
+	}
+
+	_, err = apply(t, pool, registry, "update_task", updateTaskArgs{TaskID: id})
+	wantRejected(t, err, "nothing to update")
+	risk := "extreme"
+	_, err = apply(t, pool, registry, "update_task", updateTaskArgs{TaskID: id, RiskLevel: &risk})
+	wantRejected(t, err, "invalid risk_level")
+}
+
+func TestEdgeCommands(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	a := newTask(t, pool, "a")
+	b := newTask(t, pool, "b")
+
+	if _, err := apply(t, pool, registry, "add_edge", edgeArgs{FromTask: a, ToTask: b}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := apply(t, pool, registry, "add_edge", edgeArgs{FromTask: b, ToTask: a})
+	wantRejected(t, err, "would create a cycle")
+	_, err = apply(t, pool, registry, "add_edge", edgeArgs{FromTask: a, ToTask: a})
+	wantRejected(t, err, "cannot depend on itself")
+	_, err = apply(t, pool, registry, "add_edge", edgeArgs{FromTask: a, ToTask: b, EdgeType: "follows"})
+	wantRejected(t, err, "invalid edge_type")
+
+	if _, err := apply(t, pool, registry, "remove_edge", edgeArgs{FromTask: a, ToTask: b}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = apply(t, pool, registry, "remove_edge", edgeArgs{FromTask: a, ToTask: b})
+	wantRejected(t, err, "no edge")
+}
+
+func TestKillAgentCommand(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	ctx := context.Background()
+
+	_, err := apply(t, pool, registry, "kill_agent", agentArgs{})
+	wantRejected(t, err, "agent_id is required")
+	_, err = apply(t, pool, registry, "kill_agent", agentArgs{AgentID: "ghost"})
+	wantRejected(t, err, "not running")
+
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+	id := newTask(t, pool, "a")
+	if err := db.RegisterAgent(ctx, pool, "agent-1", id, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	registry.Register("agent-1", nil, cmd.Process.Pid, id)
+
+	if _, err := apply(t, pool, registry, "kill_agent", agentArgs{AgentID: "agent-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err == nil {
+		t.Error("expected the agent's process to be killed")
+	}
+	var status string
+	if err := pool.QueryRow(ctx, `SELECT status FROM agents WHERE agent_id = 'agent-1'`).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "dead" {
+		t.Errorf("expected agent to be dead, got %s", status)
+	}
+}
+
+func TestPauseCommands(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	registry := spawn.NewAgentRegistry()
+	ctx := context.Background()
+	id := newTask(t, pool, "a")
+	if err := db.RegisterAgent(ctx, pool, "agent-1", id, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	agentStatus := func() string {
+		var status string
+		if err := pool.QueryRow(ctx, `SELECT status FROM agents WHERE agent_id = 'agent-1'`).Scan(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if _, err := apply(t, pool, registry, "pause_agent", agentArgs{AgentID: "agent-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if status := agentStatus(); status != "paused" {
+		t.Errorf("expected paused, got %s", status)
+	}
+	_, err := apply(t, pool, registry, "pause_agent", agentArgs{AgentID: "agent-1"})
+	wantRejected(t, err, "is not running")
+	if _, err := apply(t, pool, registry, "resume_agent", agentArgs{AgentID: "agent-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if status := agentStatus(); status != "starting" {
+		t.Errorf("expected the status before the pause to be restored, got %s", status)
+	}
+	_, err = apply(t, pool, registry, "resume_agent", agentArgs{AgentID: "agent-1"})
+	wantRejected(t, err, "is not paused")
+	_, err = apply(t, pool, registry, "pause_agent", agentArgs{})
+	wantRejected(t, err, "agent_id is required")
+
+	if err := db.SetSwarmPaused(ctx, pool, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := apply(t, pool, registry, "pause_swarm", nil); err != nil {
+		t.Fatal(err)
+	}
+	if paused, err := db.SwarmPaused(ctx, pool); err != nil || !paused {
+		t.Errorf("expected the swarm to be paused, got %v, %v", paused, err)
+	}
+	_, err = apply(t, pool, registry, "pause_swarm", nil)
+	wantRejected(t, err, "already paused")
+	if _, err := apply(t, pool, registry, "resume_swarm", nil); err != nil {
+		t.Fatal(err)
+	}
+	if paused, err := db.SwarmPaused(ctx, pool); err != nil || paused {
+		t.Errorf("expected the swarm to be running, got %v, %v", paused, err)
+	}
+}
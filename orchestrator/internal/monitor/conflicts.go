@@ -0,0 +1,144 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/merge"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// conflictCheckInterval is how often the branches of running tasks are
+// compared with each other.
+const conflictCheckInterval = 2 * time.Minute
+
+// branchComparison is the outcome of comparing two running tasks' branches.
+type branchComparison struct {
+	a, b     db.ActiveBranch
+	conflict merge.Conflict
+}
+
+// conflictResult is what a background conflict check found. complete is
+// false if some pair could not be compared.
+type conflictResult struct {
+	comparisons []branchComparison
+	complete    bool
+}
+
+// conflictChecks tracks the background conflict check. The git work runs
+// in its own goroutine, since it grows with the square of the number of
+// branches; its result is recorded by the event loop, which is the only
+// goroutine touching running.
+var conflictChecks = struct {
+	running bool
+	results chan conflictResult
+}{results: make(chan conflictResult, 1)}
+
+// StartConflictCheck compares the committed changes of every pair of
+// running tasks' branches in the background, unless a check is already
+// under way. HandleEvents records the result with applyConflicts.
+func StartConflictCheck(ctx context.Context, pool *pgxpool.Pool, projectDir string) {
+	if conflictChecks.running {
+		return
+	}
+	branches, err := db.ActiveBranches(ctx, pool)
+	if err != nil {
+		logger.Error("failed to find active branches", "err", err)
+		return
+	}
+
+	conflictChecks.running = true
+	go func() {
+		result := compareBranches(branches, projectDir)
+		select {
+		case conflictChecks.results <- result:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// compareBranches compares every pair of branches, keeping those that collide.
+func compareBranches(branches []db.ActiveBranch, projectDir string) conflictResult {
+	result := conflictResult{complete: true}
+	for i, a := range branches {
+		for _, b := range branches[i+1:] {
+			c, err := merge.CheckBranches(projectDir,
+				merge.Branch{Name: a.Branch, Base: a.BaseSHA},
+				merge.Branch{Name: b.Branch, Base: b.BaseSHA})
+			if err != nil {
+				logger.Warn("failed to compare branches", "branch_a", a.Branch, "branch_b", b.Branch, "err", err)
+				result.complete = false
+				continue
+			}
+			if len(c.Files) > 0 {
+				result.comparisons = append(result.comparisons, branchComparison{a: a, b: b, conflict: c})
+			}
+		}
+	}
+	return result
+}
+
+// applyConflicts records the collisions a conflict check found. Both
+// agents are told the first time a pair collides, and again whenever the
+// files change.
+func applyConflicts(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, result conflictResult) {
+	conflictChecks.running = false
+
+	var current []int64
+	complete := result.complete
+	for _, cmp := range result.comparisons {
+		a, b, c := cmp.a, cmp.b, cmp.conflict
+		kind := "overlap"
+		if c.Merge {
+			kind = "merge"
+		}
+		id, isNew, err := db.RecordConflict(ctx, pool, db.BranchConflict{
+			TaskA: a.TaskID, TaskB: b.TaskID,
+			BranchA: a.Branch, BranchB: b.Branch,
+			Kind: kind, Files: c.Files,
+		})
+		if err != nil {
+			logger.Error("failed to record branch conflict", "branch_a", a.Branch, "branch_b", b.Branch, "err", err)
+			complete = false
+			continue
+		}
+		current = append(current, id)
+		if !isNew {
+			continue
+		}
+
+		logger.Warn("branches of running tasks conflict", "task_a", a.TaskID, "task_b", b.TaskID,
+			"kind", kind, "files", c.Files)
+		warnConflict(registry, a, b, kind, c.Files)
+		warnConflict(registry, b, a, kind, c.Files)
+	}
+
+	// Pairs that could not be compared keep whatever was recorded for them.
+	if complete {
+		if err := db.ResolveConflicts(ctx, pool, current); err != nil {
+			logger.Error("failed to resolve branch conflicts", "err", err)
+		}
+	}
+}
+
+// warnConflict tells the agent on branch a that its work collides with b.
+func warnConflict(registry *spawn.AgentRegistry, a, b db.ActiveBranch, kind string, files []string) {
+	if !registry.IsOpen(a.AgentID) {
+		return
+	}
+	how := "changes the same lines as"
+	if kind == "merge" {
+		how = "will not merge cleanly with"
+	}
+	msg := fmt.Sprintf("Your committed work on task #%d %s task #%d (%s, branch `%s`) in: %s. "+
+		"Coordinate with that agent through post_message before going further, so the branches can be merged.",
+		a.TaskID, how, b.TaskID, b.Title, b.Branch, strings.Join(files, ", "))
+	if err := registry.Send(a.AgentID, msg); err != nil {
+		logger.Error("failed to warn agent of branch conflict", logging.AgentID, a.AgentID, "err", err)
+	}
+}
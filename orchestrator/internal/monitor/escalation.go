@@ -3,8 +3,8 @@ package monitor
 import (
 	"context"
 	"fmt"
-	"log"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/orchestrator/internal/db"
 	"github.com/affanhamid/editor/orchestrator/internal/spawn"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -15,12 +15,12 @@ import (
 func HandleBlocker(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, msg MessagePayload) {
 	content, err := db.GetMessageContent(ctx, pool, msg.ID)
 	if err != nil {
-		log.Printf("error fetching blocker message %d: %v", msg.ID, err)
+		logger.Error("failed to fetch blocker message", "message_id", msg.ID, "err", err)
 		content = "(could not fetch content)"
 	}
 
-	log.Printf("escalation: agent %s reported blocker on channel %s: %s",
-		msg.AgentID[:8], msg.Channel, content)
+	logger.Warn("escalation: agent reported blocker", logging.AgentID, msg.AgentID,
+		"channel", msg.Channel, "content", content)
 
 	// Mark the agent as blocked in Postgres.
 	_, err = pool.Exec(ctx,
@@ -28,13 +28,13 @@ func HandleBlocker(ctx context.Context, pool *pgxpool.Pool, registry *spawn.Agen
 		msg.AgentID,
 	)
 	if err != nil {
-		log.Printf("error marking agent %s as blocked: %v", msg.AgentID[:8], err)
+		logger.Error("failed to mark agent blocked", logging.AgentID, msg.AgentID, "err", err)
 	}
 
 	// Send acknowledgement back via stdin.
 	response := fmt.Sprintf("The orchestrator received your blocker: %q. "+
 		"Please continue with what you can and skip the blocked part for now.", content)
 	if err := registry.Send(msg.AgentID, response); err != nil {
-		log.Printf("error sending response to agent %s: %v", msg.AgentID[:8], err)
+		logger.Error("failed to answer blocker", logging.AgentID, msg.AgentID, "err", err)
 	}
 }
@@ -3,18 +3,26 @@ package monitor
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"time"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/orchestrator/internal/dag"
 	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/merge"
+	"github.com/affanhamid/editor/orchestrator/internal/metrics"
 	"github.com/affanhamid/editor/orchestrator/internal/spawn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var logger = logging.For("monitor")
+
 // TaskUpdatePayload is the JSON payload from task_updates notifications.
 type TaskUpdatePayload struct {
-	ID     int64  `json:"id"`
-	Status string `json:"status"`
+	ID         int64  `json:"id"`
+	Status     string `json:"status"`
+	AssignedTo string `json:"assigned_to"`
+	// Epic is set for tasks that have tasks of their own.
+	Epic bool `json:"epic"`
 }
 
 // MessagePayload is the JSON payload from agent_messages notifications.
@@ -25,52 +33,171 @@ type MessagePayload struct {
 	MsgType string `json:"msg_type"`
 }
 
-// HandleEvents is the main event processing loop.
+// timeoutCheckInterval is how often task timeouts are checked.
+const timeoutCheckInterval = 30 * time.Second
+
+// CloseFinishedAgent closes the stdin of the live agent that owns a task which
+// just reached a terminal status. claude --print exits once its input ends, so
+// this is what lets the Wait path in SpawnSession finalise the agent. The
+// grace period gives the agent time to finish its last turn (commits, messages).
+func CloseFinishedAgent(registry *spawn.AgentRegistry, payload TaskUpdatePayload, grace time.Duration) {
+	agentID := payload.AssignedTo
+	if agentID == "" || !registry.IsAlive(agentID) {
+		return
+	}
+	logger.Info("task finished, closing its agent", logging.TaskID, payload.ID, "status", payload.Status, logging.AgentID, agentID, "grace", grace)
+	time.AfterFunc(grace, func() {
+		// Leave the agent running if it was handed a follow-on task meanwhile.
+		if taskID, ok := registry.TaskID(agentID); ok && taskID != payload.ID {
+			return
+		}
+		if err := registry.Close(agentID); err != nil && registry.IsAlive(agentID) {
+			logger.Error("failed to close agent", logging.AgentID, agentID, "err", err)
+		}
+	})
+}
+
+// markIdle marks the live agent that just completed a task as idle, making it
+// a candidate for the task's successors until its session is closed.
+func markIdle(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, payload TaskUpdatePayload) {
+	agentID := payload.AssignedTo
+	if agentID == "" || !registry.IsOpen(agentID) {
+		return
+	}
+	if taskID, ok := registry.TaskID(agentID); !ok || taskID != payload.ID {
+		return
+	}
+	if err := db.UpdateAgentStatus(ctx, pool, agentID, "idle"); err != nil {
+		logger.Error("failed to mark agent idle", logging.AgentID, agentID, "err", err)
+	}
+}
+
+// HandleEvents is the main event processing loop. Events come from the
+// durable outbox in sequence order; each is acknowledged once handled, so a
+// restarted orchestrator resumes exactly where it stopped, and events
+// recorded while the listen connection was down are handled after it is
+// back rather than reconstructed from current state.
 func HandleEvents(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
 	eventCh <-chan db.Event, projectDir string, config spawn.Config) {
+	var timeoutC <-chan time.Time
+	if config.TaskTimeout > 0 {
+		ticker := time.NewTicker(timeoutCheckInterval)
+		defer ticker.Stop()
+		timeoutC = ticker.C
+	}
+	scopeTicker := time.NewTicker(scopeCheckInterval)
+	defer scopeTicker.Stop()
+	conflictTicker := time.NewTicker(conflictCheckInterval)
+	defer conflictTicker.Stop()
+	if !merge.TrialMergeSupported() {
+		logger.Warn("git is older than 2.38 and cannot merge in memory; branch conflicts are found from overlapping changes only")
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-timeoutC:
+			CheckTimeouts(ctx, pool, registry, config.TaskTimeout)
+		case <-scopeTicker.C:
+			CheckScopes(ctx, pool, registry)
+		case <-conflictTicker.C:
+			StartConflictCheck(ctx, pool, projectDir)
+		case result := <-conflictChecks.results:
+			applyConflicts(ctx, pool, registry, result)
+		case result := <-replans.results:
+			applyReplan(ctx, pool, registry, result, projectDir, config)
 		case event, ok := <-eventCh:
 			if !ok {
 				return
 			}
-			switch event.Channel {
-			case "task_updates":
-				var payload TaskUpdatePayload
-				if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
-					log.Printf("error parsing task_updates payload: %v", err)
-					continue
-				}
-				if payload.Status == "completed" {
-					log.Printf("task %d completed", payload.ID)
-					ready, err := dag.ReadyTasks(ctx, pool)
-					if err != nil {
-						log.Printf("error finding ready tasks: %v", err)
-						continue
-					}
-					for _, task := range ready {
-						if _, err := spawn.SpawnSession(ctx, pool, registry, task, projectDir, config); err != nil {
-							log.Printf("error spawning session for task %d: %v", task.ID, err)
-						}
-					}
-				}
-
-			case "agent_messages":
-				var payload MessagePayload
-				if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
-					log.Printf("error parsing agent_messages payload: %v", err)
-					continue
-				}
-				if payload.MsgType == "blocker" {
-					log.Printf("BLOCKER from agent %s (message %d)", payload.AgentID[:8], payload.ID)
-					HandleBlocker(ctx, pool, registry, payload)
-				}
+			metrics.ObserveEvent(event)
+			handleEvent(ctx, pool, registry, event, projectDir, config)
+			if err := db.AckEvent(ctx, pool, event.Seq); err != nil {
+				logger.Error("failed to acknowledge event", "seq", event.Seq, "err", err)
+			}
+		}
+	}
+}
 
-			case "agent_updates":
-				log.Printf("agent update: %s", event.Payload)
+// handleEvent dispatches one outbox event by the channel that recorded it.
+func handleEvent(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
+	event db.Event, projectDir string, config spawn.Config) {
+	switch event.Channel {
+	case "task_updates":
+		var payload TaskUpdatePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			logger.Error("failed to parse event payload", "channel", event.Channel, "err", err)
+			return
+		}
+		if payload.Epic {
+			// An epic's status follows its tasks, whose own events already
+			// asked for a replan; it only unblocks its dependents.
+			logger.Info("epic status changed", logging.TaskID, payload.ID, "status", payload.Status)
+			if db.IsTerminalStatus(payload.Status) {
+				ScheduleReady(ctx, pool, registry, projectDir, config)
+				spawn.EndTaskSpan(payload.ID, payload.Status)
+			}
+			return
+		}
+		if payload.Status == "completed" {
+			logger.Info("task completed", logging.TaskID, payload.ID)
+			if config.ReuseAgents {
+				markIdle(ctx, pool, registry, payload)
 			}
 		}
+		if db.IsTerminalStatus(payload.Status) {
+			// A finished task unblocks its dependents and frees its file scope.
+			ScheduleReady(ctx, pool, registry, projectDir, config)
+			spawn.EndTaskSpan(payload.ID, payload.Status)
+			CloseFinishedAgent(registry, payload, config.CloseGrace)
+			delete(scopeWarned, payload.ID)
+		}
+		// Adapt the remaining plan to a task that failed for good, or to
+		// tasks that can no longer run.
+		if payload.Status == "failed" {
+			requestReplan(ctx, pool, projectDir, config, dag.ReplanTaskFailed, payload.ID)
+		} else if db.IsTerminalStatus(payload.Status) {
+			checkStuck(ctx, pool, projectDir, config)
+		}
+
+	case "agent_messages":
+		var payload MessagePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			logger.Error("failed to parse event payload", "channel", event.Channel, "err", err)
+			return
+		}
+		// Blockers replayed after a restart may come from agents that are gone.
+		if payload.MsgType == "blocker" && registry.IsOpen(payload.AgentID) {
+			logger.Warn("blocker reported", logging.AgentID, payload.AgentID, "message_id", payload.ID)
+			metrics.Blockers.Inc()
+			HandleBlocker(ctx, pool, registry, payload)
+			metrics.BlockerLatency.Observe(time.Since(event.CreatedAt).Seconds())
+		}
+
+	case "agent_updates":
+		logger.Debug("agent update", "payload", event.Payload)
+		var payload AgentUpdatePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			logger.Error("failed to parse event payload", "channel", event.Channel, "err", err)
+			return
+		}
+		HandleAgentPause(ctx, pool, registry, payload)
+
+	case "swarm_updates":
+		var payload SwarmUpdatePayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			logger.Error("failed to parse event payload", "channel", event.Channel, "err", err)
+			return
+		}
+		HandleSwarmPause(ctx, pool, registry, payload, projectDir, config)
+
+	case "orchestrator_commands":
+		var payload CommandPayload
+		if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+			logger.Error("failed to parse event payload", "channel", event.Channel, "err", err)
+			return
+		}
+		HandleCommand(ctx, pool, registry, payload, projectDir, config)
 	}
 }
@@ -0,0 +1,80 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// AgentUpdatePayload is the JSON payload from agent_updates notifications.
+type AgentUpdatePayload struct {
+	AgentID       string `json:"agent_id"`
+	Status        string `json:"status"`
+	CurrentTaskID *int64 `json:"current_task_id"`
+}
+
+// SwarmUpdatePayload is the JSON payload from swarm_updates notifications.
+type SwarmUpdatePayload struct {
+	Paused bool `json:"paused"`
+}
+
+// HandleAgentPause applies a pause or resume requested by setting an agent's
+// status in Postgres (status 'paused', or any other status while paused) to
+// the agent's process group, and keeps its task's pause clock in step.
+func HandleAgentPause(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, payload AgentUpdatePayload) {
+	agentID := payload.AgentID
+	if !registry.IsAlive(agentID) {
+		return
+	}
+	taskID, _ := registry.TaskID(agentID)
+
+	switch {
+	case payload.Status == "paused" && !registry.IsPaused(agentID):
+		if err := registry.Pause(agentID); err != nil {
+			logger.Error("failed to pause agent", logging.AgentID, agentID, "err", err)
+			return
+		}
+		if err := db.MarkTaskPaused(ctx, pool, taskID); err != nil {
+			logger.Error("failed to record task pause", logging.TaskID, taskID, "err", err)
+		}
+		logger.Info("paused agent", logging.AgentID, agentID, logging.TaskID, taskID)
+
+	case payload.Status != "paused" && registry.IsPaused(agentID):
+		if err := registry.Resume(agentID); err != nil {
+			logger.Error("failed to resume agent", logging.AgentID, agentID, "err", err)
+			return
+		}
+		if err := db.MarkTaskResumed(ctx, pool, taskID); err != nil {
+			logger.Error("failed to record task resume", logging.TaskID, taskID, "err", err)
+		}
+		logger.Info("resumed agent", logging.AgentID, agentID, logging.TaskID, taskID)
+	}
+}
+
+// HandleSwarmPause pauses or resumes every running agent by updating their
+// status, which HandleAgentPause then applies. On resume, tasks that became
+// ready while the swarm was paused are scheduled.
+func HandleSwarmPause(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
+	payload SwarmUpdatePayload, projectDir string, config spawn.Config) {
+	ids := registry.AgentIDs()
+	if payload.Paused {
+		changed, err := db.PauseAgents(ctx, pool, ids)
+		if err != nil {
+			logger.Error("failed to pause swarm", "err", err)
+			return
+		}
+		logger.Info("swarm paused, scheduling stopped", "agents", len(changed))
+		return
+	}
+
+	changed, err := db.ResumeAgents(ctx, pool, ids)
+	if err != nil {
+		logger.Error("failed to resume swarm", "err", err)
+		return
+	}
+	logger.Info("swarm resumed", "agents", len(changed))
+	ScheduleReady(ctx, pool, registry, projectDir, config)
+}
@@ -0,0 +1,224 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replanResult is the planner's answer to a re-planning request.
+type replanResult struct {
+	trigger string
+	taskID  int64
+	revised []dag.Task
+	err     error
+}
+
+// replans tracks re-planning for this run. The planner runs in the
+// background while events keep being handled; its answer is applied by the
+// event loop, which is the only goroutine touching running and count.
+var replans = struct {
+	running   bool
+	count     int
+	exhausted bool
+	results   chan replanResult
+}{results: make(chan replanResult, 1)}
+
+// requestReplan asks the planner to revise the remaining plan, unless a
+// revision is already under way or config.MaxReplans have been made.
+func requestReplan(ctx context.Context, pool *pgxpool.Pool, projectDir string, config spawn.Config, trigger string, taskID int64) {
+	if config.MaxReplans == 0 || ctx.Err() != nil {
+		return
+	}
+	if replans.running {
+		logger.Debug("re-planning already under way", "trigger", trigger, logging.TaskID, taskID)
+		return
+	}
+	if replans.count >= config.MaxReplans {
+		if !replans.exhausted {
+			logger.Warn("re-planning limit reached; the plan is no longer revised", "max_replans", config.MaxReplans)
+			replans.exhausted = true
+		}
+		return
+	}
+	tasks, err := dag.LoadTasks(ctx, pool)
+	if err != nil {
+		logger.Error("failed to load tasks for re-planning", "err", err)
+		return
+	}
+
+	replans.running = true
+	replans.count++
+	logger.Info("re-planning", "trigger", trigger, logging.TaskID, taskID, "attempt", replans.count)
+	req := dag.ReplanRequest{Prompt: config.Prompt, Trigger: trigger, TaskID: taskID, Tasks: tasks}
+	replan := config.Replan
+	if replan == nil {
+		replan = dag.Replan
+	}
+	go func() {
+		revised, err := replan(req, projectDir)
+		select {
+		case replans.results <- replanResult{trigger: trigger, taskID: taskID, revised: revised, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// checkStuck re-plans if pending tasks remain but none can make progress.
+func checkStuck(ctx context.Context, pool *pgxpool.Pool, projectDir string, config spawn.Config) {
+	if config.MaxReplans == 0 {
+		return
+	}
+	stuck, err := db.TasksStuck(ctx, pool)
+	if err != nil {
+		logger.Error("failed to check for stuck tasks", "err", err)
+		return
+	}
+	if stuck {
+		logger.Warn("no task can make progress")
+		requestReplan(ctx, pool, projectDir, config, dag.ReplanStuck, 0)
+	}
+}
+
+// applyReplan diffs the planner's revision against the DAG as it is now,
+// applies the changes and records them.
+func applyReplan(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
+	result replanResult, projectDir string, config spawn.Config) {
+	replans.running = false
+	record := func(diff any, reason string) {
+		if err := db.RecordReplan(ctx, pool, result.trigger, result.taskID, diff, reason); err != nil {
+			logger.Error("failed to record re-planning", "err", err)
+		}
+	}
+	if result.err != nil {
+		logger.Error("re-planning failed", "trigger", result.trigger, "err", result.err)
+		record(nil, result.err.Error())
+		return
+	}
+
+	current, err := dag.LoadTasks(ctx, pool)
+	if err != nil {
+		logger.Error("failed to load tasks for re-planning", "err", err)
+		record(nil, "error: "+err.Error())
+		return
+	}
+	diff, err := dag.DiffPlan(current, result.revised)
+	if err == nil {
+		err = validateAdded(diff.Added)
+	}
+	if err != nil {
+		logger.Warn("revised plan rejected", "trigger", result.trigger, "err", err)
+		record(nil, err.Error())
+		return
+	}
+
+	if err := applyDiff(ctx, pool, &diff); err != nil {
+		logger.Error("failed to apply revised plan", "err", err)
+		record(nil, "error: "+err.Error())
+		return
+	}
+	record(diff, "")
+	logger.Info("revised the plan", "trigger", result.trigger, logging.TaskID, result.taskID,
+		"added", len(diff.Added), "cancelled", len(diff.Cancelled), "updated", len(diff.Updated),
+		"edges_added", len(diff.AddedEdges), "edges_removed", len(diff.RemovedEdges))
+
+	ScheduleReady(ctx, pool, registry, projectDir, config)
+	checkStuck(ctx, pool, projectDir, config)
+}
+
+// validateAdded checks that new tasks can be spawned.
+func validateAdded(tasks []dag.Task) error {
+	for _, t := range tasks {
+		if _, err := spawn.LookupPermissionProfile(t.PermissionProfile); err != nil {
+			return fmt.Errorf("new task %d: %w", t.ID, err)
+		}
+		if err := spawn.ValidateMCPServers(t.MCPServers); err != nil {
+			return fmt.Errorf("new task %d: %w", t.ID, err)
+		}
+	}
+	return nil
+}
+
+// applyDiff writes a revision to tasks and task_edges in one transaction,
+// renumbering the diff with the IDs of the tasks it creates. Dependents are
+// rewired before the tasks they no longer need are cancelled. On error
+// nothing is changed.
+func applyDiff(ctx context.Context, pool *pgxpool.Pool, diff *dag.Diff) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	ids := make(map[int64]int64, len(diff.Added))
+	newID := func(id int64) int64 {
+		if n, ok := ids[id]; ok {
+			return n
+		}
+		return id
+	}
+
+	for _, t := range dag.ParentsFirst(diff.Added) {
+		id, err := db.CreateTask(ctx, tx, db.NewTask{
+			Title:              t.Title,
+			Description:        t.Description,
+			RiskLevel:          t.RiskLevel,
+			Domains:            t.Domains,
+			AcceptanceCriteria: t.AcceptanceCriteria,
+			PermissionProfile:  t.PermissionProfile,
+			MCPServers:         t.MCPServers,
+			FileScope:          t.FileScope,
+			AllowOverlap:       t.AllowOverlap,
+			ParentID:           newID(t.ParentID),
+		})
+		if err != nil {
+			return fmt.Errorf("add task %q: %w", t.Title, err)
+		}
+		ids[t.ID] = id
+	}
+	for _, e := range diff.RemovedEdges {
+		if _, err := db.DeleteEdge(ctx, tx, e.From, e.To); err != nil {
+			return fmt.Errorf("remove edge %d → %d: %w", e.From, e.To, err)
+		}
+	}
+	for _, e := range diff.AddedEdges {
+		if err := db.InsertEdge(ctx, tx, newID(e.From), newID(e.To)); err != nil {
+			return fmt.Errorf("add edge %d → %d: %w", newID(e.From), newID(e.To), err)
+		}
+	}
+	for _, t := range diff.Updated {
+		if err := db.UpdateTaskFields(ctx, tx, t.ID, nonEmpty(t.Title), nonEmpty(t.Description), nonEmpty(t.RiskLevel), nil); err != nil {
+			return fmt.Errorf("update task %d: %w", t.ID, err)
+		}
+	}
+	for _, id := range diff.Cancelled {
+		if err := db.CancelTask(ctx, tx, id); err != nil {
+			return fmt.Errorf("cancel task %d: %w", id, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	diff.Renumber(ids)
+	for _, t := range diff.Added {
+		logger.Info("added task", logging.TaskID, t.ID, "title", t.Title)
+	}
+	for _, id := range diff.Cancelled {
+		logger.Info("cancelled task", logging.TaskID, id)
+	}
+	return nil
+}
+
+// nonEmpty returns a pointer to s, or nil if s is empty.
+func nonEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
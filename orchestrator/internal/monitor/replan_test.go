@@ -0,0 +1,64 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/dbtest"
+)
+
+func TestApplyDiff(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	ctx := context.Background()
+	a := newTask(t, pool, "a")
+	b := newTask(t, pool, "b", a)
+
+	diff := dag.Diff{
+		Added:        []dag.Task{{ID: -1, Title: "new", RiskLevel: "low"}},
+		AddedEdges:   []dag.Edge{{From: -1, To: b}},
+		RemovedEdges: []dag.Edge{{From: a, To: b}},
+		Cancelled:    []int64{a},
+	}
+	if err := applyDiff(ctx, pool, &diff); err != nil {
+		t.Fatal(err)
+	}
+	added := diff.Added[0].ID
+	if added <= 0 || diff.AddedEdges[0] != (dag.Edge{From: added, To: b}) {
+		t.Errorf("expected the diff to be renumbered, got %+v", diff)
+	}
+	upstream, err := db.UpstreamTasks(ctx, pool, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(upstream) != 1 || upstream[0].ID != added {
+		t.Errorf("expected %d to be blocked by the new task only, got %+v", b, upstream)
+	}
+	if status := taskStatus(t, pool, a); status != "cancelled" {
+		t.Errorf("expected %d to be cancelled, got %s", a, status)
+	}
+}
+
+func TestApplyDiffRollsBack(t *testing.T) {
+	pool := dbtest.Open(t, "monitor")
+	ctx := context.Background()
+	a := newTask(t, pool, "a")
+
+	// The edge to a task that does not exist fails after the task is added.
+	diff := dag.Diff{
+		Added:      []dag.Task{{ID: -1, Title: "new", RiskLevel: "low"}},
+		AddedEdges: []dag.Edge{{From: -1, To: 999}},
+		Cancelled:  []int64{a},
+	}
+	if err := applyDiff(ctx, pool, &diff); err == nil {
+		t.Fatal("expected an error")
+	}
+	tasks, err := db.ListTasks(ctx, pool, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != a || tasks[0].Status != "pending" {
+		t.Errorf("expected the failed diff to change nothing, got %+v", tasks)
+	}
+}
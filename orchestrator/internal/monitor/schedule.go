@@ -0,0 +1,88 @@
+package monitor
+
+import (
+	"context"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/metrics"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ScheduleReady starts work on every ready task unless the swarm is paused.
+// With config.ReuseAgents set, a task is first offered to an idle agent that
+// finished one of its direct parents; otherwise a fresh session is spawned.
+// A task whose file scope overlaps that of a running task waits until the
+// other finishes. Ready tasks left without an agent are counted in
+// metrics.QueueDepth.
+func ScheduleReady(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
+	projectDir string, config spawn.Config) {
+	ready, err := dag.ReadyTasks(ctx, pool)
+	if err != nil {
+		logger.Error("failed to find ready tasks", "err", err)
+		return
+	}
+	metrics.QueueDepth.Set(float64(len(ready)))
+
+	paused, err := db.SwarmPaused(ctx, pool)
+	if err != nil {
+		logger.Error("failed to read swarm state", "err", err)
+		return
+	}
+	if paused {
+		logger.Info("swarm is paused, not scheduling")
+		return
+	}
+
+	running, err := dag.RunningTasks(ctx, pool)
+	if err != nil {
+		logger.Error("failed to find running tasks", "err", err)
+		return
+	}
+
+	for _, task := range ready {
+		if other, ok := scopeConflict(task, running); ok {
+			logger.Debug("holding task back: its file scope overlaps a running task",
+				logging.TaskID, task.ID, "running_task", other.ID)
+			continue
+		}
+		if config.ReuseAgents && reuseIdleAgent(ctx, pool, registry, task, config) {
+			metrics.QueueDepth.Add(-1)
+			running = append(running, task)
+			continue
+		}
+		agentID, err := spawn.SpawnSession(ctx, pool, registry, task, projectDir, config)
+		if err != nil {
+			logger.Error("failed to spawn session", logging.TaskID, task.ID, "err", err)
+			continue
+		}
+		if agentID == "" {
+			// Claimed elsewhere meanwhile; no session of ours holds its scope.
+			continue
+		}
+		metrics.QueueDepth.Add(-1)
+		running = append(running, task)
+	}
+}
+
+// reuseIdleAgent tries each idle parent agent in turn and reports whether one took the task.
+func reuseIdleAgent(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry,
+	task dag.Task, config spawn.Config) bool {
+	idle, err := db.IdleParentAgents(ctx, pool, task.ID)
+	if err != nil {
+		logger.Error("failed to find idle agents", logging.TaskID, task.ID, "err", err)
+		return false
+	}
+	for _, agent := range idle {
+		reused, err := spawn.ReuseSession(ctx, pool, registry, agent, task, config)
+		if err != nil {
+			logger.Error("failed to reuse agent", logging.AgentID, agent.AgentID, logging.TaskID, task.ID, "err", err)
+		}
+		if reused {
+			return true
+		}
+	}
+	return false
+}
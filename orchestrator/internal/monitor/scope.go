@@ -0,0 +1,79 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// scopeCheckInterval is how often agents' changed files are compared with
+// their task's file scope.
+const scopeCheckInterval = time.Minute
+
+// scopeWarned holds, per task, the files outside its scope that were
+// already reported. Only the event loop touches it.
+var scopeWarned = map[int64]map[string]bool{}
+
+// scopeConflict returns a running task that task must not run alongside.
+func scopeConflict(task dag.Task, running []dag.Task) (dag.Task, bool) {
+	for _, other := range running {
+		if other.ID != task.ID && task.ConflictsWith(other) {
+			return other, true
+		}
+	}
+	return dag.Task{}, false
+}
+
+// CheckScopes compares the files each agent has changed with its task's
+// declared file scope. Files outside it are reported once, on the general
+// channel and to the agent itself.
+func CheckScopes(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry) {
+	tasks, err := db.ScopedTasks(ctx, pool)
+	if err != nil {
+		logger.Error("failed to find scoped tasks", "err", err)
+		return
+	}
+	for _, t := range tasks {
+		files, err := spawn.ChangedFiles(t.WorktreePath, t.BaseSHA)
+		if err != nil {
+			logger.Warn("failed to list changed files", logging.TaskID, t.ID, "err", err)
+			continue
+		}
+		warned := scopeWarned[t.ID]
+		if warned == nil {
+			warned = map[string]bool{}
+			scopeWarned[t.ID] = warned
+		}
+		var outside []string
+		for _, f := range files {
+			if !warned[f] && !dag.InScope(f, t.FileScope) {
+				outside = append(outside, f)
+				warned[f] = true
+			}
+		}
+		if len(outside) == 0 {
+			continue
+		}
+
+		logger.Warn("agent changed files outside its task's file scope", logging.TaskID, t.ID,
+			logging.AgentID, t.AgentID, "files", outside)
+		msg := fmt.Sprintf("Task #%d changed files outside its file scope (%s): %s",
+			t.ID, strings.Join(t.FileScope, ", "), strings.Join(outside, ", "))
+		if err := db.PostMessage(ctx, pool, "orchestrator", "general", "warning", msg, t.ID); err != nil {
+			logger.Error("failed to post scope warning", logging.TaskID, t.ID, "err", err)
+		}
+		if registry.IsOpen(t.AgentID) {
+			if err := registry.Send(t.AgentID, msg+". Other tasks may be changing these files: "+
+				"keep to your scope, or coordinate through post_message first."); err != nil {
+				logger.Error("failed to warn agent", logging.AgentID, t.AgentID, "err", err)
+			}
+		}
+	}
+}
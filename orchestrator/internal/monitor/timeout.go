@@ -0,0 +1,33 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CheckTimeouts fails tasks whose active time, not counting time spent
+// paused, exceeds timeout, and terminates their agents.
+func CheckTimeouts(ctx context.Context, pool *pgxpool.Pool, registry *spawn.AgentRegistry, timeout time.Duration) {
+	tasks, err := db.TimedOutTasks(ctx, pool, timeout)
+	if err != nil {
+		logger.Error("failed to check task timeouts", "err", err)
+		return
+	}
+	for _, t := range tasks {
+		logger.Warn("task timed out, stopping its agent", logging.TaskID, t.ID, logging.AgentID, t.AssignedTo, "timeout", timeout)
+		if err := db.TimeOutTask(ctx, pool, t.ID, fmt.Sprintf("timed out after %s of active work", timeout)); err != nil {
+			logger.Error("failed to fail task", logging.TaskID, t.ID, "err", err)
+			continue
+		}
+		if err := registry.Signal(t.AssignedTo, syscall.SIGTERM); err != nil && registry.IsAlive(t.AssignedTo) {
+			logger.Error("failed to terminate agent", logging.AgentID, t.AssignedTo, "err", err)
+		}
+	}
+}
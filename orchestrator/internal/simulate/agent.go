@@ -0,0 +1,300 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/google/uuid"
+)
+
+// taskPattern finds the task an agent is given in its initial prompt or
+// in the prompt of a follow-on task (see spawn.SpawnSession and reuse).
+var taskPattern = regexp.MustCompile(`working on task #(\d+): ("(?:[^"\\]|\\.)*")`)
+
+// RunAgent runs a fake agent in the current directory, an agent worktree,
+// in place of claude: it reads stream-json user messages on stdin, acts out
+// the script for the task it is given and writes stream-json events on
+// stdout. It returns the process's exit code.
+func RunAgent(args []string) int {
+	fs := flag.NewFlagSet(spawn.SimulatedAgentCommand, flag.ContinueOnError)
+	scriptPath := fs.String("script", "", "Path to the simulation script")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	script, err := LoadScript(*scriptPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+
+	a := newAgent(script, dir, os.Stdout)
+	defer func() {
+		if a.tools != nil {
+			a.tools.Close()
+		}
+	}()
+	code, err := a.run(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "simulate: %v\n", err)
+		return 1
+	}
+	return code
+}
+
+// agent is a fake agent working through the steps of its current task.
+type agent struct {
+	script    *Script
+	dir       string
+	out       *json.Encoder
+	sessionID string
+	// tools is started on the first tool call.
+	tools toolCaller
+
+	taskID int64
+	steps  []Step
+	turns  int
+}
+
+func newAgent(script *Script, dir string, out io.Writer) *agent {
+	return &agent{script: script, dir: dir, out: json.NewEncoder(out), sessionID: uuid.New().String()}
+}
+
+// run handles messages until stdin ends or a step exits.
+func (a *agent) run(in io.Reader) (int, error) {
+	a.emit(map[string]any{"type": "system", "subtype": "init", "session_id": a.sessionID,
+		"cwd": a.dir, "model": "simulated"})
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg struct {
+			Type    string `json:"type"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.Type != "user" {
+			continue
+		}
+		if code, exited := a.turn(msg.Message.Content); exited {
+			return code, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// turn answers one user message, running steps until the script waits,
+// runs out or exits.
+func (a *agent) turn(message string) (int, bool) {
+	start := time.Now()
+	a.turns++
+	if m := taskPattern.FindStringSubmatch(message); m != nil {
+		if err := a.begin(m[1], m[2]); err != nil {
+			a.say(fmt.Sprintf("Cannot start the task: %v", err))
+		}
+	}
+
+	if len(a.steps) == 0 {
+		a.say("Nothing more to do.")
+	}
+	for len(a.steps) > 0 {
+		step := a.steps[0]
+		a.steps = a.steps[1:]
+		if step.Wait {
+			break
+		}
+		if step.Exit != nil {
+			a.result(start, *step.Exit != 0, fmt.Sprintf("exited with status %d", *step.Exit))
+			return *step.Exit, true
+		}
+		a.do(step)
+	}
+	a.result(start, false, "turn finished")
+	return 0, false
+}
+
+// begin starts the next attempt at a task.
+func (a *agent) begin(id, quotedTitle string) error {
+	taskID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	title, err := strconv.Unquote(quotedTitle)
+	if err != nil {
+		return err
+	}
+	attempt, err := nextAttempt(a.dir, taskID)
+	if err != nil {
+		return err
+	}
+	a.taskID = taskID
+	a.steps = a.script.Steps(title, attempt)
+	a.say(fmt.Sprintf("Starting attempt %d at task #%d: %s", attempt, taskID, title))
+	return nil
+}
+
+// do performs a step other than wait and exit.
+func (a *agent) do(step Step) {
+	switch {
+	case step.Say != "":
+		a.say(step.Say)
+	case step.SleepMS > 0:
+		time.Sleep(time.Duration(step.SleepMS) * time.Millisecond)
+	case step.Commit != nil:
+		a.commit(*step.Commit)
+	case step.Status != "":
+		args := map[string]any{"task_id": a.taskID, "status": step.Status}
+		if step.Output != "" {
+			args["output"] = step.Output
+		}
+		a.callTool("update_task", args)
+	case step.Tool != nil:
+		args := make(map[string]any, len(step.Tool.Args))
+		for k, v := range step.Tool.Args {
+			if v == TaskIDArg {
+				v = a.taskID
+			}
+			args[k] = v
+		}
+		a.callTool(step.Tool.Name, args)
+	}
+}
+
+// commit writes the step's files and commits all of the agent's changes,
+// reported as a Bash tool call.
+func (a *agent) commit(c Commit) {
+	id := a.toolUse("Bash", map[string]any{"command": fmt.Sprintf("git add -A && git commit -m %q", c.Message)})
+	for name, content := range c.Files {
+		path := filepath.Join(a.dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			a.toolResult(id, err.Error(), true)
+			return
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			a.toolResult(id, err.Error(), true)
+			return
+		}
+	}
+	sha, err := spawn.CommitWIP(a.dir, c.Message)
+	switch {
+	case err != nil:
+		a.toolResult(id, err.Error(), true)
+	case sha == "":
+		a.toolResult(id, "nothing to commit", false)
+	default:
+		a.toolResult(id, "committed "+sha, false)
+	}
+}
+
+// callTool calls an mcp-pg tool, starting mcp-pg on first use.
+func (a *agent) callTool(name string, args map[string]any) {
+	id := a.toolUse("mcp__"+spawn.ArchitectServerName+"__"+name, args)
+	if a.tools == nil {
+		tools, err := startMCP(a.dir)
+		if err != nil {
+			a.toolResult(id, fmt.Sprintf("mcp-pg: %v", err), true)
+			return
+		}
+		a.tools = tools
+	}
+	text, isError, err := a.tools.CallTool(name, args)
+	if err != nil {
+		text, isError = err.Error(), true
+	}
+	a.toolResult(id, text, isError)
+}
+
+func (a *agent) say(text string) {
+	a.emit(map[string]any{"type": "assistant", "session_id": a.sessionID, "message": map[string]any{
+		"role": "assistant", "content": []any{map[string]any{"type": "text", "text": text}},
+	}})
+}
+
+// toolUse reports a tool call and returns its ID.
+func (a *agent) toolUse(name string, input map[string]any) string {
+	id := "toolu_" + strings.ReplaceAll(uuid.New().String(), "-", "")
+	a.emit(map[string]any{"type": "assistant", "session_id": a.sessionID, "message": map[string]any{
+		"role": "assistant", "content": []any{map[string]any{"type": "tool_use", "id": id, "name": name, "input": input}},
+	}})
+	return id
+}
+
+func (a *agent) toolResult(id, text string, isError bool) {
+	a.emit(map[string]any{"type": "user", "session_id": a.sessionID, "message": map[string]any{
+		"role": "user", "content": []any{map[string]any{"type": "tool_result", "tool_use_id": id,
+			"content": text, "is_error": isError}},
+	}})
+}
+
+// result ends a turn the way claude does.
+func (a *agent) result(start time.Time, isError bool, text string) {
+	subtype := "success"
+	if isError {
+		subtype = "error_during_execution"
+	}
+	a.emit(map[string]any{"type": "result", "subtype": subtype, "is_error": isError,
+		"session_id": a.sessionID, "result": text, "num_turns": a.turns,
+		"duration_ms": time.Since(start).Milliseconds(), "total_cost_usd": 0})
+}
+
+func (a *agent) emit(event map[string]any) {
+	_ = a.out.Encode(event)
+}
+
+// attemptsDir is where the attempts at each task are counted: the
+// repository's common git directory, shared by agents and their worktrees.
+func attemptsDir(dir string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-common-dir")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("find git directory: %w", err)
+	}
+	return filepath.Join(strings.TrimSpace(string(out)), "architect-simulate"), nil
+}
+
+// ResetAttempts forgets the attempts counted in the repository at dir. A
+// simulated run starts with it, since task IDs are reused after a clean.
+func ResetAttempts(dir string) error {
+	stateDir, err := attemptsDir(dir)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(stateDir)
+}
+
+// nextAttempt counts the attempts at a task, across agents and their
+// worktrees.
+func nextAttempt(dir string, taskID int64) (int, error) {
+	stateDir, err := attemptsDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return 0, err
+	}
+	path := filepath.Join(stateDir, fmt.Sprintf("task-%d", taskID))
+	attempt := 1
+	if data, err := os.ReadFile(path); err == nil {
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			attempt = n + 1
+		}
+	}
+	return attempt, os.WriteFile(path, []byte(strconv.Itoa(attempt)+"\n"), 0644)
+}
@@ -0,0 +1,182 @@
+package simulate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubTools records tool calls instead of calling mcp-pg.
+type stubTools struct {
+	calls []string
+}
+
+func (s *stubTools) CallTool(name string, args map[string]any) (string, bool, error) {
+	data, _ := json.Marshal(args)
+	s.calls = append(s.calls, name+" "+string(data))
+	return "ok", false, nil
+}
+
+func (s *stubTools) Close() error { return nil }
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	for k, v := range map[string]string{
+		"GIT_AUTHOR_NAME": "test", "GIT_AUTHOR_EMAIL": "test@example.com",
+		"GIT_COMMITTER_NAME": "test", "GIT_COMMITTER_EMAIL": "test@example.com",
+	} {
+		t.Setenv(k, v)
+	}
+	dir := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	return dir
+}
+
+// userMessage is a message as spawn.AgentRegistry sends it.
+func userMessage(text string) string {
+	data, _ := json.Marshal(map[string]any{"type": "user", "message": map[string]any{"role": "user", "content": text}})
+	return string(data) + "\n"
+}
+
+// events decodes the agent's stream-json output.
+func events(t *testing.T, out *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var evs []map[string]any
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		var ev map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("output line %q: %v", scanner.Text(), err)
+		}
+		evs = append(evs, ev)
+	}
+	return evs
+}
+
+func count(evs []map[string]any, typ string) int {
+	n := 0
+	for _, ev := range evs {
+		if ev["type"] == typ {
+			n++
+		}
+	}
+	return n
+}
+
+func TestAgentRun(t *testing.T) {
+	dir := initRepo(t)
+	script, err := ParseScript([]byte(`{
+		"plan": ` + testPlan + `,
+		"agents": {
+			"Write greeting": [
+				[{"commit": {"message": "Start greeting", "files": {"hello.txt": "hi\n"}}}, {"exit": 3}],
+				[
+					{"commit": {"message": "Add greeting", "files": {"greet/hello.txt": "hello\n"}}},
+					{"tool": {"name": "post_message", "args": {"channel": "help", "content": "stuck", "ref_task_id": "$task_id"}}},
+					{"status": "blocked", "output": "waiting for help"},
+					{"wait": true},
+					{"status": "completed", "output": "done"}
+				]
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prompt := userMessage(fmt.Sprintf("You are working on task #%d: %q\n\nWrite it.", 7, "Write greeting"))
+
+	// The first attempt commits and crashes.
+	var out bytes.Buffer
+	a := newAgent(script, dir, &out)
+	a.tools = &stubTools{}
+	code, err := a.run(strings.NewReader(prompt + userMessage("never read")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != 3 {
+		t.Errorf("first attempt exited with %d, want 3", code)
+	}
+	evs := events(t, &out)
+	if evs[0]["type"] != "system" || count(evs, "result") != 1 {
+		t.Errorf("first attempt: got %v, want an init event and one result", evs)
+	}
+
+	// The second attempt blocks, and completes once answered.
+	out.Reset()
+	tools := &stubTools{}
+	a = newAgent(script, dir, &out)
+	a.tools = tools
+	code, err = a.run(strings.NewReader(prompt + userMessage("Here is help.") + userMessage("Anything else?")))
+	if err != nil || code != 0 {
+		t.Fatalf("second attempt: exit %d, %v", code, err)
+	}
+	want := []string{
+		`post_message {"channel":"help","content":"stuck","ref_task_id":7}`,
+		`update_task {"output":"waiting for help","status":"blocked","task_id":7}`,
+		`update_task {"output":"done","status":"completed","task_id":7}`,
+	}
+	if strings.Join(tools.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("tool calls:\n%s\nwant:\n%s", strings.Join(tools.calls, "\n"), strings.Join(want, "\n"))
+	}
+	if n := count(events(t, &out), "result"); n != 3 {
+		t.Errorf("second attempt: got %d results, want one per message", n)
+	}
+
+	cmd := exec.Command("git", "log", "--format=%s")
+	cmd.Dir = dir
+	log, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(log)); strings.Join(got, " ") != "Add greeting Start greeting init" {
+		t.Errorf("commits: got %q", log)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "greet", "hello.txt")); err != nil || string(data) != "hello\n" {
+		t.Errorf("greet/hello.txt = %q, %v", data, err)
+	}
+}
+
+func TestResetAttempts(t *testing.T) {
+	dir := initRepo(t)
+	for want := 1; want <= 2; want++ {
+		if got, err := nextAttempt(dir, 4); err != nil || got != want {
+			t.Fatalf("nextAttempt = %d, %v; want %d", got, err, want)
+		}
+	}
+	if err := ResetAttempts(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := nextAttempt(dir, 4); err != nil || got != 1 {
+		t.Errorf("after reset, nextAttempt = %d, %v; want 1", got, err)
+	}
+}
+
+func TestTaskPattern(t *testing.T) {
+	for _, msg := range []string{
+		fmt.Sprintf("You are working on task #12: %q\n\nbody", `Say "hi"`),
+		fmt.Sprintf("Task #3 is done. You are now working on task #12: %q\n\nbody", `Say "hi"`),
+	} {
+		m := taskPattern.FindStringSubmatch(msg)
+		if m == nil || m[1] != "12" || m[2] != `"Say \"hi\""` {
+			t.Errorf("%q: got %q", msg, m)
+		}
+	}
+}
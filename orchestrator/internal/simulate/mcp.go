@@ -0,0 +1,157 @@
+package simulate
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+)
+
+// toolCaller calls the coordination tools. It is mcp-pg, or a stub in tests.
+type toolCaller interface {
+	// CallTool returns the text of the tool's result, and whether the tool
+	// reported an error.
+	CallTool(name string, args map[string]any) (string, bool, error)
+	Close() error
+}
+
+// mcpClient talks to an mcp-pg process over stdio, the way claude does.
+type mcpClient struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID int
+}
+
+// startMCP starts the architect-pg server of the .mcp.json in dir and
+// initializes the session.
+func startMCP(dir string) (*mcpClient, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ".mcp.json"))
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		MCPServers map[string]struct {
+			Command string            `json:"command"`
+			Args    []string          `json:"args"`
+			Env     map[string]string `json:"env"`
+		} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse .mcp.json: %w", err)
+	}
+	server, ok := config.MCPServers[spawn.ArchitectServerName]
+	if !ok {
+		return nil, fmt.Errorf(".mcp.json has no %s server", spawn.ArchitectServerName)
+	}
+
+	cmd := exec.Command(server.Command, server.Args...)
+	cmd.Dir = dir
+	cmd.Env = os.Environ()
+	for k, v := range server.Env {
+		// As claude does, ${VAR} in .mcp.json refers to its own environment.
+		cmd.Env = append(cmd.Env, k+"="+os.ExpandEnv(v))
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", server.Command, err)
+	}
+
+	c := &mcpClient{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	if _, err := c.call("initialize", map[string]any{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    map[string]any{},
+		"clientInfo":      map[string]any{"name": "architect-simulate", "version": "1"},
+	}); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	if err := c.send(map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"}); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *mcpClient) CallTool(name string, args map[string]any) (string, bool, error) {
+	raw, err := c.call("tools/call", map[string]any{"name": name, "arguments": args})
+	if err != nil {
+		return "", false, err
+	}
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+		IsError bool `json:"isError"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", false, fmt.Errorf("parse %s result: %w", name, err)
+	}
+	var text []string
+	for _, c := range result.Content {
+		if c.Type == "text" {
+			text = append(text, c.Text)
+		}
+	}
+	return strings.Join(text, "\n"), result.IsError, nil
+}
+
+// call sends a request and waits for its response, skipping notifications.
+func (c *mcpClient) call(method string, params any) (json.RawMessage, error) {
+	c.nextID++
+	id := c.nextID
+	if err := c.send(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return nil, err
+	}
+	for {
+		line, err := c.stdout.ReadBytes('\n')
+		if err != nil {
+			return nil, fmt.Errorf("read %s response: %w", method, err)
+		}
+		var resp struct {
+			ID     *int            `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(line, &resp); err != nil || resp.ID == nil || *resp.ID != id {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("%s: %s (code %d)", method, resp.Error.Message, resp.Error.Code)
+		}
+		return resp.Result, nil
+	}
+}
+
+func (c *mcpClient) send(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = c.stdin.Write(append(data, '\n'))
+	return err
+}
+
+// Close ends the session; mcp-pg exits when its stdin closes.
+func (c *mcpClient) Close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
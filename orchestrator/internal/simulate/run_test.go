@@ -0,0 +1,116 @@
+package simulate
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/dbtest"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestRun runs the orchestrator on testdata/retry-and-merge.json against the
+// database at TEST_DATABASE_URL, whose tables it empties. The greeting's
+// first agent crashes and the task is retried; the card's agent starts from
+// both parents' branches merged.
+func TestRun(t *testing.T) {
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	if testing.Short() {
+		t.Skip("builds and runs the orchestrator")
+	}
+	repo := initRepo(t)
+	script, err := filepath.Abs(filepath.Join("testdata", "retry-and-merge.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	pool := dbtest.Reset(ctx, t, dbURL)
+
+	bin := t.TempDir()
+	architect, mcpPg := filepath.Join(bin, "architect"), filepath.Join(bin, "mcp-pg")
+	goBuild(t, "../..", architect)
+	goBuild(t, "../../../mcp-pg", mcpPg)
+
+	var logs bytes.Buffer
+	cmd := exec.Command(architect, "--simulate", script, "--project", repo, "--db", dbURL,
+		"--mcp-pg", mcpPg, "--agent-db-roles=false", "--close-grace=1s", "--shutdown-grace=5s")
+	cmd.Stdout, cmd.Stderr = &logs, &logs
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = cmd.Process.Signal(syscall.SIGINT)
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case <-done:
+		case <-time.After(15 * time.Second):
+			_ = cmd.Process.Kill()
+			<-done
+		}
+		if t.Failed() {
+			t.Logf("orchestrator output:\n%s", logs.String())
+		}
+	}()
+
+	waitFor(ctx, t, `SELECT status = 'failed' FROM tasks WHERE title = 'Write greeting'`, pool)
+	var greeting int64
+	if err := pool.QueryRow(ctx, `SELECT id FROM tasks WHERE title = 'Write greeting'`).Scan(&greeting); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.IssueCommand(ctx, pool, "retry_task", map[string]int64{"task_id": greeting}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(ctx, t, `SELECT count(*) = 3 FROM tasks WHERE status = 'completed'`, pool)
+
+	var branch string
+	if err := pool.QueryRow(ctx, `SELECT branch FROM tasks WHERE title = 'Write card'`).Scan(&branch); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string]string{"hello.txt": "hello\n", "bye.txt": "bye\n", "card.txt": "hello, and bye\n"} {
+		show := exec.Command("git", "show", branch+":"+file)
+		show.Dir = repo
+		got, err := show.Output()
+		if err != nil || string(got) != want {
+			t.Errorf("%s on %s = %q, %v; want %q", file, branch, got, err, want)
+		}
+	}
+}
+
+func goBuild(t *testing.T, dir, out string) {
+	t.Helper()
+	cmd := exec.Command("go", "build", "-o", out, ".")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build %s: %v\n%s", dir, err, output)
+	}
+}
+
+// waitFor polls a query returning a boolean until it is true.
+func waitFor(ctx context.Context, t *testing.T, query string, pool *pgxpool.Pool) {
+	t.Helper()
+	for {
+		var ok bool
+		err := pool.QueryRow(ctx, query).Scan(&ok)
+		if err == nil && ok {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s (last error: %v)", strings.Join(strings.Fields(query), " "), err)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
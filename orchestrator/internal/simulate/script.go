@@ -0,0 +1,232 @@
+// Package simulate runs the orchestrator against scripted fake agents, so a
+// whole run (retries, blockers, merges) can be exercised deterministically
+// without the claude CLI.
+//
+// A script is a JSON file holding the plan to run, in place of the
+// planner's, and what the agent of each task does:
+//
+//	{
+//	  "prompt": "Add a greeting",
+//	  "plan": {"tasks": [{"id": 1, "title": "Write greeting", ...}]},
+//	  "auto_approve": false,
+//	  "replans": [{"tasks": [{"id": -1, "title": "Greet differently", ...}]}],
+//	  "agents": {
+//	    "Write greeting": [
+//	      [{"commit": {"message": "WIP", "files": {"hello.txt": "hi\n"}}}, {"exit": 1}],
+//	      [{"commit": {"message": "Greet", "files": {"hello.txt": "hello\n"}}}, {"status": "completed"}]
+//	    ]
+//	  }
+//	}
+//
+// The plan runs without review unless auto_approve is false, in which case
+// it waits for approval like a planner's plan. Replans are the planner's
+// answers to successive re-planning requests, in the format of a revision
+// (see dag.ReplanRequest); max_replans, the re-planning limit, defaults to
+// their number. The orchestrator's --auto-approve and --max-replans flags
+// override both.
+//
+// Agents are keyed by task title. Each entry lists the steps of successive
+// attempts at the task; attempts beyond the last repeat it. Tasks without
+// an entry follow "default", or are completed straight away.
+//
+// testdata/retry-and-merge.json is a complete example: an agent that
+// crashes, and a task whose agent starts from its parents' merged branches.
+package simulate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+)
+
+// TaskIDArg stands for the task's ID in the arguments of a tool step.
+const TaskIDArg = "$task_id"
+
+// Script is a parsed simulation script.
+type Script struct {
+	Prompt string
+	Plan   *dag.DAG
+	// AutoApprove runs the plan without review.
+	AutoApprove bool
+	// Replans are the planner's revisions, in the order Replan returns them.
+	Replans    [][]dag.Task
+	MaxReplans int
+	// Agents maps task titles to the steps of each attempt.
+	Agents  map[string][][]Step
+	Default []Step
+
+	mu          sync.Mutex
+	replansDone int
+}
+
+// Step is one action of a fake agent. Exactly one field is set.
+type Step struct {
+	// Say writes an assistant message.
+	Say string `json:"say,omitempty"`
+	// Tool calls an mcp-pg tool.
+	Tool *ToolCall `json:"tool,omitempty"`
+	// Commit writes files and commits everything the agent changed.
+	Commit *Commit `json:"commit,omitempty"`
+	// Status reports the task's status through update_task, with Output.
+	Status string `json:"status,omitempty"`
+	Output string `json:"output,omitempty"`
+	// Wait ends the turn; the next step runs when a message arrives.
+	Wait bool `json:"wait,omitempty"`
+	// SleepMS pauses the agent.
+	SleepMS int `json:"sleep_ms,omitempty"`
+	// Exit ends the process with the given exit code.
+	Exit *int `json:"exit,omitempty"`
+}
+
+// ToolCall is a call of an mcp-pg tool. String arguments equal to
+// TaskIDArg are replaced by the task's ID.
+type ToolCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// Commit is a commit made by a fake agent. Files maps paths relative to
+// the worktree to their new content.
+type Commit struct {
+	Message string            `json:"message"`
+	Files   map[string]string `json:"files,omitempty"`
+}
+
+// completeStep is what agents without a script do.
+var completeStep = Step{Status: "completed", Output: "Done (simulated)."}
+
+// LoadScript reads and checks a simulation script.
+func LoadScript(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ParseScript(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ParseScript parses a simulation script. The plan must be runnable and
+// every scripted agent must belong to one of its tasks.
+func ParseScript(data []byte) (*Script, error) {
+	var raw struct {
+		Prompt      string              `json:"prompt"`
+		Plan        json.RawMessage     `json:"plan"`
+		AutoApprove *bool               `json:"auto_approve"`
+		Replans     []json.RawMessage   `json:"replans"`
+		MaxReplans  *int                `json:"max_replans"`
+		Agents      map[string][][]Step `json:"agents"`
+		Default     []Step              `json:"default"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse script: %w", err)
+	}
+	if raw.Plan == nil {
+		return nil, fmt.Errorf("script has no plan")
+	}
+	plan, err := dag.ParsePlan(raw.Plan)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := make(map[string]bool, len(plan.Tasks))
+	for _, t := range plan.Tasks {
+		titles[t.Title] = true
+	}
+	for title, attempts := range raw.Agents {
+		if !titles[title] {
+			return nil, fmt.Errorf("agents: no task is titled %q", title)
+		}
+		for i, steps := range attempts {
+			if err := checkSteps(steps); err != nil {
+				return nil, fmt.Errorf("agents[%q][%d]: %w", title, i, err)
+			}
+		}
+	}
+	if err := checkSteps(raw.Default); err != nil {
+		return nil, fmt.Errorf("default: %w", err)
+	}
+
+	s := &Script{Prompt: raw.Prompt, Plan: plan, AutoApprove: true, MaxReplans: len(raw.Replans),
+		Agents: raw.Agents, Default: raw.Default}
+	if raw.AutoApprove != nil {
+		s.AutoApprove = *raw.AutoApprove
+	}
+	if raw.MaxReplans != nil {
+		if *raw.MaxReplans < 0 {
+			return nil, fmt.Errorf("max_replans must not be negative")
+		}
+		s.MaxReplans = *raw.MaxReplans
+	}
+	for i, r := range raw.Replans {
+		tasks, err := dag.ParseRevision(r)
+		if err != nil {
+			return nil, fmt.Errorf("replans[%d]: %w", i, err)
+		}
+		s.Replans = append(s.Replans, tasks)
+	}
+	return s, nil
+}
+
+// Replan stands in for the planner (see spawn.Config.Replan): it returns
+// the script's next revision, or an error once they are used up.
+func (s *Script) Replan(req dag.ReplanRequest, projectDir string) ([]dag.Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replansDone == len(s.Replans) {
+		return nil, fmt.Errorf("the script has no revision %d", s.replansDone+1)
+	}
+	s.replansDone++
+	return s.Replans[s.replansDone-1], nil
+}
+
+// checkSteps checks that each step does exactly one thing.
+func checkSteps(steps []Step) error {
+	for i, s := range steps {
+		n := 0
+		for _, set := range []bool{s.Say != "", s.Tool != nil, s.Commit != nil, s.Status != "",
+			s.Wait, s.SleepMS > 0, s.Exit != nil} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("step %d: want exactly one of say, tool, commit, status, wait, sleep_ms, exit", i)
+		}
+		switch {
+		case s.Tool != nil && s.Tool.Name == "":
+			return fmt.Errorf("step %d: tool has no name", i)
+		case s.Commit != nil && s.Commit.Message == "":
+			return fmt.Errorf("step %d: commit has no message", i)
+		case s.Output != "" && s.Status == "":
+			return fmt.Errorf("step %d: output needs a status", i)
+		}
+		switch s.Status {
+		case "", "in_progress", "completed", "failed", "blocked":
+		default:
+			return fmt.Errorf("step %d: unknown status %q", i, s.Status)
+		}
+	}
+	return nil
+}
+
+// Steps returns what the agent does on the given attempt at a task,
+// counting from 1.
+func (s *Script) Steps(title string, attempt int) []Step {
+	attempts, ok := s.Agents[title]
+	if !ok || len(attempts) == 0 {
+		if s.Default != nil {
+			return s.Default
+		}
+		return []Step{completeStep}
+	}
+	if attempt > len(attempts) {
+		attempt = len(attempts)
+	}
+	return attempts[max(attempt, 1)-1]
+}
@@ -0,0 +1,122 @@
+package simulate
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+)
+
+const testPlan = `{"tasks": [
+	{"id": 1, "title": "Write greeting", "description": "d", "risk_level": "low"},
+	{"id": 2, "title": "Print greeting", "description": "d", "risk_level": "low", "blocked_by": [1]}
+]}`
+
+func TestParseScript(t *testing.T) {
+	s, err := ParseScript([]byte(`{
+		"prompt": "greet",
+		"plan": ` + testPlan + `,
+		"agents": {
+			"Write greeting": [
+				[{"say": "first"}, {"exit": 1}],
+				[{"say": "second"}, {"status": "completed", "output": "done"}]
+			]
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Prompt != "greet" || len(s.Plan.Tasks) != 2 || len(s.Plan.Edges) != 1 {
+		t.Fatalf("got prompt %q, %d tasks, %d edges", s.Prompt, len(s.Plan.Tasks), len(s.Plan.Edges))
+	}
+
+	for _, tc := range []struct {
+		title   string
+		attempt int
+		want    string
+	}{
+		{"Write greeting", 1, "first"},
+		{"Write greeting", 2, "second"},
+		{"Write greeting", 5, "second"},
+	} {
+		if got := s.Steps(tc.title, tc.attempt); got[0].Say != tc.want {
+			t.Errorf("Steps(%q, %d) starts with %+v, want say %q", tc.title, tc.attempt, got[0], tc.want)
+		}
+	}
+	if got := s.Steps("Print greeting", 1); len(got) != 1 || got[0].Status != "completed" {
+		t.Errorf("unscripted task: got %+v, want it completed", got)
+	}
+}
+
+func TestScriptReviewAndReplans(t *testing.T) {
+	s, err := ParseScript([]byte(`{"plan": ` + testPlan + `}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.AutoApprove || s.MaxReplans != 0 {
+		t.Errorf("defaults: auto_approve %v, max_replans %d", s.AutoApprove, s.MaxReplans)
+	}
+
+	s, err = ParseScript([]byte(`{
+		"plan": ` + testPlan + `,
+		"auto_approve": false,
+		"replans": [
+			{"tasks": [{"id": 2, "title": "Print greeting", "description": "d", "risk_level": "low"}]},
+			{"tasks": [{"id": -1, "title": "Print it again", "description": "d", "risk_level": "low"}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.AutoApprove || s.MaxReplans != 2 {
+		t.Errorf("got auto_approve %v, max_replans %d; want false, 2", s.AutoApprove, s.MaxReplans)
+	}
+	for _, want := range []int64{2, -1} {
+		tasks, err := s.Replan(dag.ReplanRequest{}, "")
+		if err != nil || len(tasks) != 1 || tasks[0].ID != want {
+			t.Errorf("Replan = %+v, %v; want task %d", tasks, err, want)
+		}
+	}
+	if _, err := s.Replan(dag.ReplanRequest{}, ""); err == nil {
+		t.Error("expected an error once the revisions are used up")
+	}
+
+	s, err = ParseScript([]byte(`{"plan": ` + testPlan + `, "max_replans": 3}`))
+	if err != nil || s.MaxReplans != 3 {
+		t.Errorf("max_replans: %+v, %v", s, err)
+	}
+}
+
+func TestExampleScripts(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no example scripts: %v", err)
+	}
+	for _, path := range paths {
+		if _, err := LoadScript(path); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name, script, want string
+	}{
+		{"no plan", `{}`, "no plan"},
+		{"bad plan", `{"plan": {"tasks": [{"id": 1}]}}`, "missing required property"},
+		{"unknown task", `{"plan": ` + testPlan + `, "agents": {"Nope": [[{"say": "x"}]]}}`, `no task is titled "Nope"`},
+		{"two actions", `{"plan": ` + testPlan + `, "agents": {"Write greeting": [[{"say": "x", "wait": true}]]}}`, "exactly one"},
+		{"no action", `{"plan": ` + testPlan + `, "default": [{}]}`, "exactly one"},
+		{"bad status", `{"plan": ` + testPlan + `, "default": [{"status": "done"}]}`, `unknown status "done"`},
+		{"unnamed tool", `{"plan": ` + testPlan + `, "default": [{"tool": {}}]}`, "tool has no name"},
+		{"bad revision", `{"plan": ` + testPlan + `, "replans": [{"tasks": [{"id": -1}]}]}`, "replans[0]"},
+		{"negative max_replans", `{"plan": ` + testPlan + `, "max_replans": -1}`, "must not be negative"},
+	} {
+		_, err := ParseScript([]byte(tc.script))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got error %v, want one containing %q", tc.name, err, tc.want)
+		}
+	}
+}
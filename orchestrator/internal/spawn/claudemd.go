@@ -2,17 +2,95 @@ package spawn
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"text/template"
+	"time"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// ClaudeMDTemplatePath is where a project can provide its own agent
+// CLAUDE.md template, relative to the project directory. It is a Go
+// text/template executed with ClaudeMDData.
+const ClaudeMDTemplatePath = ".architect/agent.md.tmpl"
+
+// maxTemplateDecisions caps how many decisions are rendered into CLAUDE.md.
+const maxTemplateDecisions = 20
+
 const claudeMDTemplate = `# Agent Instructions
 
 You are agent ` + "`{{.AgentID}}`" + ` working on task #{{.TaskID}}: "{{.TaskTitle}}"
 
 ## Your Task
 {{.TaskDescription}}
+{{- if .AcceptanceCriteria}}
+
+## Acceptance Criteria
+The task is done when all of these hold:
+{{- range .AcceptanceCriteria}}
+- {{.}}
+{{- end}}
+{{- end}}
+{{- if .FileScope}}
+
+## File Scope
+This task is expected to change only:
+{{- range .FileScope}}
+- ` + "`{{.}}`" + `
+{{- end}}
+
+Other tasks own the rest of the tree. Post a message before changing files outside this scope.
+{{- end}}
+{{- if .Upstream}}
+
+## Upstream Tasks
+{{- range .Upstream}}
+- #{{.ID}} {{.Title}} ({{.Status}}{{if .Branch}}, branch ` + "`{{.Branch}}`" + `{{end}})
+{{- if .Output}}
+  {{indent 2 .Output}}
+{{- end}}
+{{- end}}
+
+Completed blocking tasks are already merged into your branch.
+{{- end}}
+{{- if .Siblings}}
+
+## Tasks Running in Parallel
+{{- range .Siblings}}
+- #{{.ID}} {{.Title}}{{if .Branch}} (branch ` + "`{{.Branch}}`" + `){{end}}
+{{- end}}
+
+Coordinate through ` + "`post_message`" + ` before changing code they are likely to touch.
+{{- end}}
+{{- if .Domains}}
+
+## Domains: {{join .Domains ", "}}
+{{- if .Decisions}}
+
+### Decisions already made
+{{- range .Decisions}}
+- [{{.Domain}}] {{.Decision}} — {{.Rationale}}
+{{- end}}
+{{- end}}
+{{- if .Context}}
+
+### Known context
+{{- range .Context}}
+- {{.Domain}}/{{.KeyName}}: {{.Value}}
+{{- end}}
+{{- end}}
+{{- end}}
+
+## Permissions
+Permission profile ` + "`{{.Permissions.Name}}`" + `: {{.Permissions.Description}}.
 
 ## Communication Protocol
 You have access to the ` + "`architect-pg`" + ` MCP server. Use it to communicate:
@@ -24,6 +102,8 @@ You have access to the ` + "`architect-pg`" + ` MCP server. Use it to communicat
    The orchestrator will respond to you directly in this conversation.
 5. **When you complete work:** Call ` + "`update_task`" + ` with status='completed' and a summary.
 6. **To coordinate with other agents:** Use ` + "`read_messages`" + ` and ` + "`check_decisions`" + `.
+7. **Before editing a file others may touch:** Call ` + "`acquire_lease`" + ` for it, and ` + "`release_lease`" + ` when done.
+   If another agent holds it, work on something else first or ask them through ` + "`post_message`" + `.
 
 ## Important
 - The orchestrator communicates with you through this conversation. Watch for messages.
@@ -43,36 +123,179 @@ Commit your work frequently with clear messages.
 {{.MainClaudeMD}}
 `
 
-type claudeMDData struct {
+// ClaudeMDData is what the agent CLAUDE.md template is executed with.
+type ClaudeMDData struct {
 	AgentID         string
 	TaskID          int64
 	TaskTitle       string
 	TaskDescription string
+	RiskLevel       string
 	WorktreePath    string
 	BranchName      string
-	MainClaudeMD    string
+	// MainClaudeMD is the project's own CLAUDE.md.
+	MainClaudeMD       string
+	AcceptanceCriteria []string
+	Domains            []string
+	// FileScope lists the paths or globs the task is expected to change.
+	FileScope []string
+	// Upstream are the task's direct dependencies with their outputs and branches.
+	Upstream []db.UpstreamTask
+	// Siblings are other tasks in progress at spawn time.
+	Siblings []db.SiblingTask
+	// Decisions and Context are the recorded decisions and context in Domains.
+	Decisions   []db.Decision
+	Context     []db.ContextEntry
+	Permissions PermissionProfile
 }
 
-// GenerateClaudeMD creates a per-agent CLAUDE.md from the embedded template.
-func GenerateClaudeMD(agentID string, task dag.Task, branchName string, worktreePath string, mainClaudeMD string) ([]byte, error) {
-	tmpl, err := template.New("claudemd").Parse(claudeMDTemplate)
+var templateFuncs = template.FuncMap{
+	"join": strings.Join,
+	// indent prefixes every line but the first with n spaces.
+	"indent": func(n int, s string) string {
+		return strings.ReplaceAll(strings.TrimSpace(s), "\n", "\n"+strings.Repeat(" ", n))
+	},
+}
+
+// ParseClaudeMDTemplate parses a CLAUDE.md template and checks it by
+// rendering sample data, so that references to unknown fields fail here
+// rather than when an agent is spawned.
+func ParseClaudeMDTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := RenderClaudeMD(tmpl, sampleClaudeMDData()); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
 
-	data := claudeMDData{
-		AgentID:         agentID,
-		TaskID:          task.ID,
-		TaskTitle:       task.Title,
-		TaskDescription: task.Description,
-		WorktreePath:    worktreePath,
-		BranchName:      branchName,
-		MainClaudeMD:    mainClaudeMD,
+// LoadClaudeMDTemplate returns the project's template from
+// ClaudeMDTemplatePath, or the built-in one if the project has none.
+func LoadClaudeMDTemplate(projectDir string) (*template.Template, error) {
+	path := filepath.Join(projectDir, ClaudeMDTemplatePath)
+	text, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ParseClaudeMDTemplate("claudemd", claudeMDTemplate)
+	}
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := ParseClaudeMDTemplate(path, string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid CLAUDE.md template %s: %w", path, err)
 	}
+	return tmpl, nil
+}
 
+// RenderClaudeMD executes a CLAUDE.md template.
+func RenderClaudeMD(tmpl *template.Template, data ClaudeMDData) ([]byte, error) {
 	var buf bytes.Buffer
 	if err := tmpl.Execute(&buf, data); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
+
+// GenerateClaudeMD creates a per-agent CLAUDE.md from the built-in template
+// with only the task's own fields filled in.
+func GenerateClaudeMD(agentID string, task dag.Task, branchName string, worktreePath string, mainClaudeMD string) ([]byte, error) {
+	tmpl, err := ParseClaudeMDTemplate("claudemd", claudeMDTemplate)
+	if err != nil {
+		return nil, err
+	}
+	profile, err := LookupPermissionProfile(task.PermissionProfile)
+	if err != nil {
+		return nil, err
+	}
+	return RenderClaudeMD(tmpl, taskClaudeMDData(agentID, task, branchName, worktreePath, mainClaudeMD, profile))
+}
+
+func taskClaudeMDData(agentID string, task dag.Task, branchName, worktreePath, mainClaudeMD string, profile PermissionProfile) ClaudeMDData {
+	return ClaudeMDData{
+		AgentID:            agentID,
+		TaskID:             task.ID,
+		TaskTitle:          task.Title,
+		TaskDescription:    task.Description,
+		RiskLevel:          task.RiskLevel,
+		WorktreePath:       worktreePath,
+		BranchName:         branchName,
+		MainClaudeMD:       mainClaudeMD,
+		AcceptanceCriteria: task.AcceptanceCriteria,
+		Domains:            task.Domains,
+		FileScope:          task.FileScope,
+		Permissions:        profile,
+	}
+}
+
+// BuildClaudeMDData gathers everything the template can show about a task.
+// Failing lookups of related rows are logged and leave those fields empty.
+func BuildClaudeMDData(ctx context.Context, pool *pgxpool.Pool, agentID string, task dag.Task,
+	branchName, worktreePath, mainClaudeMD string) (ClaudeMDData, error) {
+	profile, err := LookupPermissionProfile(task.PermissionProfile)
+	if err != nil {
+		return ClaudeMDData{}, err
+	}
+	data := taskClaudeMDData(agentID, task, branchName, worktreePath, mainClaudeMD, profile)
+
+	if data.Upstream, err = db.UpstreamTasks(ctx, pool, task.ID); err != nil {
+		logger.Warn("failed to load upstream tasks", logging.TaskID, task.ID, "err", err)
+	}
+	if data.Siblings, err = db.SiblingTasks(ctx, pool, task.ID); err != nil {
+		logger.Warn("failed to load sibling tasks", logging.TaskID, task.ID, "err", err)
+	}
+	if len(task.Domains) > 0 {
+		if data.Decisions, err = db.DecisionsInDomains(ctx, pool, task.Domains, maxTemplateDecisions); err != nil {
+			logger.Warn("failed to load decisions", logging.TaskID, task.ID, "err", err)
+		}
+		if data.Context, err = db.ContextInDomains(ctx, pool, task.Domains); err != nil {
+			logger.Warn("failed to load context", logging.TaskID, task.ID, "err", err)
+		}
+	}
+	return data, nil
+}
+
+// writeClaudeMD renders the configured template for a task into the worktree.
+func writeClaudeMD(ctx context.Context, pool *pgxpool.Pool, agentID string, task dag.Task,
+	branchName, worktreePath string, config Config) error {
+	tmpl := config.ClaudeMDTemplate
+	if tmpl == nil {
+		var err error
+		if tmpl, err = ParseClaudeMDTemplate("claudemd", claudeMDTemplate); err != nil {
+			return err
+		}
+	}
+	data, err := BuildClaudeMDData(ctx, pool, agentID, task, branchName, worktreePath, config.MainClaudeMD)
+	if err != nil {
+		return err
+	}
+	claudeMD, err := RenderClaudeMD(tmpl, data)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(worktreePath, "CLAUDE.md"), claudeMD, 0644)
+}
+
+// sampleClaudeMDData fills every field, including one element per list, so
+// that validating a template exercises all of its branches and loops.
+func sampleClaudeMDData() ClaudeMDData {
+	profile, _ := LookupPermissionProfile(DefaultPermissionProfile)
+	return ClaudeMDData{
+		AgentID:            "00000000-0000-0000-0000-000000000000",
+		TaskID:             1,
+		TaskTitle:          "Sample task",
+		TaskDescription:    "Sample description.",
+		RiskLevel:          "low",
+		WorktreePath:       "/tmp/worktree",
+		BranchName:         "agent/00000000/task-1",
+		MainClaudeMD:       "Sample conventions.",
+		AcceptanceCriteria: []string{"Sample criterion"},
+		Domains:            []string{"sample"},
+		FileScope:          []string{"sample/**"},
+		Upstream:           []db.UpstreamTask{{ID: 2, Title: "Upstream", Status: "completed", EdgeType: "blocks", Output: "Done.", Branch: "agent/1/task-2"}},
+		Siblings:           []db.SiblingTask{{ID: 3, Title: "Sibling", AssignedTo: "agent", Branch: "agent/2/task-3", Domains: []string{"sample"}}},
+		Decisions:          []db.Decision{{ID: 1, AgentID: "agent", Domain: "sample", Decision: "Decision", Rationale: "Rationale", RiskLevel: "low", CreatedAt: time.Unix(0, 0)}},
+		Context:            []db.ContextEntry{{AgentID: "agent", Domain: "sample", KeyName: "key", Value: "value", Confidence: 1}},
+		Permissions:        profile,
+	}
+}
@@ -1,6 +1,8 @@
 package spawn
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -41,3 +43,84 @@ func TestGenerateClaudeMD(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderClaudeMDRichFields(t *testing.T) {
+	tmpl, err := ParseClaudeMDTemplate("claudemd", claudeMDTemplate)
+	if err != nil {
+		t.Fatalf("built-in template: %v", err)
+	}
+	result, err := RenderClaudeMD(tmpl, sampleClaudeMDData())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	content := string(result)
+
+	checks := []string{
+		"## Acceptance Criteria",
+		"- Sample criterion",
+		"## File Scope\nThis task is expected to change only:\n- `sample/**`",
+		"#2 Upstream (completed, branch `agent/1/task-2`)",
+		"  Done.",
+		"#3 Sibling",
+		"## Domains: sample",
+		"[sample] Decision — Rationale",
+		"sample/key: value",
+		"Permission profile `default`",
+	}
+	for _, check := range checks {
+		if !strings.Contains(content, check) {
+			t.Errorf("expected CLAUDE.md to contain %q\n%s", check, content)
+		}
+	}
+}
+
+func TestRenderClaudeMDOmitsEmptySections(t *testing.T) {
+	result, err := GenerateClaudeMD("agent", dag.Task{ID: 1, Title: "t", Description: "d"}, "b", "/w", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, section := range []string{"Acceptance Criteria", "Upstream Tasks", "Running in Parallel", "## Domains", "File Scope"} {
+		if strings.Contains(string(result), section) {
+			t.Errorf("expected no %q section for a task without it", section)
+		}
+	}
+}
+
+func TestLoadClaudeMDTemplate(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadClaudeMDTemplate(dir); err != nil {
+		t.Fatalf("built-in template: %v", err)
+	}
+
+	path := filepath.Join(dir, ClaudeMDTemplatePath)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	custom := "Task {{.TaskID}}{{range .AcceptanceCriteria}} [{{.}}]{{end}} as {{.Permissions.Name}}"
+	if err := os.WriteFile(path, []byte(custom), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := LoadClaudeMDTemplate(dir)
+	if err != nil {
+		t.Fatalf("custom template: %v", err)
+	}
+	out, err := RenderClaudeMD(tmpl, sampleClaudeMDData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Task 1 [Sample criterion] as default"; string(out) != want {
+		t.Errorf("got %q, want %q", out, want)
+	}
+
+	// Unknown fields, even inside loops, fail at load time.
+	for _, bad := range []string{"{{.TaskID", "{{.NoSuchField}}", "{{range .Upstream}}{{.Nope}}{{end}}"} {
+		if err := os.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadClaudeMDTemplate(dir)
+		if err == nil || !strings.Contains(err.Error(), ClaudeMDTemplatePath) {
+			t.Errorf("template %q: expected an error naming the template, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package spawn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+)
+
+// LimitsPath is where a project configures agent resource limits, relative
+// to the project directory.
+const LimitsPath = ".architect/limits.json"
+
+// ResourceLimits caps what one agent (claude and every tool it runs) may use.
+// Zero fields are unlimited.
+type ResourceLimits struct {
+	// MemoryMax is in bytes.
+	MemoryMax int64
+	// CPUMax is in CPUs, e.g. 1.5.
+	CPUMax float64
+	// CPUWeight is the cgroup cpu.weight (1-10000, default 100): the agent's
+	// share of CPU time when agents compete for it.
+	CPUWeight int
+	PidsMax   int
+}
+
+// IsZero reports whether no limit is set.
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// overlay returns l with every field that o sets replaced.
+func (l ResourceLimits) overlay(o ResourceLimits) ResourceLimits {
+	if o.MemoryMax != 0 {
+		l.MemoryMax = o.MemoryMax
+	}
+	if o.CPUMax != 0 {
+		l.CPUMax = o.CPUMax
+	}
+	if o.CPUWeight != 0 {
+		l.CPUWeight = o.CPUWeight
+	}
+	if o.PidsMax != 0 {
+		l.PidsMax = o.PidsMax
+	}
+	return l
+}
+
+// UnmarshalJSON reads {"memory_max": "4G", "cpu_max": 2, "cpu_weight": 100, "pids_max": 512}.
+func (l *ResourceLimits) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		MemoryMax json.RawMessage `json:"memory_max"`
+		CPUMax    float64         `json:"cpu_max"`
+		CPUWeight int             `json:"cpu_weight"`
+		PidsMax   int             `json:"pids_max"`
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	if raw.CPUMax < 0 || raw.PidsMax < 0 {
+		return errors.New("limits must not be negative")
+	}
+	if raw.CPUWeight != 0 && (raw.CPUWeight < 1 || raw.CPUWeight > 10000) {
+		return fmt.Errorf("cpu_weight %d out of range 1-10000", raw.CPUWeight)
+	}
+	*l = ResourceLimits{CPUMax: raw.CPUMax, CPUWeight: raw.CPUWeight, PidsMax: raw.PidsMax}
+	if len(raw.MemoryMax) > 0 {
+		var s string
+		if err := json.Unmarshal(raw.MemoryMax, &s); err != nil {
+			s = string(raw.MemoryMax) // plain number of bytes
+		}
+		n, err := parseBytes(s)
+		if err != nil {
+			return fmt.Errorf("memory_max: %w", err)
+		}
+		l.MemoryMax = n
+	}
+	return nil
+}
+
+// parseBytes parses a size such as "512M", "4G" or "1073741824".
+func parseBytes(s string) (int64, error) {
+	s = strings.TrimSpace(strings.ToUpper(s))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+	mult := int64(1)
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult != 1 {
+			s = s[:len(s)-1]
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// limitHit records the resource limit that stopped an agent, as a task
+// failure reason (see db.FailTask) and the evidence for it.
+type limitHit struct {
+	Reason string
+	Detail string
+}
+
+// LimitsConfig chooses an agent's limits from its task: the defaults,
+// overridden by those for the task's risk level, overridden by those for
+// its permission profile.
+type LimitsConfig struct {
+	Default    ResourceLimits            `json:"default"`
+	RiskLevels map[string]ResourceLimits `json:"risk_levels"`
+	Profiles   map[string]ResourceLimits `json:"profiles"`
+}
+
+// For returns the limits for an agent working on task.
+func (c LimitsConfig) For(task dag.Task) ResourceLimits {
+	l := c.Default.overlay(c.RiskLevels[task.RiskLevel])
+	return l.overlay(c.Profiles[profileName(task.PermissionProfile)])
+}
+
+// IsZero reports whether no agent gets any limit.
+func (c LimitsConfig) IsZero() bool {
+	if !c.Default.IsZero() {
+		return false
+	}
+	for _, l := range c.RiskLevels {
+		if !l.IsZero() {
+			return false
+		}
+	}
+	for _, l := range c.Profiles {
+		if !l.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// LoadLimitsConfig reads the project's limits file; a missing file means no limits.
+func LoadLimitsConfig(projectDir string) (LimitsConfig, error) {
+	var c LimitsConfig
+	path := filepath.Join(projectDir, LimitsPath)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("parse %s: %w", path, err)
+	}
+	for name := range c.Profiles {
+		if _, err := LookupPermissionProfile(name); err != nil {
+			return c, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,269 @@
+//go:build linux
+
+package spawn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"golang.org/x/sys/unix"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroupControllers are the cgroup v2 controllers agent limits use.
+var cgroupControllers = []string{"memory", "cpu", "pids"}
+
+// Cgroups places each agent in its own child of the orchestrator's cgroup
+// v2, which must be delegated to the user running it (for example with
+// `systemd-run --user --scope -p Delegate=yes architect ...`).
+type Cgroups struct {
+	base string
+}
+
+// SetupCgroups prepares the orchestrator's cgroup for agent children. A
+// cgroup that holds processes cannot hand controllers to its children, so
+// the orchestrator first moves itself into an "orchestrator" leaf.
+func SetupCgroups() (*Cgroups, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not mounted at " + cgroupRoot)
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Join(cgroupRoot, own)
+
+	available, err := os.ReadFile(filepath.Join(base, "cgroup.controllers"))
+	if err != nil {
+		return nil, err
+	}
+	var enable []string
+	for _, c := range cgroupControllers {
+		if !containsField(string(available), c) {
+			return nil, fmt.Errorf("cgroup controller %q is not delegated to %s", c, base)
+		}
+		enable = append(enable, "+"+c)
+	}
+
+	leaf := filepath.Join(base, "orchestrator")
+	if err := os.Mkdir(leaf, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("create %s: %w", leaf, err)
+	}
+	if err := writeCgroupFile(leaf, "cgroup.procs", strconv.Itoa(os.Getpid())); err != nil {
+		return nil, err
+	}
+	if err := writeCgroupFile(base, "cgroup.subtree_control", strings.Join(enable, " ")); err != nil {
+		return nil, err
+	}
+	return &Cgroups{base: base}, nil
+}
+
+// ownCgroup returns the orchestrator's cgroup v2 path from /proc/self/cgroup.
+func ownCgroup() (string, error) {
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("no cgroup v2 entry in /proc/self/cgroup")
+}
+
+// agentCgroup is the cgroup of one agent process tree.
+type agentCgroup struct {
+	path string
+	fd   int
+}
+
+// create makes the agent's cgroup and writes its limits.
+func (c *Cgroups) create(agentID string, l ResourceLimits) (*agentCgroup, error) {
+	path := filepath.Join(c.base, "agent-"+agentID[:8])
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("create %s: %w", path, err)
+	}
+	g := &agentCgroup{path: path, fd: -1}
+
+	settings := map[string]string{}
+	if l.MemoryMax > 0 {
+		settings["memory.max"] = strconv.FormatInt(l.MemoryMax, 10)
+		// Without this the agent swaps instead of hitting the limit.
+		if _, err := os.Stat(filepath.Join(path, "memory.swap.max")); err == nil {
+			settings["memory.swap.max"] = "0"
+		}
+	}
+	if l.CPUMax > 0 {
+		const period = 100000
+		settings["cpu.max"] = fmt.Sprintf("%d %d", int(l.CPUMax*period), period)
+	}
+	if l.CPUWeight > 0 {
+		settings["cpu.weight"] = strconv.Itoa(l.CPUWeight)
+	}
+	if l.PidsMax > 0 {
+		settings["pids.max"] = strconv.Itoa(l.PidsMax)
+	}
+	for file, value := range settings {
+		if err := writeCgroupFile(path, file, value); err != nil {
+			g.remove()
+			return nil, err
+		}
+	}
+
+	fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		g.remove()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	g.fd = fd
+	return g, nil
+}
+
+// attach makes cmd start directly inside the cgroup.
+func (g *agentCgroup) attach(cmd *exec.Cmd) {
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = g.fd
+}
+
+// started releases the descriptor once the process is in the cgroup.
+func (g *agentCgroup) started() {
+	if g.fd >= 0 {
+		unix.Close(g.fd)
+		g.fd = -1
+	}
+}
+
+// limitHit returns the limit the kernel enforced on the agent, judged by
+// the cgroup's event counters and the signal that ended the agent, or a
+// zero limitHit.
+func (g *agentCgroup) limitHit(state *os.ProcessState) limitHit {
+	return cgroupLimitHit(exitSignal(state),
+		cgroupEventCount(g.path, "memory.events", "oom_kill"),
+		cgroupEventCount(g.path, "pids.events", "max"))
+}
+
+// cgroupLimitHit attributes an agent's failure to its memory limit if the
+// kernel OOM-killed any process in its cgroup, or to its process limit if
+// the kernel refused it a fork.
+func cgroupLimitHit(sig unix.Signal, oomKills, forksRefused int64) limitHit {
+	switch {
+	case oomKills > 0 && sig == unix.SIGKILL:
+		return limitHit{db.FailureMemoryLimit, "the agent was killed for exceeding its memory limit"}
+	case oomKills > 0:
+		return limitHit{db.FailureMemoryLimit,
+			fmt.Sprintf("%d of the agent's processes were killed for exceeding its memory limit", oomKills)}
+	case forksRefused > 0:
+		return limitHit{db.FailurePidsLimit,
+			fmt.Sprintf("%d forks were refused at the agent's process limit", forksRefused)}
+	}
+	return limitHit{}
+}
+
+// rlimitHit is limitHit for agents limited by applyRlimits. Nothing counts
+// allocations refused under RLIMIT_DATA, so the signal is the evidence: a
+// process that cannot allocate aborts or crashes.
+func rlimitHit(state *os.ProcessState, l ResourceLimits) limitHit {
+	if l.MemoryMax == 0 {
+		return limitHit{}
+	}
+	switch sig := exitSignal(state); sig {
+	case unix.SIGABRT, unix.SIGSEGV, unix.SIGBUS:
+		return limitHit{db.FailureMemoryLimit,
+			fmt.Sprintf("the agent died of %s under its %d byte memory limit", unix.SignalName(sig), l.MemoryMax)}
+	}
+	return limitHit{}
+}
+
+// exitSignal returns the signal that killed a process, or 0.
+func exitSignal(state *os.ProcessState) unix.Signal {
+	if state == nil {
+		return 0
+	}
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return ws.Signal()
+	}
+	return 0
+}
+
+// remove kills anything left in the cgroup and deletes it.
+func (g *agentCgroup) remove() {
+	g.started()
+	_ = writeCgroupFile(g.path, "cgroup.kill", "1")
+	for i := 0; i < 20; i++ {
+		if err := os.Remove(g.path); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func cgroupEventCount(path, file, key string) int64 {
+	data, err := os.ReadFile(filepath.Join(path, file))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok && k == key {
+			n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			return n
+		}
+	}
+	return 0
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("write %s: %w", filepath.Join(dir, file), err)
+	}
+	return nil
+}
+
+func containsField(s, field string) bool {
+	for _, f := range strings.Fields(s) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRlimits is the fallback without cgroups. It is weaker: memory is
+// capped per process (RLIMIT_DATA, inherited by children started after
+// this call) and CPU weight becomes a nice value. CPU quotas and process
+// counts cannot be limited per agent this way (RLIMIT_NPROC counts every
+// process of the user) and are skipped.
+func applyRlimits(pid int, l ResourceLimits) error {
+	if l.MemoryMax > 0 {
+		limit := &unix.Rlimit{Cur: uint64(l.MemoryMax), Max: uint64(l.MemoryMax)}
+		if err := unix.Prlimit(pid, unix.RLIMIT_DATA, limit, nil); err != nil {
+			return fmt.Errorf("set RLIMIT_DATA: %w", err)
+		}
+	}
+	if l.CPUWeight > 0 {
+		if err := unix.Setpriority(unix.PRIO_PROCESS, pid, weightToNice(l.CPUWeight)); err != nil {
+			return fmt.Errorf("set nice: %w", err)
+		}
+	}
+	return nil
+}
+
+// weightToNice maps a cgroup cpu.weight to the nice value with about the
+// same share: each nice step is worth roughly 1.25x CPU.
+func weightToNice(weight int) int {
+	nice := int(math.Round(math.Log(100/float64(weight)) / math.Log(1.25)))
+	return max(-20, min(19, nice))
+}
@@ -0,0 +1,62 @@
+//go:build linux
+
+package spawn
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"golang.org/x/sys/unix"
+)
+
+func TestCgroupLimitHit(t *testing.T) {
+	for _, tc := range []struct {
+		name                   string
+		sig                    unix.Signal
+		oomKills, forksRefused int64
+		want                   string
+	}{
+		{"no events", unix.SIGKILL, 0, 0, ""},
+		{"agent OOM-killed", unix.SIGKILL, 1, 0, db.FailureMemoryLimit},
+		{"tool OOM-killed", 0, 2, 0, db.FailureMemoryLimit},
+		{"fork refused", 0, 0, 3, db.FailurePidsLimit},
+		{"both", unix.SIGKILL, 1, 3, db.FailureMemoryLimit},
+	} {
+		hit := cgroupLimitHit(tc.sig, tc.oomKills, tc.forksRefused)
+		if hit.Reason != tc.want {
+			t.Errorf("%s: reason = %q, want %q", tc.name, hit.Reason, tc.want)
+		}
+		if (hit.Detail == "") != (tc.want == "") {
+			t.Errorf("%s: detail = %q", tc.name, hit.Detail)
+		}
+	}
+}
+
+// rlimitHit reads the signal that actually ended the process.
+func TestRlimitHit(t *testing.T) {
+	exited := func(sig unix.Signal) *os.ProcessState {
+		cmd := exec.Command("sleep", "10")
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmd.Process.Signal(sig)
+		cmd.Wait()
+		return cmd.ProcessState
+	}
+	limited := ResourceLimits{MemoryMax: 1 << 30}
+
+	if hit := rlimitHit(exited(unix.SIGSEGV), limited); hit.Reason != db.FailureMemoryLimit {
+		t.Errorf("SIGSEGV under a memory limit: %+v", hit)
+	}
+	if hit := rlimitHit(exited(unix.SIGABRT), ResourceLimits{CPUWeight: 50}); hit.Reason != "" {
+		t.Errorf("SIGABRT without a memory limit: %+v", hit)
+	}
+	if hit := rlimitHit(exited(unix.SIGTERM), limited); hit.Reason != "" {
+		t.Errorf("SIGTERM: %+v", hit)
+	}
+	if hit := rlimitHit(nil, limited); hit.Reason != "" {
+		t.Errorf("no process state: %+v", hit)
+	}
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package spawn
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Cgroups is only available on Linux.
+type Cgroups struct{}
+
+// SetupCgroups is only available on Linux.
+func SetupCgroups() (*Cgroups, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+type agentCgroup struct{}
+
+func (c *Cgroups) create(agentID string, l ResourceLimits) (*agentCgroup, error) {
+	return nil, errors.New("cgroups are only supported on Linux")
+}
+
+func (g *agentCgroup) attach(cmd *exec.Cmd) {}
+func (g *agentCgroup) started()             {}
+func (g *agentCgroup) remove()              {}
+
+func (g *agentCgroup) limitHit(state *os.ProcessState) limitHit { return limitHit{} }
+
+func applyRlimits(pid int, l ResourceLimits) error {
+	return errors.New("resource limits are only supported on Linux")
+}
+
+func rlimitHit(state *os.ProcessState, l ResourceLimits) limitHit { return limitHit{} }
@@ -0,0 +1,74 @@
+package spawn
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+)
+
+func TestParseBytes(t *testing.T) {
+	tests := map[string]int64{
+		"1024":  1024,
+		"512M":  512 << 20,
+		"4G":    4 << 30,
+		"1.5G":  3 << 29,
+		"2GiB":  2 << 30,
+		"256mb": 256 << 20,
+	}
+	for in, want := range tests {
+		got, err := parseBytes(in)
+		if err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "lots", "-1G"} {
+		if _, err := parseBytes(in); err == nil {
+			t.Errorf("parseBytes(%q) should fail", in)
+		}
+	}
+}
+
+func TestLimitsConfigFor(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".architect"), 0755)
+	os.WriteFile(filepath.Join(dir, LimitsPath), []byte(`{
+		"default": {"memory_max": "4G", "cpu_max": 2, "pids_max": 1024},
+		"risk_levels": {"high": {"memory_max": "2G", "cpu_weight": 50}},
+		"profiles": {"read-only": {"pids_max": 128}}
+	}`), 0644)
+
+	c, err := LoadLimitsConfig(dir)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	low := c.For(dag.Task{RiskLevel: "low"})
+	if low != (ResourceLimits{MemoryMax: 4 << 30, CPUMax: 2, PidsMax: 1024}) {
+		t.Errorf("low risk: unexpected limits %+v", low)
+	}
+	high := c.For(dag.Task{RiskLevel: "high", PermissionProfile: "read-only"})
+	if high != (ResourceLimits{MemoryMax: 2 << 30, CPUMax: 2, CPUWeight: 50, PidsMax: 128}) {
+		t.Errorf("high risk read-only: unexpected limits %+v", high)
+	}
+}
+
+func TestLoadLimitsConfigErrors(t *testing.T) {
+	if c, err := LoadLimitsConfig(t.TempDir()); err != nil || !c.IsZero() {
+		t.Errorf("missing file should mean no limits, got %+v, %v", c, err)
+	}
+
+	for name, body := range map[string]string{
+		"unknown field":   `{"default": {"memory": "4G"}}`,
+		"unknown profile": `{"profiles": {"admin": {"pids_max": 10}}}`,
+		"bad weight":      `{"default": {"cpu_weight": 20000}}`,
+	} {
+		dir := t.TempDir()
+		os.MkdirAll(filepath.Join(dir, ".architect"), 0755)
+		os.WriteFile(filepath.Join(dir, LimitsPath), []byte(body), 0644)
+		if _, err := LoadLimitsConfig(dir); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
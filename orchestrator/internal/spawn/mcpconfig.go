@@ -2,8 +2,16 @@ package spawn
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/affanhamid/editor/logging"
 )
 
 // ResolveMCPPgBinary finds the mcp-pg binary by checking:
@@ -43,23 +51,157 @@ func ResolveMCPPgBinary(explicit string) string {
 	return "architect-mcp-pg"
 }
 
-// GenerateMCPConfig creates a per-agent .mcp.json.
-func GenerateMCPConfig(agentID string, branchName string, mcpPgBinaryPath string, dbURL string) ([]byte, error) {
+// ArchitectServerName is the name of the coordination MCP server in every
+// agent's .mcp.json.
+const ArchitectServerName = "architect-pg"
+
+// DBURLEnv carries the database URL from the orchestrator to mcp-pg. It is
+// set in the claude process environment and referenced from .mcp.json, so
+// the URL (and any password in it) is never written into the worktree.
+const DBURLEnv = "ARCHITECT_DB_URL"
+
+// mcpLogEnv hands the orchestrator's logging settings to mcp-pg, which logs
+// to MCPLogFile in the worktree.
+func mcpLogEnv(opts logging.Options, worktreePath string) (map[string]string, error) {
+	abs, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		logging.RunIDEnv:  opts.RunID,
+		logging.FormatEnv: opts.Format,
+		logging.LevelEnv:  opts.Level,
+		logging.FileEnv:   filepath.Join(abs, MCPLogFile),
+	}, nil
+}
+
+// agentDBURL returns the database URL with its credentials replaced by an
+// agent role's. base may be a URL or a key/value connection string.
+func agentDBURL(base, role, password string) (string, error) {
+	if strings.HasPrefix(base, "postgres://") || strings.HasPrefix(base, "postgresql://") {
+		u, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("parse database URL: %w", err)
+		}
+		u.User = url.UserPassword(role, password)
+		return u.String(), nil
+	}
+	// Later keys win; role names and passwords need no quoting.
+	return fmt.Sprintf("%s user=%s password=%s", base, role, password), nil
+}
+
+// ReadProjectMCPConfig returns the project's own .mcp.json, or nil if it has none.
+func ReadProjectMCPConfig(projectDir string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(projectDir, ".mcp.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		MCPServers map[string]json.RawMessage `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse project .mcp.json: %w", err)
+	}
+	return data, nil
+}
+
+// ValidateMCPServers checks the extra MCP servers a task asks for.
+func ValidateMCPServers(servers map[string]json.RawMessage) error {
+	for name, raw := range servers {
+		if name == ArchitectServerName {
+			return fmt.Errorf("mcp server name %q is reserved", name)
+		}
+		var server struct {
+			Command string `json:"command"`
+			URL     string `json:"url"`
+		}
+		if err := json.Unmarshal(raw, &server); err != nil {
+			return fmt.Errorf("mcp server %q: %w", name, err)
+		}
+		if server.Command == "" && server.URL == "" {
+			return fmt.Errorf("mcp server %q needs a command or a url", name)
+		}
+	}
+	return nil
+}
+
+// GenerateMCPConfig creates a per-agent .mcp.json: the project's own
+// .mcp.json (if any), plus the servers the task asks for, plus architect-pg.
+// Later sources win on name clashes. Other top-level keys of the project
+// config are kept as they are. env is added to architect-pg's environment.
+func GenerateMCPConfig(agentID string, branchName string, mcpPgBinaryPath string,
+	projectConfig []byte, taskServers map[string]json.RawMessage, env map[string]string) ([]byte, error) {
+
 	absPath, err := filepath.Abs(mcpPgBinaryPath)
 	if err != nil {
 		return nil, err
 	}
-	config := map[string]any{
-		"mcpServers": map[string]any{
-			"architect-pg": map[string]any{
-				"command": absPath,
-				"env": map[string]string{
-					"ARCHITECT_AGENT_ID": agentID,
-					"ARCHITECT_BRANCH":   branchName,
-					"ARCHITECT_DB_URL":   dbURL,
-				},
-			},
-		},
+
+	config, servers, err := mergeMCPServers(projectConfig, taskServers)
+	if err != nil {
+		return nil, err
+	}
+
+	architectEnv := map[string]string{}
+	for k, v := range env {
+		architectEnv[k] = v
+	}
+	architectEnv["ARCHITECT_AGENT_ID"] = agentID
+	architectEnv["ARCHITECT_BRANCH"] = branchName
+	architectEnv[DBURLEnv] = "${" + DBURLEnv + "}"
+	architect, err := json.Marshal(map[string]any{
+		"command": absPath,
+		"env":     architectEnv,
+	})
+	if err != nil {
+		return nil, err
+	}
+	servers[ArchitectServerName] = architect
+
+	if config["mcpServers"], err = json.Marshal(servers); err != nil {
+		return nil, err
 	}
 	return json.MarshalIndent(config, "", "  ")
 }
+
+// MCPServerNames returns, sorted, the servers besides architect-pg in the
+// .mcp.json GenerateMCPConfig writes: the project's and the task's. Their
+// tools must be allowed explicitly (see AllowedToolsFlag).
+func MCPServerNames(projectConfig []byte, taskServers map[string]json.RawMessage) ([]string, error) {
+	_, servers, err := mergeMCPServers(projectConfig, taskServers)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		if name != ArchitectServerName {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// mergeMCPServers parses the project's .mcp.json and adds the task's servers
+// to its own, returning the config and the merged servers.
+func mergeMCPServers(projectConfig []byte, taskServers map[string]json.RawMessage) (config, servers map[string]json.RawMessage, err error) {
+	config = map[string]json.RawMessage{}
+	if len(projectConfig) > 0 {
+		if err := json.Unmarshal(projectConfig, &config); err != nil {
+			return nil, nil, fmt.Errorf("parse project .mcp.json: %w", err)
+		}
+	}
+	servers = map[string]json.RawMessage{}
+	if raw, ok := config["mcpServers"]; ok {
+		if err := json.Unmarshal(raw, &servers); err != nil {
+			return nil, nil, fmt.Errorf("parse project .mcp.json mcpServers: %w", err)
+		}
+	}
+	for name, server := range taskServers {
+		servers[name] = server
+	}
+	return config, servers, nil
+}
@@ -0,0 +1,116 @@
+package spawn
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PermissionProfile is a named set of tools an agent is allowed to use.
+type PermissionProfile struct {
+	Name         string
+	Description  string
+	AllowedTools []string
+	// BashAllow and BashDeny are Claude Code permission rules, e.g.
+	// "Bash(git log:*)", written to the agent's settings file. Deny rules
+	// win over AllowedTools.
+	BashAllow []string
+	BashDeny  []string
+}
+
+// DefaultPermissionProfile is used for tasks that do not name a profile.
+const DefaultPermissionProfile = "default"
+
+var permissionProfiles = map[string]PermissionProfile{
+	DefaultPermissionProfile: {
+		Name:         DefaultPermissionProfile,
+		Description:  "may read and edit files in the worktree and run shell commands",
+		AllowedTools: []string{"Edit", "Write", "Read", "Glob", "Grep", "Bash", "mcp__architect-pg__*"},
+		BashDeny:     defaultBashDeny,
+	},
+	"read-only": {
+		Name:         "read-only",
+		Description:  "may read files, inspect git history and coordinate, but not edit files or run other shell commands",
+		AllowedTools: []string{"Read", "Glob", "Grep", "mcp__architect-pg__*"},
+		BashAllow: []string{
+			"Bash(git status:*)", "Bash(git diff:*)", "Bash(git log:*)", "Bash(git show:*)", "Bash(git blame:*)",
+		},
+		BashDeny: defaultBashDeny,
+	},
+}
+
+// defaultBashDeny keeps agents inside their own branch and worktree: the
+// orchestrator owns pushing, branch switching and worktree management.
+var defaultBashDeny = []string{
+	"Bash(git push:*)",
+	"Bash(git checkout:*)",
+	"Bash(git switch:*)",
+	"Bash(git worktree:*)",
+	"Bash(git branch -D:*)",
+	"Bash(git reset --hard:*)",
+	"Bash(sudo:*)",
+}
+
+// LookupPermissionProfile returns the named profile; an empty name means the default.
+func LookupPermissionProfile(name string) (PermissionProfile, error) {
+	name = profileName(name)
+	p, ok := permissionProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(permissionProfiles))
+		for n := range permissionProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return PermissionProfile{}, fmt.Errorf("unknown permission profile %q (known: %s)", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// AllowedToolsFlag formats the profile for claude --allowedTools, allowing
+// every tool of the given MCP servers as well (see MCPServerNames).
+func (p PermissionProfile) AllowedToolsFlag(mcpServers []string) string {
+	tools := append([]string{}, p.AllowedTools...)
+	for _, name := range mcpServers {
+		tools = append(tools, mcpToolsPattern(name))
+	}
+	return strings.Join(tools, ",")
+}
+
+// mcpToolsPattern matches every tool of an MCP server.
+func mcpToolsPattern(server string) string {
+	return "mcp__" + server + "__*"
+}
+
+// profileName normalises an empty profile name to the default.
+func profileName(name string) string {
+	if name == "" {
+		return DefaultPermissionProfile
+	}
+	return name
+}
+
+// ClaudeSettingsPath is where each agent's Claude Code settings are written,
+// relative to its worktree. Claude Code layers this file over the project's
+// checked-in .claude/settings.json.
+const ClaudeSettingsPath = ".claude/settings.local.json"
+
+// GenerateClaudeSettings creates an agent's settings file from its
+// permission profile. The tools of the agent's MCP servers besides
+// architect-pg, the project's and the task's, are allowed as well.
+func GenerateClaudeSettings(profile PermissionProfile, mcpServers []string) ([]byte, error) {
+	allow := append([]string{}, profile.BashAllow...)
+	servers := append([]string{}, mcpServers...)
+	sort.Strings(servers)
+	for _, name := range servers {
+		allow = append(allow, mcpToolsPattern(name))
+	}
+	deny := append([]string{}, profile.BashDeny...)
+	settings := map[string]any{
+		"permissions": map[string][]string{
+			"allow": allow,
+			"deny":  deny,
+		},
+	}
+	return json.MarshalIndent(settings, "", "  ")
+}
@@ -5,18 +5,33 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"syscall"
+	"time"
 )
 
-// AgentHandle holds the stdin pipe and PID for a running agent process.
+// AgentHandle holds the stdin pipe, PID and current task of a running agent process.
 type AgentHandle struct {
-	Stdin io.WriteCloser
-	PID   int
+	Stdin  io.WriteCloser
+	PID    int
+	TaskID int64
+	closed bool
+	paused bool
+	done   chan struct{}
+}
+
+// StoppedAgent is an agent whose process exited during shutdown.
+type StoppedAgent struct {
+	AgentID  string
+	TaskID   int64
+	ExitCode int
 }
 
 // AgentRegistry is a thread-safe map of agentID → AgentHandle.
 type AgentRegistry struct {
-	mu     sync.RWMutex
-	agents map[string]*AgentHandle
+	mu       sync.RWMutex
+	agents   map[string]*AgentHandle
+	stopping bool
+	stopped  []StoppedAgent
 }
 
 // NewAgentRegistry creates an empty registry.
@@ -25,17 +40,164 @@ func NewAgentRegistry() *AgentRegistry {
 }
 
 // Register adds an agent to the registry.
-func (r *AgentRegistry) Register(agentID string, stdin io.WriteCloser, pid int) {
+func (r *AgentRegistry) Register(agentID string, stdin io.WriteCloser, pid int, taskID int64) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.agents[agentID] = &AgentHandle{Stdin: stdin, PID: pid}
+	r.agents[agentID] = &AgentHandle{Stdin: stdin, PID: pid, TaskID: taskID, done: make(chan struct{})}
+}
+
+// SetTask records that a live agent has moved on to a new task.
+func (r *AgentRegistry) SetTask(agentID string, taskID int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if handle, ok := r.agents[agentID]; ok {
+		handle.TaskID = taskID
+	}
+}
+
+// TaskID returns the task a live agent is currently working on.
+func (r *AgentRegistry) TaskID(agentID string) (int64, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handle, ok := r.agents[agentID]
+	if !ok {
+		return 0, false
+	}
+	return handle.TaskID, true
 }
 
 // Deregister removes an agent from the registry.
 func (r *AgentRegistry) Deregister(agentID string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.agents, agentID)
+	r.deregister(agentID)
+}
+
+func (r *AgentRegistry) deregister(agentID string) {
+	if handle, ok := r.agents[agentID]; ok {
+		close(handle.done)
+		delete(r.agents, agentID)
+	}
+}
+
+// Exited deregisters an agent whose process has exited. It returns true if
+// the registry is shutting down, in which case the agent is recorded for
+// Shutdown to finalise and the caller must not touch its task.
+func (r *AgentRegistry) Exited(agentID string, exitCode int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopping {
+		if handle, ok := r.agents[agentID]; ok {
+			r.stopped = append(r.stopped, StoppedAgent{AgentID: agentID, TaskID: handle.TaskID, ExitCode: exitCode})
+		}
+	}
+	r.deregister(agentID)
+	return r.stopping
+}
+
+// BeginShutdown marks the registry as stopping and returns the running agents.
+func (r *AgentRegistry) BeginShutdown() []string {
+	r.mu.Lock()
+	r.stopping = true
+	r.mu.Unlock()
+	return r.AgentIDs()
+}
+
+// StoppedAgents returns the agents that exited after BeginShutdown.
+func (r *AgentRegistry) StoppedAgents() []StoppedAgent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]StoppedAgent(nil), r.stopped...)
+}
+
+// WaitAll waits up to timeout for every registered agent to exit and
+// reports whether they all did.
+func (r *AgentRegistry) WaitAll(timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		r.mu.RLock()
+		var done chan struct{}
+		for _, handle := range r.agents {
+			done = handle.done
+			break
+		}
+		r.mu.RUnlock()
+		if done == nil {
+			return true
+		}
+		select {
+		case <-done:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+// Signal sends sig to an agent's whole process group, reaching the tools
+// claude started as well as claude itself.
+func (r *AgentRegistry) Signal(agentID string, sig syscall.Signal) error {
+	r.mu.RLock()
+	handle, ok := r.agents[agentID]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("agent %s not found in registry", agentID)
+	}
+	return syscall.Kill(-handle.PID, sig)
+}
+
+// Pause stops an agent's process group with SIGSTOP.
+func (r *AgentRegistry) Pause(agentID string) error {
+	return r.setPaused(agentID, true, syscall.SIGSTOP)
+}
+
+// Resume continues a paused agent's process group with SIGCONT.
+func (r *AgentRegistry) Resume(agentID string) error {
+	return r.setPaused(agentID, false, syscall.SIGCONT)
+}
+
+func (r *AgentRegistry) setPaused(agentID string, paused bool, sig syscall.Signal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handle, ok := r.agents[agentID]
+	if !ok {
+		return fmt.Errorf("agent %s not found in registry", agentID)
+	}
+	if handle.paused == paused {
+		return nil
+	}
+	if err := syscall.Kill(-handle.PID, sig); err != nil {
+		return err
+	}
+	handle.paused = paused
+	return nil
+}
+
+// IsPaused returns true if the agent is running but stopped by Pause.
+func (r *AgentRegistry) IsPaused(agentID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handle, ok := r.agents[agentID]
+	return ok && handle.paused
+}
+
+// AgentIDs returns the IDs of all running agents.
+func (r *AgentRegistry) AgentIDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.agents))
+	for id := range r.agents {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// KillAll sends SIGKILL to every registered agent's process group.
+func (r *AgentRegistry) KillAll() {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, handle := range r.agents {
+		_ = syscall.Kill(-handle.PID, syscall.SIGKILL)
+	}
 }
 
 // streamMessage is the NDJSON format expected by claude --input-format stream-json.
@@ -57,6 +219,9 @@ func (r *AgentRegistry) Send(agentID string, message string) error {
 	if !ok {
 		return fmt.Errorf("agent %s not found in registry", agentID)
 	}
+	if handle.closed {
+		return fmt.Errorf("agent %s stdin already closed", agentID)
+	}
 	msg := streamMessage{
 		Type: "user",
 		Message: streamContent{
@@ -73,6 +238,30 @@ func (r *AgentRegistry) Send(agentID string, message string) error {
 	return err
 }
 
+// Close closes an agent's stdin pipe, signalling claude --print to finish
+// its current turn and exit. The agent stays registered until its process exits.
+func (r *AgentRegistry) Close(agentID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	handle, ok := r.agents[agentID]
+	if !ok {
+		return fmt.Errorf("agent %s not found in registry", agentID)
+	}
+	if handle.closed {
+		return nil
+	}
+	handle.closed = true
+	return handle.Stdin.Close()
+}
+
+// IsOpen returns true if the agent is running and still accepts messages.
+func (r *AgentRegistry) IsOpen(agentID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handle, ok := r.agents[agentID]
+	return ok && !handle.closed
+}
+
 // IsAlive returns true if the agent is registered (process still running).
 func (r *AgentRegistry) IsAlive(agentID string) bool {
 	r.mu.RLock()
@@ -0,0 +1,120 @@
+package spawn
+
+import (
+	"io"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type nopPipe struct {
+	closed int
+}
+
+func (p *nopPipe) Write(b []byte) (int, error) {
+	if p.closed > 0 {
+		return 0, io.ErrClosedPipe
+	}
+	return len(b), nil
+}
+
+func (p *nopPipe) Close() error {
+	p.closed++
+	return nil
+}
+
+func TestAgentRegistryClose(t *testing.T) {
+	r := NewAgentRegistry()
+	pipe := &nopPipe{}
+	r.Register("agent-1", pipe, 1234, 7)
+
+	if err := r.Send("agent-1", "hello"); err != nil {
+		t.Fatalf("send before close: %v", err)
+	}
+	if id, ok := r.TaskID("agent-1"); !ok || id != 7 {
+		t.Errorf("expected task 7, got %d (ok=%v)", id, ok)
+	}
+	r.SetTask("agent-1", 8)
+	if id, _ := r.TaskID("agent-1"); id != 8 {
+		t.Errorf("expected task 8 after SetTask, got %d", id)
+	}
+	if err := r.Close("agent-1"); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := r.Close("agent-1"); err != nil {
+		t.Fatalf("second close should be a no-op: %v", err)
+	}
+	if pipe.closed != 1 {
+		t.Errorf("expected stdin closed once, got %d", pipe.closed)
+	}
+	if r.IsOpen("agent-1") {
+		t.Error("closed agent should not accept messages")
+	}
+	if !r.IsAlive("agent-1") {
+		t.Error("agent should stay registered until its process exits")
+	}
+	if err := r.Send("agent-1", "hello"); err == nil {
+		t.Error("expected error sending to closed agent")
+	}
+	if err := r.Close("agent-2"); err == nil {
+		t.Error("expected error closing unknown agent")
+	}
+}
+
+func TestAgentRegistryShutdown(t *testing.T) {
+	r := NewAgentRegistry()
+	r.Register("agent-1", &nopPipe{}, 1111, 1)
+	r.Register("agent-2", &nopPipe{}, 2222, 2)
+
+	// Exits before shutdown are finalised by the caller, not recorded.
+	if r.Exited("agent-1", 0) {
+		t.Fatal("registry should not be stopping yet")
+	}
+
+	live := r.BeginShutdown()
+	if len(live) != 1 || live[0] != "agent-2" {
+		t.Fatalf("expected agent-2 to be live, got %v", live)
+	}
+	if r.WaitAll(10 * time.Millisecond) {
+		t.Fatal("WaitAll should time out while agent-2 is running")
+	}
+
+	go r.Exited("agent-2", 143)
+	if !r.WaitAll(time.Second) {
+		t.Fatal("WaitAll should return once agent-2 exits")
+	}
+
+	stopped := r.StoppedAgents()
+	if len(stopped) != 1 || stopped[0].AgentID != "agent-2" || stopped[0].TaskID != 2 || stopped[0].ExitCode != 143 {
+		t.Errorf("unexpected stopped agents: %+v", stopped)
+	}
+}
+
+func TestAgentRegistryPause(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start sleep: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	r := NewAgentRegistry()
+	r.Register("agent-1", &nopPipe{}, cmd.Process.Pid, 1)
+
+	if err := r.Pause("agent-1"); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if !r.IsPaused("agent-1") {
+		t.Error("expected agent to be paused")
+	}
+	if err := r.Resume("agent-1"); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if r.IsPaused("agent-1") {
+		t.Error("expected agent to be running after resume")
+	}
+	if err := r.Pause("agent-2"); err == nil {
+		t.Error("expected error pausing unknown agent")
+	}
+}
@@ -0,0 +1,110 @@
+package spawn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/metrics"
+	"github.com/affanhamid/editor/tracing"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReuseSession hands a ready task to an idle agent that is still running.
+// The agent continues in its existing worktree on a new branch cut from its
+// finished work, and receives the task as a message on stdin. It returns
+// false if the agent or the task was taken by someone else first.
+func ReuseSession(ctx context.Context, pool *pgxpool.Pool, registry *AgentRegistry,
+	agent db.IdleAgent, task dag.Task, config Config) (bool, error) {
+
+	agentID := agent.AgentID
+	if !registry.IsOpen(agentID) {
+		return false, nil
+	}
+	// The process keeps the tool permissions it was started with.
+	if profileName(task.PermissionProfile) != profileName(agent.PermissionProfile) {
+		return false, nil
+	}
+	// ...and the MCP servers and resource limits it was started with.
+	if len(task.MCPServers) > 0 {
+		return false, nil
+	}
+	started := dag.Task{RiskLevel: agent.RiskLevel, PermissionProfile: agent.PermissionProfile}
+	if config.Limits.For(task) != config.Limits.For(started) {
+		return false, nil
+	}
+
+	// 1. Take the agent (atomic: fails if another task grabbed it first)
+	acquired, err := db.AcquireIdleAgent(ctx, pool, agentID, task.ID)
+	if err != nil {
+		return false, fmt.Errorf("acquire agent: %w", err)
+	}
+	if !acquired {
+		return false, nil
+	}
+	release := func() {
+		_ = db.SetAgentTask(ctx, pool, agentID, agent.TaskID, "idle")
+	}
+
+	// 2. Claim the task
+	claimed, err := db.ClaimTask(ctx, pool, task.ID, "in_progress", agentID)
+	if err != nil {
+		release()
+		return false, fmt.Errorf("claim task: %w", err)
+	}
+	if !claimed {
+		release()
+		return false, nil
+	}
+
+	// 3. Start a new branch in the agent's worktree
+	parentBranches, err := db.ParentBranches(ctx, pool, task.ID)
+	if err != nil {
+		logger.Warn("failed to get parent branches", logging.TaskID, task.ID, "err", err)
+	}
+	if task.Branch != "" {
+		parentBranches = append([]string{task.Branch}, parentBranches...)
+	}
+	branchName, err := BranchWorktree(agent.WorktreePath, agentID, task.ID, parentBranches)
+	if err != nil {
+		_ = db.ReclaimTask(ctx, pool, task.ID)
+		release()
+		return false, fmt.Errorf("branch worktree: %w", err)
+	}
+	recordTaskBranch(ctx, pool, task.ID, branchName, agent.WorktreePath)
+	if err := ExcludeGeneratedFiles(agent.WorktreePath); err != nil {
+		logger.Warn("failed to exclude generated files", logging.TaskID, task.ID, "err", err)
+	}
+	registry.SetTask(agentID, task.ID)
+	metrics.Spawns.Inc("reuse")
+	_, span := tracing.Start(taskContext(ctx, task), "reuse_session",
+		slog.Int64(logging.TaskID, task.ID), slog.String(logging.AgentID, agentID))
+	span.End()
+	// The agent's mcp-pg traces its tool calls under the new task from now on.
+	if err := writeTraceparent(ctx, task, agent.WorktreePath, config); err != nil {
+		logger.Warn("failed to write traceparent", logging.TaskID, task.ID, "err", err)
+	}
+
+	// 4. Refresh CLAUDE.md so it describes the new task
+	if err := writeClaudeMD(ctx, pool, agentID, task, branchName, agent.WorktreePath, config); err != nil {
+		logger.Warn("failed to write CLAUDE.md", logging.TaskID, task.ID, "err", err)
+	}
+
+	// 5. Deliver the task
+	prompt := fmt.Sprintf("Task #%d is done. You are now working on task #%d: %q\n\n"+
+		"You are on a new branch `%s`, cut from your previous work. "+
+		"Call `update_task` for task #%d when this one is finished.\n\n%s",
+		agent.TaskID, task.ID, task.Title, branchName, task.ID, task.Description)
+	if task.ResumeNote != "" {
+		prompt += "\n\n" + task.ResumeNote
+	}
+	if err := registry.Send(agentID, prompt); err != nil {
+		return true, fmt.Errorf("send task to agent: %w", err)
+	}
+
+	logger.Info("reused agent", logging.AgentID, agentID, logging.TaskID, task.ID, "title", task.Title)
+	return true, nil
+}
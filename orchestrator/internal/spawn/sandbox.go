@@ -0,0 +1,345 @@
+package spawn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Sandbox modes.
+const (
+	SandboxOff        = ""
+	SandboxAuto       = "auto"       // bwrap if installed, otherwise namespaces
+	SandboxBwrap      = "bwrap"      // bubblewrap
+	SandboxNamespaces = "namespaces" // unprivileged user and mount namespaces
+)
+
+// SandboxHelperCommand is the orchestrator subcommand that sets up the
+// mounts inside fresh namespaces and then execs the agent (namespaces mode).
+const SandboxHelperCommand = "sandbox-exec"
+
+// Sandbox confines agent processes on Linux. The agent's worktree and the
+// parts of the repository's git directory a commit writes are writable,
+// other agents' worktrees are hidden, and everything else is read-only.
+type Sandbox struct {
+	Mode string
+	// NoNetwork gives the agent an empty network namespace. Postgres stays
+	// reachable through its Unix socket, so the DB URL must use one.
+	NoNetwork bool
+	// PostgresSocketDir is the directory of the Postgres Unix socket, kept
+	// visible inside the sandbox. Set by ValidateSandbox.
+	PostgresSocketDir string
+}
+
+// Enabled reports whether agents run sandboxed.
+func (s Sandbox) Enabled() bool {
+	return s.Mode != SandboxOff
+}
+
+// ValidateSandbox checks the sandbox settings against the platform and the
+// DB URL and resolves "auto" to a concrete mode.
+func ValidateSandbox(s Sandbox, dbURL string) (Sandbox, error) {
+	switch s.Mode {
+	case SandboxOff:
+		if s.NoNetwork {
+			return s, fmt.Errorf("disabling the network needs a sandbox mode")
+		}
+		return s, nil
+	case SandboxAuto, SandboxBwrap, SandboxNamespaces:
+	default:
+		return s, fmt.Errorf("unknown sandbox mode %q (known: auto, bwrap, namespaces)", s.Mode)
+	}
+	if !sandboxSupported {
+		return s, fmt.Errorf("sandboxing is only supported on Linux")
+	}
+	if s.Mode == SandboxAuto {
+		s.Mode = SandboxNamespaces
+		if _, err := exec.LookPath("bwrap"); err == nil {
+			s.Mode = SandboxBwrap
+		}
+	}
+	if s.Mode == SandboxBwrap {
+		if _, err := exec.LookPath("bwrap"); err != nil {
+			return s, fmt.Errorf("sandbox mode bwrap: %w", err)
+		}
+	}
+
+	config, err := pgconn.ParseConfig(dbURL)
+	if err != nil {
+		return s, fmt.Errorf("parse database URL: %w", err)
+	}
+	if strings.HasPrefix(config.Host, "/") {
+		s.PostgresSocketDir = config.Host
+	} else if s.NoNetwork {
+		return s, fmt.Errorf("without network the database URL must use a Unix socket (e.g. host=/var/run/postgresql), not %q", config.Host)
+	}
+	return s, nil
+}
+
+// sandboxMounts lists what the agent may write, what it must not see, and
+// what stays read-only inside the writable paths.
+type sandboxMounts struct {
+	Writable []string
+	Hidden   []string
+	ReadOnly []string
+}
+
+// agentMounts works out the sandbox mounts for an agent worktree.
+//
+// The orchestrator runs git on the agent's branch and in its worktree
+// outside the sandbox, so the agent must not be able to change what git
+// runs there: hooks, config, and the files that lead git from the worktree
+// to its git directory stay read-only. A commit only needs the objects, the
+// refs and their logs, and the worktree's own git directory.
+func agentMounts(s Sandbox, projectDir, worktreePath string) (sandboxMounts, error) {
+	gitDirCmd := exec.Command("git", "rev-parse", "--path-format=absolute", "--git-common-dir", "--git-dir")
+	gitDirCmd.Dir = worktreePath
+	out, err := gitDirCmd.Output()
+	if err != nil {
+		return sandboxMounts{}, fmt.Errorf("git rev-parse --git-common-dir: %w", err)
+	}
+	dirs := strings.Fields(string(out))
+	if len(dirs) != 2 || dirs[0] == dirs[1] {
+		return sandboxMounts{}, fmt.Errorf("%s is not a linked worktree", worktreePath)
+	}
+	commonDir, gitDir := dirs[0], dirs[1]
+	worktreesDir, err := filepath.Abs(filepath.Join(projectDir, ".worktrees"))
+	if err != nil {
+		return sandboxMounts{}, err
+	}
+	worktreePath, err = filepath.Abs(worktreePath)
+	if err != nil {
+		return sandboxMounts{}, err
+	}
+
+	// Git creates these on first use, which it could not do inside the
+	// read-only git directory.
+	for _, dir := range []string{"objects", "refs", "logs"} {
+		if err := os.MkdirAll(filepath.Join(commonDir, dir), 0755); err != nil {
+			return sandboxMounts{}, err
+		}
+	}
+	// config.worktree is read if the repository enables per-worktree
+	// config; an empty one keeps the agent from creating it.
+	worktreeConfig := filepath.Join(gitDir, "config.worktree")
+	f, err := os.OpenFile(worktreeConfig, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return sandboxMounts{}, err
+	}
+	f.Close()
+
+	m := sandboxMounts{
+		// Other agents' worktrees; the agent's own is mounted back on top.
+		Hidden: []string{worktreesDir},
+		Writable: []string{
+			worktreePath,
+			gitDir,
+			filepath.Join(commonDir, "objects"),
+			filepath.Join(commonDir, "refs"),
+			filepath.Join(commonDir, "logs"),
+			filepath.Join(commonDir, "packed-refs"),
+		},
+		ReadOnly: []string{
+			filepath.Join(worktreePath, ".git"),
+			filepath.Join(gitDir, "commondir"),
+			filepath.Join(gitDir, "gitdir"),
+			worktreeConfig,
+		},
+	}
+	// Build tools expect a writable cache. Claude Code's own state goes to
+	// a directory of the agent's (see agentClaudeDir), not the user's.
+	if cache, err := os.UserCacheDir(); err == nil {
+		m.Writable = append(m.Writable, cache)
+	}
+	if s.PostgresSocketDir != "" {
+		m.Writable = append(m.Writable, s.PostgresSocketDir)
+	}
+
+	// Only paths that exist can be mounted.
+	m.Writable = existingPaths(m.Writable)
+	m.ReadOnly = existingPaths(m.ReadOnly)
+	return m, nil
+}
+
+func existingPaths(paths []string) []string {
+	existing := paths[:0]
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			existing = append(existing, p)
+		}
+	}
+	return existing
+}
+
+// ClaudeConfigDirEnv points Claude Code at its configuration directory.
+const ClaudeConfigDirEnv = "CLAUDE_CONFIG_DIR"
+
+// agentClaudeDir makes a sandboxed agent's Claude Code configuration
+// directory, seeded with the user's login and settings. The user's own
+// ~/.claude and ~/.claude.json stay read-only: the user's claude would
+// otherwise run hooks and MCP servers the agent planted there. The
+// directory is outside the writable cache so that agents cannot reach each
+// other's.
+func agentClaudeDir(agentID string) (string, error) {
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(config, "architect", "claude", "agent-"+agentID[:8])
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return dir, nil
+	}
+	for src, dst := range map[string]string{
+		filepath.Join(home, ".claude", ".credentials.json"): ".credentials.json",
+		filepath.Join(home, ".claude.json"):                 ".claude.json",
+	} {
+		data, err := os.ReadFile(src)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0600); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// sandboxViolationMarkers are error messages that show a tool ran into the
+// sandbox. Network markers only count when the network is disabled.
+var (
+	sandboxFSMarkers  = []string{"Read-only file system"}
+	sandboxNetMarkers = []string{"Network is unreachable", "Could not resolve host", "Temporary failure in name resolution"}
+)
+
+// sandboxViolations returns the tool-output lines in one stream-json log
+// line that show a sandbox violation.
+func sandboxViolations(line []byte, noNetwork bool) []string {
+	markers := sandboxFSMarkers
+	if noNetwork {
+		markers = append(append([]string{}, sandboxFSMarkers...), sandboxNetMarkers...)
+	}
+	if !containsAny(string(line), markers) {
+		return nil
+	}
+
+	var entry struct {
+		Type    string `json:"type"`
+		Message struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if json.Unmarshal(line, &entry) != nil || entry.Type != "user" {
+		return nil
+	}
+	var blocks []struct {
+		Type    string          `json:"type"`
+		Content json.RawMessage `json:"content"`
+	}
+	if json.Unmarshal(entry.Message.Content, &blocks) != nil {
+		return nil
+	}
+
+	var found []string
+	for _, b := range blocks {
+		if b.Type != "tool_result" {
+			continue
+		}
+		for _, text := range toolResultTexts(b.Content) {
+			for _, l := range strings.Split(text, "\n") {
+				if containsAny(l, markers) {
+					found = append(found, oneLineDetail(l))
+				}
+			}
+		}
+	}
+	return found
+}
+
+// toolResultTexts returns the text of a tool_result's content, which is
+// either a string or a list of text blocks.
+func toolResultTexts(raw json.RawMessage) []string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return []string{s}
+	}
+	var blocks []struct {
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &blocks) != nil {
+		return nil
+	}
+	texts := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		texts = append(texts, b.Text)
+	}
+	return texts
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func oneLineDetail(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 200 {
+		s = s[:197] + "..."
+	}
+	return s
+}
+
+// sandboxLog writes an agent's output to its log and reports sandbox
+// violations as they appear. Each violation is also recorded in the log as
+// a {"type":"system","subtype":"sandbox_violation"} line.
+type sandboxLog struct {
+	out       io.Writer
+	noNetwork bool
+	report    func(detail string)
+	partial   []byte
+}
+
+func (l *sandboxLog) Write(p []byte) (int, error) {
+	n, err := l.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		line := l.partial[:i]
+		for _, detail := range sandboxViolations(line, l.noNetwork) {
+			entry, _ := json.Marshal(map[string]string{
+				"type":    "system",
+				"subtype": "sandbox_violation",
+				"detail":  detail,
+			})
+			l.out.Write(append(entry, '\n'))
+			l.report(detail)
+		}
+		l.partial = append(l.partial[:0], l.partial[i+1:]...)
+	}
+	return n, nil
+}
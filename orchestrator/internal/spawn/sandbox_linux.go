@@ -0,0 +1,222 @@
+//go:build linux
+
+package spawn
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const sandboxSupported = true
+
+// Securebits from linux/securebits.h: exec as uid 0 grants no capabilities.
+const (
+	secbitNoRoot       = 1 << 0
+	secbitNoRootLocked = 1 << 1
+)
+
+// sandboxCommand returns a command that runs name with args in dir, inside
+// the sandbox.
+func sandboxCommand(s Sandbox, m sandboxMounts, dir string, name string, args ...string) (*exec.Cmd, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	switch s.Mode {
+	case SandboxBwrap:
+		bwrapArgs := []string{
+			"--ro-bind", "/", "/",
+			"--dev-bind", "/dev", "/dev",
+			"--tmpfs", "/tmp",
+		}
+		for _, h := range m.Hidden {
+			bwrapArgs = append(bwrapArgs, "--tmpfs", h)
+		}
+		for _, w := range m.Writable {
+			bwrapArgs = append(bwrapArgs, "--bind", w, w)
+		}
+		for _, r := range m.ReadOnly {
+			bwrapArgs = append(bwrapArgs, "--ro-bind", r, r)
+		}
+		if s.NoNetwork {
+			bwrapArgs = append(bwrapArgs, "--unshare-net")
+		}
+		bwrapArgs = append(bwrapArgs, "--chdir", dir, "--", name)
+		cmd := exec.Command("bwrap", append(bwrapArgs, args...)...)
+		cmd.Dir = dir
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+		return cmd, nil
+
+	case SandboxNamespaces:
+		self, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("find orchestrator binary: %w", err)
+		}
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return nil, err
+		}
+		helperArgs := []string{SandboxHelperCommand}
+		for _, h := range m.Hidden {
+			helperArgs = append(helperArgs, "--hide", h)
+		}
+		for _, w := range m.Writable {
+			helperArgs = append(helperArgs, "--rw", w)
+		}
+		for _, r := range m.ReadOnly {
+			helperArgs = append(helperArgs, "--ro", r)
+		}
+		helperArgs = append(helperArgs, "--", path)
+		cmd := exec.Command(self, append(helperArgs, args...)...)
+		cmd.Dir = dir
+
+		// The helper keeps the user's uid but gets CAP_SYS_ADMIN in the new
+		// user namespace, which it needs for the mounts and then drops.
+		flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS)
+		if s.NoNetwork {
+			flags |= syscall.CLONE_NEWNET
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:                 flags,
+			UidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+			GidMappings:                []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+			GidMappingsEnableSetgroups: false,
+			AmbientCaps:                []uintptr{unix.CAP_SYS_ADMIN},
+		}
+		return cmd, nil
+	}
+	return nil, fmt.Errorf("unknown sandbox mode %q", s.Mode)
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(v string) error { *l = append(*l, v); return nil }
+
+// RunSandboxHelper implements `architect sandbox-exec`: run inside fresh user
+// and mount namespaces, it makes the filesystem read-only except for the
+// --rw paths, hides the --hide directories, makes the --ro paths within the
+// writable ones read-only again, drops its capabilities and execs the
+// command. It only returns on error.
+func RunSandboxHelper(args []string) error {
+	fs := flag.NewFlagSet(SandboxHelperCommand, flag.ContinueOnError)
+	var writable, hidden, readOnly stringList
+	fs.Var(&writable, "rw", "Path to keep writable (repeatable)")
+	fs.Var(&hidden, "hide", "Directory to hide behind an empty tmpfs (repeatable)")
+	fs.Var(&readOnly, "ro", "Path within a writable one to keep read-only (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no command given")
+	}
+
+	// Capabilities are per thread: set up, drop and exec on the same one.
+	runtime.LockOSThread()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Hold the writable paths open, since hiding may cover them.
+	fds := make([]int, len(writable))
+	for i, w := range writable {
+		fd, err := unix.Open(w, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", w, err)
+		}
+		fds[i] = fd
+	}
+
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := unix.MountSetattr(-1, "/", unix.AT_RECURSIVE,
+		&unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return fmt.Errorf("make / read-only: %w", err)
+	}
+	for _, dir := range append([]string{"/tmp"}, hidden...) {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := unix.Mount("tmpfs", dir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+			return fmt.Errorf("mount tmpfs on %s: %w", dir, err)
+		}
+	}
+	for i, w := range writable {
+		if err := makeMountPoint(fds[i], w); err != nil {
+			return err
+		}
+		if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", fds[i]), w, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", w, err)
+		}
+		if err := unix.MountSetattr(-1, w, unix.AT_RECURSIVE,
+			&unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}); err != nil {
+			return fmt.Errorf("make %s writable: %w", w, err)
+		}
+		unix.Close(fds[i])
+	}
+	for _, r := range readOnly {
+		if err := unix.Mount(r, r, "", unix.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", r, err)
+		}
+		if err := unix.MountSetattr(-1, r, 0, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+			return fmt.Errorf("make %s read-only: %w", r, err)
+		}
+	}
+	// Re-enter the working directory so it resolves to the new mounts.
+	if err := unix.Chdir(cwd); err != nil {
+		return err
+	}
+
+	// Drop every capability before exec so the agent cannot undo the mounts.
+	// A non-root helper only holds the ambient ones; as uid 0 exec would
+	// grant them all back unless securebits say otherwise.
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear ambient capabilities: %w", err)
+	}
+	if os.Getuid() == 0 {
+		if err := unix.Prctl(unix.PR_SET_SECUREBITS, secbitNoRoot|secbitNoRootLocked, 0, 0, 0); err != nil {
+			return fmt.Errorf("set securebits: %w", err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+
+	argv := fs.Args()
+	return unix.Exec(argv[0], argv, os.Environ())
+}
+
+// makeMountPoint creates a file or directory at path, matching the open
+// source, if a tmpfs now hides the original.
+func makeMountPoint(fd int, path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("stat %s: %w", path, err)
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+		return os.MkdirAll(path, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package spawn
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for the orchestrator as the
+// namespaces sandbox helper.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxHelperCommand {
+		if err := RunSandboxHelper(os.Args[2:]); err != nil {
+			os.Stderr.WriteString("sandbox: " + err.Error() + "\n")
+			os.Exit(126)
+		}
+	}
+	os.Exit(m.Run())
+}
+
+func TestNamespacesSandbox(t *testing.T) {
+	if err := exec.Command("unshare", "--user", "--mount", "true").Run(); err != nil {
+		t.Skip("unprivileged user namespaces not available")
+	}
+	root := t.TempDir()
+	worktrees := filepath.Join(root, ".worktrees")
+	own := filepath.Join(worktrees, "agent-own")
+	other := filepath.Join(worktrees, "agent-other")
+	for _, d := range []string{own, other} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(other, "secret"), []byte("x"), 0644)
+	gitFile := filepath.Join(own, ".git")
+	os.WriteFile(gitFile, []byte("gitdir: /repo/.git/worktrees/agent-own\n"), 0644)
+
+	// t.TempDir is usually under /tmp, which the sandbox replaces, so probe
+	// a write outside it next to the test sources instead.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(wd, "sandbox-outside.txt")
+	defer os.Remove(outside)
+
+	m := sandboxMounts{Writable: []string{own}, Hidden: []string{worktrees}, ReadOnly: []string{gitFile}}
+	script := `echo ok > own.txt &&
+		if ls ../agent-other/secret 2>/dev/null; then echo visible; fi;
+		(echo "gitdir: /elsewhere" > .git) 2>/dev/null || true;
+		(echo no > ` + outside + `) 2>&1 || true`
+	cmd, err := sandboxCommand(Sandbox{Mode: SandboxNamespaces}, m, own, "sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("sandboxed command failed: %v\n%s", err, out)
+	}
+
+	if _, err := os.Stat(filepath.Join(own, "own.txt")); err != nil {
+		t.Error("agent could not write its own worktree")
+	}
+	if strings.Contains(string(out), "visible") {
+		t.Error("other worktrees should be hidden")
+	}
+	if data, _ := os.ReadFile(gitFile); !strings.Contains(string(data), "agent-own") {
+		t.Errorf("agent could write a read-only path in its worktree: %q", data)
+	}
+	if _, err := os.Stat(outside); err == nil {
+		t.Error("agent could write outside its worktree")
+	}
+	if !strings.Contains(string(out), "Read-only file system") {
+		t.Errorf("expected a read-only error, got:\n%s", out)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package spawn
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const sandboxSupported = false
+
+func sandboxCommand(s Sandbox, m sandboxMounts, dir string, name string, args ...string) (*exec.Cmd, error) {
+	return nil, errors.New("sandboxing is only supported on Linux")
+}
+
+// RunSandboxHelper is only available on Linux.
+func RunSandboxHelper(args []string) error {
+	return errors.New("sandboxing is only supported on Linux")
+}
@@ -0,0 +1,129 @@
+package spawn
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateSandbox(t *testing.T) {
+	const tcpURL = "postgres://u:p@localhost:5432/db"
+	const socketURL = "postgres://u:p@/db?host=/var/run/postgresql"
+
+	if _, err := ValidateSandbox(Sandbox{}, tcpURL); err != nil {
+		t.Errorf("no sandbox: unexpected error %v", err)
+	}
+	if _, err := ValidateSandbox(Sandbox{NoNetwork: true}, socketURL); err == nil {
+		t.Error("no network without a sandbox should be rejected")
+	}
+	if _, err := ValidateSandbox(Sandbox{Mode: "chroot"}, tcpURL); err == nil {
+		t.Error("unknown mode should be rejected")
+	}
+	if !sandboxSupported {
+		return
+	}
+	if _, err := ValidateSandbox(Sandbox{Mode: SandboxNamespaces, NoNetwork: true}, tcpURL); err == nil {
+		t.Error("no network with a TCP database URL should be rejected")
+	}
+	s, err := ValidateSandbox(Sandbox{Mode: SandboxNamespaces, NoNetwork: true}, socketURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s.PostgresSocketDir != "/var/run/postgresql" {
+		t.Errorf("unexpected socket dir %q", s.PostgresSocketDir)
+	}
+}
+
+const roToolResult = `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"touch: cannot touch '/etc/x': Read-only file system\nother output"}]}}`
+
+func TestSandboxViolations(t *testing.T) {
+	got := sandboxViolations([]byte(roToolResult), false)
+	if len(got) != 1 || got[0] != "touch: cannot touch '/etc/x': Read-only file system" {
+		t.Errorf("unexpected violations %q", got)
+	}
+
+	net := `{"type":"user","message":{"content":[{"type":"tool_result","content":[{"type":"text","text":"curl: (6) Could not resolve host: example.com"}]}]}}`
+	if got := sandboxViolations([]byte(net), false); len(got) != 0 {
+		t.Errorf("network errors only count without network, got %q", got)
+	}
+	if got := sandboxViolations([]byte(net), true); len(got) != 1 {
+		t.Errorf("expected a network violation, got %q", got)
+	}
+
+	// The assistant quoting an error is not a violation.
+	quoted := `{"type":"assistant","message":{"content":[{"type":"text","text":"Read-only file system?"}]}}`
+	if got := sandboxViolations([]byte(quoted), false); len(got) != 0 {
+		t.Errorf("unexpected violations %q", got)
+	}
+}
+
+func TestSandboxLog(t *testing.T) {
+	var out bytes.Buffer
+	var reported []string
+	l := &sandboxLog{out: &out, report: func(d string) { reported = append(reported, d) }}
+
+	// Lines may arrive split across writes.
+	line := roToolResult + "\n"
+	l.Write([]byte(line[:40]))
+	if len(reported) != 0 {
+		t.Fatal("reported before the line was complete")
+	}
+	l.Write([]byte(line[40:]))
+	if len(reported) != 1 {
+		t.Fatalf("expected 1 violation, got %d", len(reported))
+	}
+	if !strings.Contains(out.String(), `"subtype":"sandbox_violation"`) {
+		t.Errorf("violation not recorded in the log:\n%s", out.String())
+	}
+	if !strings.HasPrefix(out.String(), line) {
+		t.Error("agent output should be logged unchanged")
+	}
+}
+
+// The agent may write what a commit writes, but nothing that changes what
+// git runs when the orchestrator uses the repository outside the sandbox.
+func TestAgentMounts(t *testing.T) {
+	repo := initRepo(t)
+	path, _, err := CreateWorktree(repo, "abc12345-6789-0000-0000-000000000000", 1, nil)
+	if err != nil {
+		t.Fatalf("create worktree: %v", err)
+	}
+	m, err := agentMounts(Sandbox{}, repo, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	common := filepath.Join(repo, ".git")
+	writable := func(p string) bool {
+		for _, w := range m.Writable {
+			if p == w || strings.HasPrefix(p, w+string(filepath.Separator)) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, p := range []string{path, filepath.Join(common, "objects"), filepath.Join(common, "refs", "heads"),
+		filepath.Join(common, "worktrees", filepath.Base(path))} {
+		if !writable(p) {
+			t.Errorf("%s should be writable, mounts %q", p, m.Writable)
+		}
+	}
+	for _, p := range []string{common, filepath.Join(common, "hooks"), filepath.Join(common, "config"),
+		filepath.Join(common, "worktrees")} {
+		if writable(p) {
+			t.Errorf("%s should not be writable, mounts %q", p, m.Writable)
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil && writable(filepath.Join(home, ".claude")) {
+		t.Errorf("~/.claude should not be writable, mounts %q", m.Writable)
+	}
+	if !slices.Contains(m.ReadOnly, filepath.Join(path, ".git")) {
+		t.Errorf("the worktree's .git file should be read-only, got %q", m.ReadOnly)
+	}
+
+	if _, err := agentMounts(Sandbox{}, repo, repo); err == nil {
+		t.Error("the main worktree should be refused")
+	}
+}
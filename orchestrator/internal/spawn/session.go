@@ -3,18 +3,26 @@ package spawn
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"text/template"
+	"time"
 
+	"github.com/affanhamid/editor/logging"
 	"github.com/affanhamid/editor/orchestrator/internal/dag"
 	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/metrics"
+	"github.com/affanhamid/editor/tracing"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+var logger = logging.For("spawn")
+
 // filterEnv returns a copy of env with the named variable removed.
 func filterEnv(env []string, name string) []string {
 	prefix := name + "="
@@ -32,6 +40,89 @@ type Config struct {
 	MCPPgBinary  string
 	DBURL        string
 	MainClaudeMD string
+	// ProjectMCPConfig is the project's own .mcp.json, merged into every
+	// agent's; nil if the project has none.
+	ProjectMCPConfig []byte
+	// Sandbox confines agent processes; the zero value runs them unconfined.
+	Sandbox Sandbox
+	// Limits chooses each agent's resource limits. They are enforced through
+	// Cgroups, or with rlimits when Cgroups is nil.
+	Limits  LimitsConfig
+	Cgroups *Cgroups
+	// ClaudeMDTemplate renders each agent's CLAUDE.md; nil uses the built-in template.
+	ClaudeMDTemplate *template.Template
+	// CloseGrace is how long an agent may keep running after its task
+	// reaches a terminal status before its stdin is closed.
+	CloseGrace time.Duration
+	// ReuseAgents hands newly ready tasks to idle agents that finished a
+	// direct parent task instead of spawning a fresh process.
+	ReuseAgents bool
+	// AgentDBRoles gives each agent's mcp-pg its own database role, which
+	// row-level security limits to writing the agent's own rows. The role is
+	// dropped when the agent exits.
+	AgentDBRoles bool
+	// TaskTimeout fails tasks that have been worked on for longer than this,
+	// not counting time their agent spent paused. Zero disables it.
+	TaskTimeout time.Duration
+	// Logging is handed on to each agent's mcp-pg.
+	Logging logging.Options
+	// Tracing is handed on to each agent's mcp-pg, whose tool calls become
+	// spans of the agent's task.
+	Tracing tracing.Options
+	// Prompt is the user request the run was decomposed from; the planner
+	// sees it again when it revises the remaining plan.
+	Prompt string
+	// MaxReplans bounds how often the remaining plan is revised after a task
+	// fails for good or no task can make progress. Zero disables re-planning.
+	MaxReplans int
+	// Replan revises the remaining plan; nil asks the planner (dag.Replan).
+	Replan func(req dag.ReplanRequest, projectDir string) ([]dag.Task, error)
+	// SimulateScript, when set, runs every agent as a fake acting out this
+	// simulation script instead of claude (see package simulate).
+	SimulateScript string
+}
+
+// SimulatedAgentCommand is the orchestrator subcommand that runs a scripted
+// fake agent in place of claude (see Config.SimulateScript).
+const SimulatedAgentCommand = "simulate-agent"
+
+// agentCommand returns the program and arguments an agent runs as.
+// mcpServers are the agent's MCP servers besides architect-pg.
+func agentCommand(profile PermissionProfile, mcpServers []string, config Config) (string, []string, error) {
+	if config.SimulateScript != "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return "", nil, err
+		}
+		return exe, []string{SimulatedAgentCommand, "--script", config.SimulateScript}, nil
+	}
+	// --print: non-interactive (no TUI), supports piped stdin/stdout
+	// --input-format stream-json: accept NDJSON user messages on stdin
+	// --output-format stream-json: emit NDJSON events on stdout
+	// --allowedTools: scoped permissions from the task's permission profile,
+	// plus the tools of its MCP servers (no --dangerously-skip-permissions)
+	return "claude", []string{
+		"--print",
+		"--verbose",
+		"--input-format", "stream-json",
+		"--output-format", "stream-json",
+		"--allowedTools", profile.AllowedToolsFlag(mcpServers),
+	}, nil
+}
+
+// recordTaskBranch records the branch a task's work lives on and the commit
+// it starts from, against which the task's file scope is checked.
+func recordTaskBranch(ctx context.Context, pool *pgxpool.Pool, taskID int64, branchName, worktreePath string) {
+	if err := db.SetTaskBranch(ctx, pool, taskID, branchName); err != nil {
+		logger.Warn("failed to record branch", logging.TaskID, taskID, "err", err)
+	}
+	sha, err := HeadCommit(worktreePath)
+	if err == nil {
+		err = db.SetTaskBase(ctx, pool, taskID, sha)
+	}
+	if err != nil {
+		logger.Warn("failed to record base commit", logging.TaskID, taskID, "err", err)
+	}
 }
 
 // SpawnSession creates a worktree, writes config files, and starts an interactive Claude Code session.
@@ -39,67 +130,153 @@ type Config struct {
 func SpawnSession(ctx context.Context, pool *pgxpool.Pool, registry *AgentRegistry,
 	task dag.Task, projectDir string, config Config) (string, error) {
 
+	ctx, span := tracing.Start(taskContext(ctx, task), "spawn_session", slog.Int64(logging.TaskID, task.ID))
+	agentID, err := spawnSession(ctx, pool, registry, task, projectDir, config)
+	if agentID != "" {
+		span.SetAttributes(slog.String(logging.AgentID, agentID))
+	}
+	span.EndWithError(err)
+	return agentID, err
+}
+
+// spawnSession does the work of SpawnSession, tracing each step.
+func spawnSession(ctx context.Context, pool *pgxpool.Pool, registry *AgentRegistry,
+	task dag.Task, projectDir string, config Config) (string, error) {
+
 	agentID := uuid.New().String()
 
+	profile, err := LookupPermissionProfile(task.PermissionProfile)
+	if err != nil {
+		return "", err
+	}
+
 	// 1. Find parent branches and create git worktree
-	parentWorktrees, err := db.ParentBranches(ctx, pool, task.ID)
+	parentBranches, err := db.ParentBranches(ctx, pool, task.ID)
 	if err != nil {
-		log.Printf("warning: failed to get parent branches for task %d: %v", task.ID, err)
+		logger.Warn("failed to get parent branches", logging.TaskID, task.ID, "err", err)
 	}
 
-	worktreePath, branchName, err := CreateWorktree(projectDir, agentID, task.ID, parentWorktrees)
+	spawnReason := "new"
+	if task.Branch != "" && BranchExists(projectDir, task.Branch) {
+		// Resume from the work-in-progress an interrupted agent left behind.
+		parentBranches = append([]string{task.Branch}, parentBranches...)
+		spawnReason = "resume"
+	}
+
+	_, step := tracing.Start(ctx, "create_worktree")
+	worktreePath, branchName, err := CreateWorktree(projectDir, agentID, task.ID, parentBranches)
+	step.EndWithError(err)
 	if err != nil {
 		return "", fmt.Errorf("create worktree: %w", err)
 	}
 
 	// 2. Register agent in Postgres
-	if err := db.RegisterAgent(ctx, pool, agentID, task.ID, worktreePath); err != nil {
+	_, step = tracing.Start(ctx, "register_agent")
+	err = db.RegisterAgent(ctx, pool, agentID, task.ID, worktreePath)
+	step.EndWithError(err)
+	if err != nil {
 		return "", fmt.Errorf("register agent: %w", err)
 	}
 
 	// 3. Claim the task (atomic: fails if another agent claimed it first)
+	_, step = tracing.Start(ctx, "claim_task")
 	claimed, err := db.ClaimTask(ctx, pool, task.ID, "in_progress", agentID)
+	step.SetAttributes(slog.Bool("claimed", claimed))
+	step.EndWithError(err)
 	if err != nil {
 		return "", fmt.Errorf("claim task: %w", err)
 	}
 	if !claimed {
 		_ = RemoveWorktree(projectDir, worktreePath)
-		log.Printf("task %d already claimed, skipping", task.ID)
+		logger.Info("task already claimed, skipping", logging.TaskID, task.ID)
 		return "", nil
 	}
+	recordTaskBranch(ctx, pool, task.ID, branchName, worktreePath)
 
 	// 4. Write CLAUDE.md into worktree
-	claudeMD, err := GenerateClaudeMD(agentID, task, branchName, worktreePath, config.MainClaudeMD)
-	if err != nil {
-		return "", fmt.Errorf("generate CLAUDE.md: %w", err)
-	}
-	if err := os.WriteFile(filepath.Join(worktreePath, "CLAUDE.md"), claudeMD, 0644); err != nil {
+	_, step = tracing.Start(ctx, "write_config")
+	if err := writeClaudeMD(ctx, pool, agentID, task, branchName, worktreePath, config); err != nil {
+		step.EndWithError(err)
 		return "", fmt.Errorf("write CLAUDE.md: %w", err)
 	}
 
-	// 5. Write .mcp.json into worktree
-	mcpJSON, err := GenerateMCPConfig(agentID, branchName, config.MCPPgBinary, config.DBURL)
+	// 5. Write .mcp.json and Claude settings into worktree
+	mcpServers, err := MCPServerNames(config.ProjectMCPConfig, task.MCPServers)
 	if err != nil {
-		return "", fmt.Errorf("generate .mcp.json: %w", err)
+		err = fmt.Errorf("generate .mcp.json: %w", err)
+	} else {
+		err = writeAgentConfig(ctx, agentID, task, branchName, worktreePath, profile, mcpServers, config)
 	}
-	if err := os.WriteFile(filepath.Join(worktreePath, ".mcp.json"), mcpJSON, 0644); err != nil {
-		return "", fmt.Errorf("write .mcp.json: %w", err)
+	step.EndWithError(err)
+	if err != nil {
+		return "", err
 	}
 
 	// 6. Spawn Claude Code in streaming print mode with scoped permissions.
-	// --print: non-interactive (no TUI), supports piped stdin/stdout
-	// --input-format stream-json: accept NDJSON user messages on stdin
-	// --output-format stream-json: emit NDJSON events on stdout
-	// --allowedTools: scoped permissions (no --dangerously-skip-permissions)
-	cmd := exec.CommandContext(ctx, "claude",
-		"--print",
-		"--verbose",
-		"--input-format", "stream-json",
-		"--output-format", "stream-json",
-		"--allowedTools", "Edit,Write,Read,Glob,Grep,Bash,mcp__architect-pg__*",
-	)
-	cmd.Dir = worktreePath
-	cmd.Env = append(filterEnv(os.Environ(), "CLAUDECODE"), "ZDOTDIR=/dev/null")
+	// The process is not tied to ctx: on shutdown agents are asked to commit
+	// their work and stop rather than being killed (see Shutdown).
+	agentName, agentArgs, err := agentCommand(profile, mcpServers, config)
+	if err != nil {
+		return "", fmt.Errorf("agent command: %w", err)
+	}
+	_, step = tracing.Start(ctx, "start_process")
+	defer step.End()
+	var cmd *exec.Cmd
+	var claudeDir string
+	if config.Sandbox.Enabled() {
+		mounts, err := agentMounts(config.Sandbox, projectDir, worktreePath)
+		if err != nil {
+			return "", fmt.Errorf("sandbox: %w", err)
+		}
+		if claudeDir, err = agentClaudeDir(agentID); err != nil {
+			return "", fmt.Errorf("sandbox: %w", err)
+		}
+		// Hide other agents' directories; the agent's own is mounted back.
+		mounts.Hidden = append(mounts.Hidden, filepath.Dir(claudeDir))
+		mounts.Writable = append(mounts.Writable, claudeDir)
+		if config.Tracing.File != "" {
+			// mcp-pg appends its spans to the run's trace file.
+			mounts.Writable = append(mounts.Writable, config.Tracing.File)
+		}
+		if cmd, err = sandboxCommand(config.Sandbox, mounts, worktreePath, agentName, agentArgs...); err != nil {
+			return "", fmt.Errorf("sandbox: %w", err)
+		}
+	} else {
+		cmd = exec.Command(agentName, agentArgs...)
+		cmd.Dir = worktreePath
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// The DB URL reaches mcp-pg through the environment (see DBURLEnv).
+	dbURL := config.DBURL
+	if config.AgentDBRoles {
+		role, password, err := db.CreateAgentRole(ctx, pool, agentID)
+		if err != nil {
+			return "", fmt.Errorf("create database role: %w", err)
+		}
+		if dbURL, err = agentDBURL(config.DBURL, role, password); err != nil {
+			dropAgentRole(pool, agentID)
+			return "", err
+		}
+	}
+	cmd.Env = append(filterEnv(filterEnv(os.Environ(), "CLAUDECODE"), DBURLEnv),
+		"ZDOTDIR=/dev/null", DBURLEnv+"="+dbURL)
+	if claudeDir != "" {
+		cmd.Env = append(filterEnv(cmd.Env, ClaudeConfigDirEnv), ClaudeConfigDirEnv+"="+claudeDir)
+	}
+	// Own process group, so a terminal Ctrl-C reaches only the orchestrator and
+	// signals can be delivered to claude and its tool subprocesses together.
+	cmd.SysProcAttr.Setpgid = true
+
+	limits := config.Limits.For(task)
+	var cgroup *agentCgroup
+	if !limits.IsZero() && config.Cgroups != nil {
+		if cgroup, err = config.Cgroups.create(agentID, limits); err != nil {
+			logger.Warn("agent runs without a cgroup", logging.AgentID, agentID, logging.TaskID, task.ID, "err", err)
+			cgroup = nil
+		} else {
+			cgroup.attach(cmd)
+		}
+	}
 
 	// Hold stdin pipe for sending messages to the agent
 	stdinPipe, err := cmd.StdinPipe()
@@ -114,45 +291,213 @@ func SpawnSession(ctx context.Context, pool *pgxpool.Pool, registry *AgentRegist
 	}
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
+	if config.Sandbox.Enabled() {
+		out := &sandboxLog{out: logFile, noNetwork: config.Sandbox.NoNetwork, report: func(detail string) {
+			reportSandboxViolation(pool, registry, agentID, task.ID, detail)
+		}}
+		cmd.Stdout = out
+		cmd.Stderr = out
+	}
 
 	if err := cmd.Start(); err != nil {
+		step.SetError(err)
 		logFile.Close()
+		if cgroup != nil {
+			cgroup.remove()
+		}
+		if config.AgentDBRoles {
+			dropAgentRole(pool, agentID)
+		}
 		return "", fmt.Errorf("start claude: %w", err)
 	}
+	// rlimits are the limits applyRlimits set, if it was used.
+	var rlimits ResourceLimits
+	if cgroup != nil {
+		cgroup.started()
+	} else if !limits.IsZero() {
+		if err := applyRlimits(cmd.Process.Pid, limits); err != nil {
+			logger.Warn("failed to limit agent", logging.AgentID, agentID, logging.TaskID, task.ID, "err", err)
+		} else {
+			rlimits = limits
+		}
+	}
+
+	step.SetAttributes(slog.Int("pid", cmd.Process.Pid))
 
 	// 7. Update agent with PID
 	if err := db.UpdateAgentPID(ctx, pool, agentID, cmd.Process.Pid); err != nil {
-		log.Printf("warning: failed to update agent PID: %v", err)
+		logger.Warn("failed to update agent PID", logging.AgentID, agentID, "err", err)
 	}
 
 	// 8. Register in the agent registry
-	registry.Register(agentID, stdinPipe, cmd.Process.Pid)
+	registry.Register(agentID, stdinPipe, cmd.Process.Pid, task.ID)
 
 	// 9. Send initial prompt via stdin as stream-json user message
 	initialPrompt := fmt.Sprintf("You are working on task #%d: %q\n\n%s",
 		task.ID, task.Title, task.Description)
+	if task.ResumeNote != "" {
+		initialPrompt += "\n\n" + task.ResumeNote
+	}
 	if err := registry.Send(agentID, initialPrompt); err != nil {
-		log.Printf("warning: failed to write initial prompt to agent %s: %v", agentID[:8], err)
+		logger.Warn("failed to write initial prompt", logging.AgentID, agentID, logging.TaskID, task.ID, "err", err)
 	}
 
 	// 10. Wait for completion in a goroutine
 	go func() {
 		err := cmd.Wait()
 		logFile.Close()
-		registry.Deregister(agentID)
-
-		bgCtx := context.Background()
-		if err != nil {
-			log.Printf("agent %s (task %d) failed: %v", agentID[:8], task.ID, err)
-			_ = db.UpdateAgentStatus(bgCtx, pool, agentID, "dead")
-			_, _ = db.ClaimTask(bgCtx, pool, task.ID, "failed", agentID)
-		} else {
-			log.Printf("agent %s (task %d) completed", agentID[:8], task.ID)
-			_ = db.UpdateAgentStatus(bgCtx, pool, agentID, "idle")
-			_ = db.CompleteTask(bgCtx, pool, task.ID, agentID)
+		// The agent may have been handed follow-on tasks since it was spawned.
+		taskID, ok := registry.TaskID(agentID)
+		if !ok {
+			taskID = task.ID
+		}
+		// ProcessState is nil if Wait failed before the process ran.
+		exitCode := -1
+		if cmd.ProcessState != nil {
+			exitCode = cmd.ProcessState.ExitCode()
 		}
+		var hit limitHit
+		if cgroup != nil {
+			hit = cgroup.limitHit(cmd.ProcessState)
+			cgroup.remove()
+		} else if !rlimits.IsZero() {
+			hit = rlimitHit(cmd.ProcessState, rlimits)
+		}
+		if claudeDir != "" {
+			_ = os.RemoveAll(claudeDir)
+		}
+		if config.AgentDBRoles {
+			dropAgentRole(pool, agentID)
+		}
+		if registry.Exited(agentID, exitCode) {
+			metrics.Exits.Inc(metrics.ExitShutdown)
+			return // Shutdown finalises agents that stop while it runs.
+		}
+
+		finishSession(pool, agentID, taskID, exitCode, err, hit)
 	}()
 
-	log.Printf("spawned agent %s for task %d: %q", agentID[:8], task.ID, task.Title)
+	metrics.Spawns.Inc(spawnReason)
+	logger.Info("spawned agent", logging.AgentID, agentID, logging.TaskID, task.ID, "title", task.Title)
 	return agentID, nil
 }
+
+// dropAgentRole revokes an agent's database access once its process is gone.
+func dropAgentRole(pool *pgxpool.Pool, agentID string) {
+	if err := db.DropAgentRole(context.Background(), pool, agentID); err != nil {
+		logger.Warn("failed to drop agent database role", logging.AgentID, agentID, "err", err)
+	}
+}
+
+// reportSandboxViolation logs a sandbox violation and records it for the dashboard.
+func reportSandboxViolation(pool *pgxpool.Pool, registry *AgentRegistry, agentID string, spawnedFor int64, detail string) {
+	taskID, ok := registry.TaskID(agentID)
+	if !ok {
+		taskID = spawnedFor
+	}
+	logger.Warn("sandbox violation", logging.AgentID, agentID, logging.TaskID, taskID, "detail", detail)
+	go func() {
+		if err := db.RecordSandboxViolation(context.Background(), pool, agentID, taskID, detail); err != nil {
+			logger.Warn("failed to record sandbox violation", logging.AgentID, agentID, "err", err)
+		}
+	}()
+}
+
+// writeAgentConfig writes the agent's .mcp.json and Claude settings file and
+// keeps every generated file out of git.
+func writeAgentConfig(ctx context.Context, agentID string, task dag.Task, branchName, worktreePath string,
+	profile PermissionProfile, mcpServers []string, config Config) error {
+
+	env, err := mcpLogEnv(config.Logging, worktreePath)
+	if err != nil {
+		return fmt.Errorf("generate .mcp.json: %w", err)
+	}
+	// Tool calls are traced as children of the task, not of this spawn.
+	for k, v := range tracing.Env(taskContext(ctx, task), config.Tracing) {
+		env[k] = v
+	}
+	if config.Tracing.Enabled() {
+		if err := writeTraceparent(ctx, task, worktreePath, config); err != nil {
+			return fmt.Errorf("write %s: %w", TraceparentFile, err)
+		}
+		path, err := filepath.Abs(filepath.Join(worktreePath, TraceparentFile))
+		if err != nil {
+			return fmt.Errorf("write %s: %w", TraceparentFile, err)
+		}
+		env[tracing.TraceparentFileEnv] = path
+	}
+	mcpJSON, err := GenerateMCPConfig(agentID, branchName, config.MCPPgBinary, config.ProjectMCPConfig, task.MCPServers, env)
+	if err != nil {
+		return fmt.Errorf("generate .mcp.json: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(worktreePath, ".mcp.json"), mcpJSON, 0644); err != nil {
+		return fmt.Errorf("write .mcp.json: %w", err)
+	}
+
+	settings, err := GenerateClaudeSettings(profile, mcpServers)
+	if err != nil {
+		return fmt.Errorf("generate %s: %w", ClaudeSettingsPath, err)
+	}
+	settingsPath := filepath.Join(worktreePath, ClaudeSettingsPath)
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0755); err != nil {
+		return fmt.Errorf("write %s: %w", ClaudeSettingsPath, err)
+	}
+	if err := os.WriteFile(settingsPath, settings, 0644); err != nil {
+		return fmt.Errorf("write %s: %w", ClaudeSettingsPath, err)
+	}
+
+	if err := ExcludeGeneratedFiles(worktreePath); err != nil {
+		return fmt.Errorf("exclude generated files: %w", err)
+	}
+	return nil
+}
+
+// finishSession finalises the agent row and task after the claude process exits.
+// If the agent already reported a terminal status via update_task, that status
+// is kept; otherwise the exit code decides whether the task completed or failed.
+// hit is set when a resource limit stopped the agent.
+func finishSession(pool *pgxpool.Pool, agentID string, taskID int64, exitCode int, waitErr error, hit limitHit) {
+	bgCtx := context.Background()
+
+	task, err := db.GetTask(bgCtx, pool, taskID)
+	if err != nil {
+		logger.Warn("failed to read task status", logging.TaskID, taskID, "err", err)
+	}
+	status := task.Status
+
+	agentLog := logger.With(logging.AgentID, agentID, logging.TaskID, taskID, "exit_code", exitCode)
+	switch {
+	case status == "completed":
+		agentLog.Info("agent completed")
+		metrics.Exits.Inc(metrics.ExitCompleted)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "idle", exitCode)
+	case status == "cancelled":
+		agentLog.Info("agent stopped, task was cancelled")
+		metrics.Exits.Inc(metrics.ExitCancelled)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "stopped", exitCode)
+	case status == "failed" && task.FailureReason == db.FailureTimeout:
+		agentLog.Info("agent stopped, task timed out")
+		metrics.Exits.Inc(metrics.ExitTimeout)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "dead", exitCode)
+	case status == "failed":
+		agentLog.Info("agent reported failure")
+		metrics.Exits.Inc(metrics.ExitFailed)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "dead", exitCode)
+	case waitErr != nil && hit.Reason != "":
+		agentLog.Warn("agent failed: hit its resource limit", "reason", hit.Reason, "detail", hit.Detail, "err", waitErr)
+		metrics.Exits.Inc(hit.Reason)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "dead", exitCode)
+		_ = db.FailTask(bgCtx, pool, taskID, agentID, hit.Reason,
+			fmt.Sprintf("agent stopped by its resource limit (%s): %s: %v", hit.Reason, hit.Detail, waitErr))
+	case waitErr != nil:
+		agentLog.Warn("agent failed", "err", waitErr)
+		metrics.Exits.Inc(db.FailureExit)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "dead", exitCode)
+		_ = db.FailTask(bgCtx, pool, taskID, agentID, db.FailureExit, "")
+	default:
+		agentLog.Info("agent exited, task completed")
+		metrics.Exits.Inc(metrics.ExitCompleted)
+		_ = db.FinishAgent(bgCtx, pool, agentID, "idle", exitCode)
+		_ = db.CompleteTask(bgCtx, pool, taskID, agentID)
+	}
+}
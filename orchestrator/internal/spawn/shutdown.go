@@ -0,0 +1,87 @@
+package spawn
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const shutdownMessage = "The orchestrator is shutting down. Stop what you are doing, " +
+	"commit your work-in-progress now with a commit message starting with \"WIP:\" " +
+	"that says what is done and what is left, and then stop. " +
+	"Do NOT call update_task; the task will be resumed later from your branch."
+
+// Shutdown stops every running agent without losing its work. Agents are
+// asked to commit and stop, then given grace to exit before being killed.
+// Whatever they left uncommitted is committed as a WIP commit, their
+// unfinished tasks go back to pending with a resume note, and the agents
+// are marked stopped.
+func Shutdown(pool *pgxpool.Pool, registry *AgentRegistry, grace time.Duration) {
+	ctx := context.Background()
+
+	live := registry.BeginShutdown()
+	logger.Info("shutdown: asking agents to commit and stop", "agents", len(live), "grace", grace)
+	for _, agentID := range live {
+		// A paused agent cannot read its stdin or exit.
+		if err := registry.Resume(agentID); err != nil {
+			logger.Warn("shutdown: failed to resume agent", logging.AgentID, agentID, "err", err)
+		}
+		if err := registry.Send(agentID, shutdownMessage); err != nil {
+			logger.Warn("shutdown: failed to notify agent", logging.AgentID, agentID, "err", err)
+		}
+		// Ending stdin lets claude --print finish this last turn and exit.
+		_ = registry.Close(agentID)
+	}
+
+	if !registry.WaitAll(grace) {
+		logger.Warn("shutdown: grace period elapsed, killing remaining agents")
+		registry.KillAll()
+		registry.WaitAll(5 * time.Second)
+	}
+
+	for _, a := range registry.StoppedAgents() {
+		preserveWork(ctx, pool, a)
+	}
+}
+
+// preserveWork commits an interrupted agent's leftover changes, resets its
+// unfinished task for resumption and marks the agent stopped.
+func preserveWork(ctx context.Context, pool *pgxpool.Pool, a StoppedAgent) {
+	status, err := db.TaskStatus(ctx, pool, a.TaskID)
+	if err != nil {
+		logger.Warn("shutdown: failed to read task status", logging.TaskID, a.TaskID, "err", err)
+	}
+
+	if err == nil && !db.IsTerminalStatus(status) {
+		note := fmt.Sprintf("Resuming: agent %s was stopped by an orchestrator shutdown while working on this task.", a.AgentID[:8])
+
+		worktreePath, err := db.AgentWorktreePath(ctx, pool, a.AgentID)
+		if err != nil || worktreePath == "" {
+			logger.Warn("shutdown: no worktree for agent", logging.AgentID, a.AgentID, "err", err)
+		} else {
+			sha, err := CommitWIP(worktreePath, fmt.Sprintf("WIP: task #%d (orchestrator shutdown)", a.TaskID))
+			switch {
+			case err != nil:
+				logger.Warn("shutdown: failed to commit WIP", logging.AgentID, a.AgentID, logging.TaskID, a.TaskID, "err", err)
+			case sha != "":
+				logger.Info("shutdown: committed leftover changes", logging.AgentID, a.AgentID, logging.TaskID, a.TaskID, "sha", sha[:8])
+				note += fmt.Sprintf(" Its uncommitted changes were saved in WIP commit %s.", sha[:8])
+			}
+		}
+		note += " Your branch already contains its work: review the recent commits (`git log`) and continue from there."
+
+		if err := db.ResetTaskForResume(ctx, pool, a.TaskID, note); err != nil {
+			logger.Warn("shutdown: failed to reset task", logging.TaskID, a.TaskID, "err", err)
+		} else {
+			logger.Info("shutdown: task reset to pending", logging.TaskID, a.TaskID)
+		}
+	}
+
+	if err := db.FinishAgent(ctx, pool, a.AgentID, "stopped", a.ExitCode); err != nil {
+		logger.Warn("shutdown: failed to mark agent stopped", logging.AgentID, a.AgentID, "err", err)
+	}
+}
@@ -0,0 +1,90 @@
+package spawn
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/affanhamid/editor/logging"
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/tracing"
+)
+
+// taskSpans holds the span of every task this run is tracing, from its
+// creation (or the spawn that resumed it) until it reaches a terminal status.
+// Spawn steps, and through TRACEPARENT the agent's MCP tool calls, are its
+// children.
+var taskSpans = struct {
+	sync.Mutex
+	m map[int64]*tracing.Span
+}{m: map[int64]*tracing.Span{}}
+
+// TrackTaskSpan makes span the span of a task.
+func TrackTaskSpan(taskID int64, span *tracing.Span) {
+	if span == nil {
+		return
+	}
+	taskSpans.Lock()
+	taskSpans.m[taskID] = span
+	taskSpans.Unlock()
+}
+
+// taskContext returns ctx with the task's span, starting one if the task
+// was created by an earlier run or outside the decomposition.
+func taskContext(ctx context.Context, task dag.Task) context.Context {
+	taskSpans.Lock()
+	defer taskSpans.Unlock()
+	if span, ok := taskSpans.m[task.ID]; ok {
+		return tracing.ContextWithSpan(ctx, span)
+	}
+	ctx, span := tracing.Start(ctx, "task", slog.Int64(logging.TaskID, task.ID), slog.String("title", task.Title))
+	if span != nil {
+		taskSpans.m[task.ID] = span
+	}
+	return ctx
+}
+
+// TraceparentFile holds the traceparent of the task an agent works on. Its
+// mcp-pg reads it on every tool call, so the calls of a reused agent are
+// traced under its current task rather than the one it was spawned for.
+const TraceparentFile = ".architect-traceparent"
+
+// writeTraceparent points the tool calls of the agent in worktreePath at
+// the span of task.
+func writeTraceparent(ctx context.Context, task dag.Task, worktreePath string, config Config) error {
+	if !config.Tracing.Enabled() {
+		return nil
+	}
+	tp := tracing.Traceparent(taskContext(ctx, task))
+	return os.WriteFile(filepath.Join(worktreePath, TraceparentFile), []byte(tp+"\n"), 0644)
+}
+
+// EndTaskSpan ends the span of a task that reached a terminal status.
+func EndTaskSpan(taskID int64, status string) {
+	taskSpans.Lock()
+	span, ok := taskSpans.m[taskID]
+	delete(taskSpans.m, taskID)
+	taskSpans.Unlock()
+	if !ok {
+		return
+	}
+	span.SetAttributes(slog.String("status", status))
+	if status == "failed" {
+		span.SetError(errors.New("task failed"))
+	}
+	span.End()
+}
+
+// EndTaskSpans ends the spans of tasks left unfinished at shutdown.
+func EndTaskSpans() {
+	taskSpans.Lock()
+	defer taskSpans.Unlock()
+	for id, span := range taskSpans.m {
+		span.SetAttributes(slog.Bool("interrupted", true))
+		span.End()
+		delete(taskSpans.m, id)
+	}
+}
@@ -2,26 +2,23 @@ package spawn
 
 import (
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
 // CreateWorktree creates a git worktree for an agent.
-// If parentWorktrees is non-empty, it branches from the first parent and
+// If parentBranches is non-empty, it branches from the first parent and
 // merges the rest, so the agent starts with all dependency work.
-func CreateWorktree(projectDir string, agentID string, taskID int64, parentWorktrees []string) (string, string, error) {
-	branchName := fmt.Sprintf("agent/%s/task-%d", agentID[:8], taskID)
+func CreateWorktree(projectDir string, agentID string, taskID int64, parentBranches []string) (string, string, error) {
+	branchName := BranchName(agentID, taskID)
 	worktreePath := filepath.Join(projectDir, ".worktrees", fmt.Sprintf("agent-%s", agentID[:8]))
 
 	// Determine base ref: first parent's branch, or the repo's default branch
-	baseRef := defaultBranch(projectDir)
-	if len(parentWorktrees) > 0 {
-		// Extract branch name from the first parent worktree
-		branch, err := worktreeBranch(projectDir, parentWorktrees[0])
-		if err == nil && branch != "" {
-			baseRef = branch
-		}
+	baseRef := DefaultBranch(projectDir)
+	if len(parentBranches) > 0 {
+		baseRef = parentBranches[0]
 	}
 
 	cmd := exec.Command("git", "worktree", "add", worktreePath, "-b", branchName, baseRef)
@@ -31,10 +28,28 @@ func CreateWorktree(projectDir string, agentID string, taskID int64, parentWorkt
 		return "", "", fmt.Errorf("git worktree add: %w\n%s", err, out)
 	}
 
-	// Merge remaining parent branches into the new worktree
-	for _, pw := range parentWorktrees[min(1, len(parentWorktrees)):] {
-		branch, err := worktreeBranch(projectDir, pw)
-		if err != nil || branch == "" || branch == baseRef {
+	mergeBranches(worktreePath, parentBranches[min(1, len(parentBranches)):])
+	return worktreePath, branchName, nil
+}
+
+// BranchWorktree starts a new branch for taskID from the current HEAD of an
+// existing agent worktree and merges in any parent branches it does not yet contain.
+// Used when an idle agent is handed a follow-on task.
+func BranchWorktree(worktreePath string, agentID string, taskID int64, parentBranches []string) (string, error) {
+	branchName := BranchName(agentID, taskID)
+	cmd := exec.Command("git", "checkout", "-b", branchName)
+	cmd.Dir = worktreePath
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git checkout -b: %w\n%s", err, out)
+	}
+	mergeBranches(worktreePath, parentBranches)
+	return branchName, nil
+}
+
+// mergeBranches merges each branch into the worktree, skipping ones that fail.
+func mergeBranches(worktreePath string, branches []string) {
+	for _, branch := range branches {
+		if isAncestor(worktreePath, branch) {
 			continue
 		}
 		mergeCmd := exec.Command("git", "merge", "--no-edit", branch)
@@ -44,30 +59,168 @@ func CreateWorktree(projectDir string, agentID string, taskID int64, parentWorkt
 			abortCmd := exec.Command("git", "merge", "--abort")
 			abortCmd.Dir = worktreePath
 			_ = abortCmd.Run()
-			fmt.Printf("warning: merge of %s failed, skipping: %s\n", branch, mergeOut)
+			logger.Warn("merge failed, skipping", "branch", branch, "output", string(mergeOut))
 		}
 	}
+}
 
-	return worktreePath, branchName, nil
+// isAncestor reports whether ref is already contained in the worktree's HEAD.
+func isAncestor(worktreePath string, ref string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", ref, "HEAD")
+	cmd.Dir = worktreePath
+	return cmd.Run() == nil
 }
 
-// worktreeBranch returns the branch name checked out in a worktree path.
-func worktreeBranch(projectDir string, worktreePath string) (string, error) {
-	absPath := worktreePath
-	if !filepath.IsAbs(absPath) {
-		absPath = filepath.Join(projectDir, absPath)
+// generatedFiles are written into every worktree by the orchestrator and
+// must never end up in an agent's commits.
+var generatedFiles = []string{"agent.log", MCPLogFile, "CLAUDE.md", ".mcp.json", ClaudeSettingsPath, TraceparentFile}
+
+// MCPLogFile is the log of the agent's mcp-pg, next to agent.log.
+const MCPLogFile = "mcp-pg.log"
+
+// ExcludeGeneratedFiles keeps the generated files out of anything an agent
+// commits itself (e.g. with `git add -A`). Untracked ones are listed in the
+// repository's info/exclude; ones the project tracks, such as its own
+// CLAUDE.md or .mcp.json, are marked skip-worktree in the worktree's index
+// so the agent's copies never show up as modifications.
+func ExcludeGeneratedFiles(worktreePath string) error {
+	pathCmd := exec.Command("git", "rev-parse", "--git-path", "info/exclude")
+	pathCmd.Dir = worktreePath
+	out, err := pathCmd.Output()
+	if err != nil {
+		return fmt.Errorf("git rev-parse --git-path: %w", err)
 	}
-	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
-	cmd.Dir = absPath
+	excludePath := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(excludePath) {
+		excludePath = filepath.Join(worktreePath, excludePath)
+	}
+
+	existing, err := os.ReadFile(excludePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+	var add strings.Builder
+	for _, f := range generatedFiles {
+		if pattern := "/" + f; !have[pattern] {
+			add.WriteString(pattern + "\n")
+		}
+	}
+	if add.Len() > 0 {
+		if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(excludePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+			file.WriteString("\n")
+		}
+		_, err = file.WriteString(add.String())
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range generatedFiles {
+		lsCmd := exec.Command("git", "ls-files", "--error-unmatch", "--", f)
+		lsCmd.Dir = worktreePath
+		if lsCmd.Run() != nil {
+			continue // not tracked
+		}
+		skipCmd := exec.Command("git", "update-index", "--skip-worktree", "--", f)
+		skipCmd.Dir = worktreePath
+		if out, err := skipCmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git update-index --skip-worktree %s: %w\n%s", f, err, out)
+		}
+	}
+	return nil
+}
+
+// CommitWIP commits every uncommitted change in a worktree (except the
+// orchestrator's generated files) and returns the new commit SHA, or "" if
+// there was nothing to commit.
+func CommitWIP(worktreePath string, message string) (string, error) {
+	args := []string{"add", "-A", "--", "."}
+	for _, f := range generatedFiles {
+		args = append(args, ":(exclude)"+f)
+	}
+	addCmd := exec.Command("git", args...)
+	addCmd.Dir = worktreePath
+	if out, err := addCmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git add: %w\n%s", err, out)
+	}
+
+	// Nothing staged: exit status 0 from diff --cached --quiet.
+	diffCmd := exec.Command("git", "diff", "--cached", "--quiet")
+	diffCmd.Dir = worktreePath
+	if diffCmd.Run() == nil {
+		return "", nil
+	}
+
+	commitCmd := exec.Command("git", "commit", "--no-verify", "-m", message)
+	commitCmd.Dir = worktreePath
+	if out, err := commitCmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("git commit: %w\n%s", err, out)
+	}
+
+	return HeadCommit(worktreePath)
+}
+
+// HeadCommit returns the SHA of a worktree's HEAD.
+func HeadCommit(worktreePath string) (string, error) {
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = worktreePath
 	out, err := cmd.Output()
 	if err != nil {
-		return "", err
+		return "", fmt.Errorf("git rev-parse: %w", err)
 	}
 	return strings.TrimSpace(string(out)), nil
 }
 
-// defaultBranch returns the current branch of the repo (HEAD), falling back to "main".
-func defaultBranch(projectDir string) string {
+// ChangedFiles lists the files changed in a worktree since base: committed,
+// uncommitted and untracked, but not the orchestrator's generated files.
+func ChangedFiles(worktreePath string, base string) ([]string, error) {
+	diffCmd := exec.Command("git", "diff", "--name-only", "--no-renames", base, "--")
+	diffCmd.Dir = worktreePath
+	changed, err := diffCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff: %w", err)
+	}
+	lsCmd := exec.Command("git", "ls-files", "--others", "--exclude-standard")
+	lsCmd.Dir = worktreePath
+	untracked, err := lsCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w", err)
+	}
+
+	generated := make(map[string]bool, len(generatedFiles))
+	for _, f := range generatedFiles {
+		generated[f] = true
+	}
+	var files []string
+	for _, f := range strings.Split(string(changed)+string(untracked), "\n") {
+		if f != "" && !generated[f] {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// BranchName returns the git branch an agent works on for a task.
+func BranchName(agentID string, taskID int64) string {
+	return fmt.Sprintf("agent/%s/task-%d", agentID[:8], taskID)
+}
+
+// DefaultBranch returns the current branch of the repo (HEAD), falling back to "main".
+func DefaultBranch(projectDir string) string {
 	cmd := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD")
 	cmd.Dir = projectDir
 	out, err := cmd.Output()
@@ -81,9 +234,59 @@ func defaultBranch(projectDir string) string {
 	return branch
 }
 
-// RemoveWorktree cleans up after an agent is done.
+// RemoveWorktree cleans up after an agent is done. It forces removal because
+// agent worktrees always carry generated files (agent.log, CLAUDE.md, .mcp.json, ...).
 func RemoveWorktree(projectDir string, worktreePath string) error {
-	cmd := exec.Command("git", "worktree", "remove", worktreePath)
+	cmd := exec.Command("git", "worktree", "remove", "--force", worktreePath)
+	cmd.Dir = projectDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree remove: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// DeleteBranch force-deletes a local branch.
+func DeleteBranch(projectDir string, branchName string) error {
+	cmd := exec.Command("git", "branch", "-D", branchName)
 	cmd.Dir = projectDir
-	return cmd.Run()
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git branch -D: %w\n%s", err, out)
+	}
+	return nil
+}
+
+// BranchExists reports whether a local branch exists.
+func BranchExists(projectDir string, branchName string) bool {
+	cmd := exec.Command("git", "rev-parse", "--verify", "--quiet", "refs/heads/"+branchName)
+	cmd.Dir = projectDir
+	return cmd.Run() == nil
+}
+
+// CommitsAhead returns how many commits branch has that base does not.
+func CommitsAhead(projectDir string, base string, branch string) (int, error) {
+	cmd := exec.Command("git", "rev-list", "--count", base+".."+branch)
+	cmd.Dir = projectDir
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("git rev-list: %w", err)
+	}
+	var n int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "%d", &n); err != nil {
+		return 0, fmt.Errorf("parse rev-list count: %w", err)
+	}
+	return n, nil
+}
+
+// PruneWorktrees removes git's administrative data for worktrees whose
+// directories no longer exist.
+func PruneWorktrees(projectDir string) error {
+	cmd := exec.Command("git", "worktree", "prune")
+	cmd.Dir = projectDir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git worktree prune: %w\n%s", err, out)
+	}
+	return nil
 }
@@ -0,0 +1,171 @@
+package spawn
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	git(t, dir, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(dir, "README"), []byte("hello\n"), 0644)
+	git(t, dir, "add", "README")
+	git(t, dir, "commit", "-q", "-m", "init")
+	return dir
+}
+
+func TestCreateAndBranchWorktree(t *testing.T) {
+	repo := initRepo(t)
+	agentID := "abc12345-6789-0000-0000-000000000000"
+
+	path, branch, err := CreateWorktree(repo, agentID, 1, nil)
+	if err != nil {
+		t.Fatalf("create worktree: %v", err)
+	}
+	if branch != "agent/abc12345/task-1" {
+		t.Errorf("unexpected branch %q", branch)
+	}
+
+	os.WriteFile(filepath.Join(path, "a.txt"), []byte("a\n"), 0644)
+	git(t, path, "add", "a.txt")
+	git(t, path, "commit", "-q", "-m", "task 1")
+
+	if n, err := CommitsAhead(repo, "main", branch); err != nil || n != 1 {
+		t.Fatalf("expected 1 commit ahead, got %d (%v)", n, err)
+	}
+
+	next, err := BranchWorktree(path, agentID, 2, []string{branch})
+	if err != nil {
+		t.Fatalf("branch worktree: %v", err)
+	}
+	if next != "agent/abc12345/task-2" || !BranchExists(repo, next) {
+		t.Fatalf("expected branch %q to exist", next)
+	}
+	if _, err := os.Stat(filepath.Join(path, "a.txt")); err != nil {
+		t.Error("follow-on branch should contain the previous task's work")
+	}
+
+	if err := RemoveWorktree(repo, path); err != nil {
+		t.Fatalf("remove worktree: %v", err)
+	}
+	for _, b := range []string{branch, next} {
+		if err := DeleteBranch(repo, b); err != nil {
+			t.Fatalf("delete branch: %v", err)
+		}
+	}
+	if err := PruneWorktrees(repo); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+}
+
+func TestCommitWIP(t *testing.T) {
+	repo := initRepo(t)
+	git(t, repo, "config", "user.name", "test")
+	git(t, repo, "config", "user.email", "test@example.com")
+
+	sha, err := CommitWIP(repo, "WIP: nothing")
+	if err != nil || sha != "" {
+		t.Fatalf("expected no commit on a clean tree, got %q (%v)", sha, err)
+	}
+
+	os.WriteFile(filepath.Join(repo, "work.go"), []byte("package work\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "agent.log"), []byte("{}\n"), 0644)
+	sha, err = CommitWIP(repo, "WIP: task #1")
+	if err != nil || sha == "" {
+		t.Fatalf("expected a WIP commit, got %q (%v)", sha, err)
+	}
+
+	cmd := exec.Command("git", "show", "--name-only", "--format=", "HEAD")
+	cmd.Dir = repo
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(out); got != "work.go\n" {
+		t.Errorf("expected only work.go in WIP commit, got %q", got)
+	}
+}
+
+func TestExcludeGeneratedFiles(t *testing.T) {
+	repo := initRepo(t)
+	// The project tracks its own CLAUDE.md; the rest are untracked.
+	os.WriteFile(filepath.Join(repo, "CLAUDE.md"), []byte("project\n"), 0644)
+	git(t, repo, "add", "CLAUDE.md")
+	git(t, repo, "commit", "-q", "-m", "claude")
+
+	path, _, err := CreateWorktree(repo, "abc12345-6789-0000-0000-000000000000", 1, nil)
+	if err != nil {
+		t.Fatalf("create worktree: %v", err)
+	}
+	for _, f := range generatedFiles {
+		os.MkdirAll(filepath.Dir(filepath.Join(path, f)), 0755)
+		os.WriteFile(filepath.Join(path, f), []byte("generated\n"), 0644)
+	}
+	// Twice: must not duplicate exclude entries or fail on tracked files.
+	for i := 0; i < 2; i++ {
+		if err := ExcludeGeneratedFiles(path); err != nil {
+			t.Fatalf("exclude: %v", err)
+		}
+	}
+
+	cmd := exec.Command("git", "status", "--porcelain", "--untracked-files=all")
+	cmd.Dir = path
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out) != 0 {
+		t.Errorf("expected generated files to be invisible to git, got:\n%s", out)
+	}
+
+	exclude, err := os.ReadFile(filepath.Join(repo, ".git", "info", "exclude"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(exclude), "/.mcp.json\n"); n != 1 {
+		t.Errorf("expected one /.mcp.json entry, got %d:\n%s", n, exclude)
+	}
+}
+
+func TestChangedFiles(t *testing.T) {
+	repo := initRepo(t)
+	base, err := HeadCommit(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(repo, "committed.go"), []byte("package a\n"), 0644)
+	git(t, repo, "add", "committed.go")
+	git(t, repo, "commit", "-q", "-m", "work")
+	os.WriteFile(filepath.Join(repo, "README"), []byte("changed\n"), 0644)
+	os.MkdirAll(filepath.Join(repo, "pkg"), 0755)
+	os.WriteFile(filepath.Join(repo, "pkg", "new.go"), []byte("package pkg\n"), 0644)
+	os.WriteFile(filepath.Join(repo, "agent.log"), []byte("{}\n"), 0644)
+
+	files, err := ChangedFiles(repo, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(files, " "); got != "README committed.go pkg/new.go" {
+		t.Errorf("changed files = %q", got)
+	}
+}
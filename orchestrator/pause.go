@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+)
+
+// runPause implements `architect pause [agent]` and `architect resume [agent]`.
+// It records the requested state in Postgres; the running orchestrator applies
+// it to the agent processes.
+func runPause(args []string, pause bool) {
+	name := "resume"
+	if pause {
+		name = "pause"
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	dbURL := fs.String("db", defaultDBURL, "PostgreSQL connection string")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: architect %s [flags] [agent-id]\n\nWithout an agent ID, %ss the whole swarm.\n\n", name, name)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	ctx := context.Background()
+	pool, err := db.NewPool(ctx, *dbURL)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer pool.Close()
+
+	if fs.NArg() == 0 {
+		if err := db.SetSwarmPaused(ctx, pool, pause); err != nil {
+			log.Fatalf("failed to %s swarm: %v", name, err)
+		}
+		fmt.Printf("swarm %sd\n", name)
+		return
+	}
+
+	agentID, err := db.ResolveAgentID(ctx, pool, fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	setStatus := db.ResumeAgents
+	if pause {
+		setStatus = db.PauseAgents
+	}
+	changed, err := setStatus(ctx, pool, []string{agentID})
+	if err != nil {
+		log.Fatalf("failed to %s agent: %v", name, err)
+	}
+	if len(changed) == 0 {
+		log.Fatalf("agent %s is not in a state that can be %sd", agentID[:8], name)
+	}
+	fmt.Printf("agent %s %sd\n", agentID[:8], name)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/affanhamid/editor/orchestrator/internal/dag"
+	"github.com/affanhamid/editor/orchestrator/internal/db"
+	"github.com/affanhamid/editor/orchestrator/internal/spawn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// validatePlan checks that every task of a plan can be created and spawned.
+func validatePlan(d *dag.DAG) error {
+	if err := dag.ValidateTasks(d.Tasks); err != nil {
+		return err
+	}
+	for _, task := range d.Tasks {
+		if _, err := spawn.LookupPermissionProfile(task.PermissionProfile); err != nil {
+			return fmt.Errorf("task %d: %w", task.ID, err)
+		}
+		if err := spawn.ValidateMCPServers(task.MCPServers); err != nil {
+			return fmt.Errorf("task %d: %w", task.ID, err)
+		}
+	}
+	return nil
+}
+
+// reviewPlan holds a decomposed plan for review and returns the plan to run:
+// the proposal or the reviewer's edit of it. It returns nil if the reviewer
+// rejected the plan. An approved plan that cannot run is sent back for
+// review with the reason.
+func reviewPlan(ctx context.Context, pool *pgxpool.Pool, prompt string, proposed *dag.DAG) (*dag.DAG, error) {
+	data, err := dag.MarshalPlan(proposed)
+	if err != nil {
+		return nil, err
+	}
+	id, err := db.CreatePlan(ctx, pool, prompt, data)
+	if err != nil {
+		return nil, fmt.Errorf("store plan: %w", err)
+	}
+	if err := validatePlan(proposed); err != nil {
+		if err := db.ReturnPlan(ctx, pool, id, err.Error()); err != nil {
+			return nil, err
+		}
+	}
+	slog.Info("plan awaiting review; approve, reject or edit it in the editor or with `architect plan`",
+		"plan_id", id, "tasks", len(proposed.Tasks))
+
+	for {
+		p, err := db.WaitPlanReview(ctx, pool, id)
+		if err != nil {
+			return nil, err
+		}
+		if p.Status == "rejected" {
+			slog.Info("plan rejected", "plan_id", id, "reviewed_by", p.ReviewedBy)
+			return nil, nil
+		}
+		d, err := dag.ParsePlan(p.Approved)
+		if err == nil {
+			err = validatePlan(d)
+		}
+		if err == nil {
+			slog.Info("plan approved", "plan_id", id, "reviewed_by", p.ReviewedBy, "tasks", len(d.Tasks))
+			return d, nil
+		}
+		slog.Warn("approved plan cannot run, returned for review", "plan_id", id, "err", err)
+		if err := db.ReturnPlan(ctx, pool, id, err.Error()); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// runPlan implements `architect plan [show|approve|reject|edit] [plan-id]`.
+// Without a plan ID it acts on the newest plan awaiting review.
+func runPlan(args []string) {
+	action := "show"
+	if len(args) > 0 {
+		switch args[0] {
+		case "show", "approve", "reject", "edit":
+			action, args = args[0], args[1:]
+		}
+	}
+	f := newInspectFlags("plan", "plan [show|approve|reject|edit] [flags] [plan-id]")
+	file := f.fs.String("file", "", "With edit, read the edited plan from this file instead of opening $EDITOR")
+	f.fs.Parse(args)
+
+	ctx := context.Background()
+	pool := connect(ctx, *f.dbURL)
+	defer pool.Close()
+
+	var p db.Plan
+	var err error
+	switch f.fs.NArg() {
+	case 0:
+		p, err = db.LatestPendingPlan(ctx, pool)
+		if errors.Is(err, pgx.ErrNoRows) {
+			log.Fatal("no plan is awaiting review")
+		}
+	case 1:
+		id, perr := strconv.ParseInt(f.fs.Arg(0), 10, 64)
+		if perr != nil {
+			log.Fatalf("invalid plan ID %q", f.fs.Arg(0))
+		}
+		p, err = db.GetPlan(ctx, pool, id)
+	default:
+		f.fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("failed to read plan: %v", err)
+	}
+
+	switch action {
+	case "show":
+		showPlan(p, *f.asJSON)
+	case "approve", "reject":
+		reviewPlanCLI(ctx, pool, p, action == "approve", nil)
+	case "edit":
+		edited, err := editPlan(p, *file)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reviewPlanCLI(ctx, pool, p, true, edited)
+	}
+}
+
+func showPlan(p db.Plan, asJSON bool) {
+	if asJSON {
+		printJSON(p)
+		return
+	}
+	fmt.Printf("plan %d: %s (created %s)\n", p.ID, p.Status, ago(p.CreatedAt))
+	if p.ReviewError != "" {
+		fmt.Printf("returned for review: %s\n", p.ReviewError)
+	}
+	fmt.Printf("prompt: %s\n\n", oneLine(p.Prompt, 100))
+
+	plan := p.Proposed
+	if len(p.Approved) > 0 {
+		plan = p.Approved
+	}
+	d, err := dag.ParsePlan(plan)
+	if err != nil {
+		fmt.Printf("%s\n\n(%v)\n", plan, err)
+		return
+	}
+	w := newTable()
+	fmt.Fprintln(w, "ID\tRISK\tBLOCKED BY\tTITLE")
+	for _, t := range d.Tasks {
+		blockedBy := ""
+		for i, dep := range t.BlockedBy {
+			if i > 0 {
+				blockedBy += ","
+			}
+			blockedBy += strconv.FormatInt(dep, 10)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", t.ID, t.RiskLevel, orDash(blockedBy), oneLine(t.Title, 70))
+	}
+	w.Flush()
+}
+
+// editPlan returns the reviewer's edit of a plan, read from file or written
+// in $EDITOR, after checking that it parses.
+func editPlan(p db.Plan, file string) ([]byte, error) {
+	if file == "" {
+		tmp, err := os.CreateTemp("", fmt.Sprintf("architect-plan-%d-*.json", p.ID))
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		d, err := dag.ParsePlan(p.Proposed)
+		plan := []byte(p.Proposed)
+		if err == nil {
+			plan, _ = dag.MarshalPlan(d)
+		}
+		if _, err := tmp.Write(append(plan, '\n')); err != nil {
+			return nil, err
+		}
+		tmp.Close()
+
+		editor := os.Getenv("EDITOR")
+		if editor == "" {
+			editor = "vi"
+		}
+		cmd := exec.Command(editor, tmp.Name())
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%s: %w", editor, err)
+		}
+		file = tmp.Name()
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dag.ParsePlan(data); err != nil {
+		return nil, fmt.Errorf("edited plan: %w", err)
+	}
+	return data, nil
+}
+
+func reviewPlanCLI(ctx context.Context, pool *pgxpool.Pool, p db.Plan, approve bool, edited []byte) {
+	ok, err := db.ReviewPlan(ctx, pool, p.ID, approve, edited, "cli")
+	if err != nil {
+		log.Fatalf("failed to review plan %d: %v", p.ID, err)
+	}
+	if !ok {
+		log.Fatalf("plan %d is not awaiting review (status %s)", p.ID, p.Status)
+	}
+	switch {
+	case !approve:
+		fmt.Printf("plan %d rejected\n", p.ID)
+	case edited != nil:
+		fmt.Printf("plan %d approved with edits\n", p.ID)
+	default:
+		fmt.Printf("plan %d approved\n", p.ID)
+	}
+}
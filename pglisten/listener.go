@@ -0,0 +1,132 @@
+// Package pglisten is a Postgres LISTEN/NOTIFY client that survives dropped
+// connections, and a consumer of the durable events outbox built on it. It
+// is shared by the orchestrator, the dashboard and architect-bridge.
+package pglisten
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Notification is a NOTIFY received on one of the listened channels, or a
+// reconnect marker.
+type Notification struct {
+	Channel string
+	Payload string
+	// Reconnected marks the first delivery after the connection was
+	// re-established. Notifications sent while the listener was down are
+	// lost, so the receiver should reconcile against current state.
+	Reconnected bool
+}
+
+// Listener listens on a set of channels, reconnecting with exponential
+// backoff whenever the connection drops.
+type Listener struct {
+	ConnString string
+	Channels   []string
+	// MinBackoff and MaxBackoff bound the delay between reconnect attempts.
+	// They default to 500ms and 30s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Logger reports connection loss and recovery; defaults to slog.Default().
+	Logger *slog.Logger
+	// OnReconnect, if set, is called each time a lost connection is
+	// re-established.
+	OnReconnect func()
+}
+
+// Run listens until ctx is cancelled, sending notifications to out. After
+// every reconnect it first sends a Notification with Reconnected set.
+func (l *Listener) Run(ctx context.Context, out chan<- Notification) {
+	logger := l.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	minBackoff, maxBackoff := l.MinBackoff, l.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = 500 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	connected := false
+	attempt := 0
+	for {
+		err := l.listen(ctx, out, connected, func() {
+			if attempt > 0 {
+				logger.Info("listener reconnected", "attempts", attempt)
+			}
+			if connected && l.OnReconnect != nil {
+				l.OnReconnect()
+			}
+			connected = true
+			attempt = 0
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		delay := Backoff(attempt, minBackoff, maxBackoff)
+		attempt++
+		logger.Warn("listener connection lost", "err", err, "retry_in", delay)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// listen runs one connection until it fails. onListening is called once all
+// channels are listened on; reconnect says whether a marker must be sent.
+func (l *Listener) listen(ctx context.Context, out chan<- Notification, reconnect bool, onListening func()) error {
+	conn, err := pgx.Connect(ctx, l.ConnString)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	for _, ch := range l.Channels {
+		if _, err := conn.Exec(ctx, "LISTEN "+ch); err != nil {
+			return fmt.Errorf("listen %s: %w", ch, err)
+		}
+	}
+	onListening()
+
+	if reconnect {
+		select {
+		case out <- Notification{Reconnected: true}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", err)
+		}
+		select {
+		case out <- Notification{Channel: n.Channel, Payload: n.Payload}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Backoff returns the delay before reconnect attempt n (starting at 0):
+// min doubled n times, capped at max.
+func Backoff(n int, min, max time.Duration) time.Duration {
+	d := min
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
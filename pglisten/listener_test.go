@@ -0,0 +1,26 @@
+package pglisten
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	min, max := 500*time.Millisecond, 5*time.Second
+	want := []time.Duration{
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		5 * time.Second,
+		5 * time.Second,
+	}
+	for n, w := range want {
+		if got := Backoff(n, min, max); got != w {
+			t.Errorf("Backoff(%d) = %s, want %s", n, got, w)
+		}
+	}
+	if got := Backoff(1000, min, max); got != max {
+		t.Errorf("Backoff(1000) = %s, want %s", got, max)
+	}
+}
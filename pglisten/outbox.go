@@ -0,0 +1,187 @@
+package pglisten
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WakeChannel is notified with the new sequence number whenever an event is
+// appended to the outbox.
+const WakeChannel = "events"
+
+// Event is a row of the events outbox table.
+type Event struct {
+	Seq       int64           `json:"seq"`
+	Channel   string          `json:"channel"`
+	EventType string          `json:"event_type"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Old       json.RawMessage `json:"old_value,omitempty"`
+	New       json.RawMessage `json:"new_value,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Consumer reads the events outbox in sequence order on behalf of a named
+// consumer, resuming after the last sequence it acknowledged. NOTIFY on
+// WakeChannel is only a wake-up; events are always read from the table, so
+// nothing is lost while the consumer is down or disconnected, and after a
+// reconnect the consumer catches up with what it missed in order.
+type Consumer struct {
+	// Name identifies the consumer's position in event_consumers. Running
+	// instances must not share a name, or each sees only part of the events.
+	Name       string
+	Pool       *pgxpool.Pool
+	ConnString string
+	// StartAtEnd makes a consumer seen for the first time start after the
+	// current end of the outbox, for consumers that read the current state
+	// themselves. Otherwise it starts with the first event.
+	StartAtEnd bool
+	// BatchSize limits how many events are read per query; defaults to 500.
+	BatchSize int
+	// PollInterval is a fallback re-read interval in case a wake-up is
+	// missed; defaults to 5s.
+	PollInterval time.Duration
+	// Logger defaults to slog.Default().
+	Logger *slog.Logger
+	// OnReconnect is passed on to the wake-up Listener.
+	OnReconnect func()
+}
+
+// Position returns the consumer's last acknowledged sequence, registering
+// a consumer seen for the first time (see StartAtEnd).
+func (c *Consumer) Position(ctx context.Context) (int64, error) {
+	_, err := c.Pool.Exec(ctx,
+		`INSERT INTO event_consumers (consumer, last_seq)
+		 VALUES ($1, CASE WHEN $2 THEN (SELECT COALESCE(MAX(seq), 0) FROM events) ELSE 0 END)
+		 ON CONFLICT (consumer) DO NOTHING`,
+		c.Name, c.StartAtEnd,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("register consumer %s: %w", c.Name, err)
+	}
+	var seq int64
+	err = c.Pool.QueryRow(ctx,
+		`SELECT last_seq FROM event_consumers WHERE consumer = $1`, c.Name,
+	).Scan(&seq)
+	return seq, err
+}
+
+// Ack records that every event up to and including seq has been handled.
+func (c *Consumer) Ack(ctx context.Context, seq int64) error {
+	_, err := c.Pool.Exec(ctx,
+		`UPDATE event_consumers SET last_seq = GREATEST(last_seq, $2), updated_at = NOW()
+		 WHERE consumer = $1`,
+		c.Name, seq,
+	)
+	return err
+}
+
+// Remove forgets the consumer's position, for consumers named after a
+// single instance that will not run again.
+func (c *Consumer) Remove(ctx context.Context) error {
+	_, err := c.Pool.Exec(ctx, `DELETE FROM event_consumers WHERE consumer = $1`, c.Name)
+	return err
+}
+
+// Fetch reads up to limit events after seq, in order.
+func (c *Consumer) Fetch(ctx context.Context, after int64, limit int) ([]Event, error) {
+	rows, err := c.Pool.Query(ctx, `
+		SELECT seq, channel, event_type, entity, entity_id, old_value, new_value, payload, created_at
+		FROM events
+		WHERE seq > $1
+		ORDER BY seq
+		LIMIT $2`, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var e Event
+		var oldValue, newValue, payload []byte
+		err := row.Scan(&e.Seq, &e.Channel, &e.EventType, &e.Entity, &e.EntityID,
+			&oldValue, &newValue, &payload, &e.CreatedAt)
+		e.Old, e.New, e.Payload = oldValue, newValue, payload
+		return e, err
+	})
+}
+
+// Run delivers events after the consumer's acknowledged position to out,
+// in sequence order, until ctx is cancelled. Delivery does not acknowledge:
+// the receiver calls Ack once it has handled an event, so events that were
+// delivered but not handled before a crash are delivered again on restart.
+func (c *Consumer) Run(ctx context.Context, out chan<- Event) error {
+	logger := c.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	batch := c.BatchSize
+	if batch <= 0 {
+		batch = 500
+	}
+	poll := c.PollInterval
+	if poll <= 0 {
+		poll = 5 * time.Second
+	}
+
+	cursor, err := c.Position(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Coalesce wake-ups: one pending read covers any number of new events.
+	// A reconnect also wakes the reader, which then catches up.
+	wake := make(chan struct{}, 1)
+	notifications := make(chan Notification)
+	go func() {
+		for range notifications {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	go func() {
+		l := &Listener{ConnString: c.ConnString, Channels: []string{WakeChannel}, Logger: c.Logger, OnReconnect: c.OnReconnect}
+		l.Run(ctx, notifications)
+		close(notifications)
+	}()
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		for {
+			events, err := c.Fetch(ctx, cursor, batch)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				logger.Warn("events consumer failed to read outbox", "consumer", c.Name, "err", err)
+				break
+			}
+			for _, e := range events {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return nil
+				}
+				cursor = e.Seq
+			}
+			if len(events) < batch {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
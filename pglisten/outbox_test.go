@@ -0,0 +1,205 @@
+package pglisten
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testSchema holds the outbox tables the tests use, in the database at
+// TEST_DATABASE_URL. It mirrors schema/migrations/013_create_events.sql.
+const testSchema = `
+DROP SCHEMA IF EXISTS pglisten_test CASCADE;
+CREATE SCHEMA pglisten_test;
+CREATE TABLE pglisten_test.events (
+    seq         BIGSERIAL PRIMARY KEY,
+    channel     VARCHAR(64) NOT NULL,
+    event_type  VARCHAR(64) NOT NULL,
+    entity      VARCHAR(32) NOT NULL,
+    entity_id   TEXT NOT NULL,
+    old_value   JSONB NULL,
+    new_value   JSONB NULL,
+    payload     JSONB NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE TABLE pglisten_test.event_consumers (
+    consumer    VARCHAR(64) PRIMARY KEY,
+    last_seq    BIGINT NOT NULL DEFAULT 0,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);`
+
+// openOutbox creates the outbox tables in a schema of their own and returns
+// a pool and connection string that use it.
+func openOutbox(t *testing.T) (*pgxpool.Pool, string) {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", "pglisten_test")
+	q.Set("application_name", "pglisten_test")
+	u.RawQuery = q.Encode()
+	connString := u.String()
+
+	pool, err := pgxpool.New(context.Background(), connString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	if _, err := pool.Exec(context.Background(), testSchema); err != nil {
+		t.Fatal(err)
+	}
+	return pool, connString
+}
+
+// appendEvent adds an event to the outbox and wakes consumers, as
+// record_event does.
+func appendEvent(t *testing.T, pool *pgxpool.Pool, id string) {
+	t.Helper()
+	payload, _ := json.Marshal(map[string]string{"id": id})
+	_, err := pool.Exec(context.Background(),
+		`WITH e AS (
+			INSERT INTO events (channel, event_type, entity, entity_id, payload)
+			VALUES ('task_updates', 'UPDATE', 'task', $1, $2)
+			RETURNING seq
+		 )
+		 SELECT pg_notify('events', seq::text) FROM e`,
+		id, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runConsumer runs c until the test ends, returning the events it delivers.
+func runConsumer(t *testing.T, c *Consumer) <-chan Event {
+	t.Helper()
+	c.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	out := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := c.Run(ctx, out); err != nil {
+			t.Errorf("consumer: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return out
+}
+
+// receive waits for the next event and checks which entity it is about.
+func receive(t *testing.T, events <-chan Event, wantID string) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		if e.EntityID != wantID {
+			t.Fatalf("got event for %q, want %q", e.EntityID, wantID)
+		}
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for the event for %q", wantID)
+		return Event{}
+	}
+}
+
+func TestConsumerStartsWithFirstEvent(t *testing.T) {
+	pool, connString := openOutbox(t)
+	appendEvent(t, pool, "before")
+
+	events := runConsumer(t, &Consumer{Name: "test", Pool: pool, ConnString: connString})
+	receive(t, events, "before")
+	appendEvent(t, pool, "after")
+	receive(t, events, "after")
+}
+
+func TestConsumerStartAtEnd(t *testing.T) {
+	pool, connString := openOutbox(t)
+	appendEvent(t, pool, "before")
+
+	c := &Consumer{Name: "test", Pool: pool, ConnString: connString, StartAtEnd: true}
+	if _, err := c.Position(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := runConsumer(t, c)
+	appendEvent(t, pool, "after")
+	receive(t, events, "after")
+}
+
+// A restarted consumer resumes after the last event it acknowledged,
+// including events added while it was not running.
+func TestConsumerResumesAfterAck(t *testing.T) {
+	pool, connString := openOutbox(t)
+	ctx := context.Background()
+	appendEvent(t, pool, "one")
+	appendEvent(t, pool, "two")
+
+	c := &Consumer{Name: "test", Pool: pool, ConnString: connString, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	runCtx, cancel := context.WithCancel(ctx)
+	out := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Run(runCtx, out)
+	}()
+	one := receive(t, out, "one")
+	receive(t, out, "two")
+	cancel()
+	<-done
+	if err := c.Ack(ctx, one.Seq); err != nil {
+		t.Fatal(err)
+	}
+	appendEvent(t, pool, "three")
+
+	events := runConsumer(t, &Consumer{Name: "test", Pool: pool, ConnString: connString})
+	receive(t, events, "two")
+	receive(t, events, "three")
+
+	if err := c.Remove(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM event_consumers WHERE consumer = 'test'`).Scan(&n); err != nil || n != 0 {
+		t.Errorf("expected the consumer to be removed, got %d rows, %v", n, err)
+	}
+}
+
+// Events added while the wake-up connection is down are delivered once it
+// is back, without waiting for the poll.
+func TestConsumerCatchesUpAfterReconnect(t *testing.T) {
+	pool, connString := openOutbox(t)
+	ctx := context.Background()
+
+	reconnected := make(chan struct{}, 1)
+	events := runConsumer(t, &Consumer{Name: "test", Pool: pool, ConnString: connString,
+		PollInterval: time.Hour, OnReconnect: func() { reconnected <- struct{}{} }})
+	appendEvent(t, pool, "before")
+	receive(t, events, "before")
+
+	if _, err := pool.Exec(ctx,
+		`SELECT pg_terminate_backend(pid) FROM pg_stat_activity
+		 WHERE application_name = 'pglisten_test' AND query ILIKE 'LISTEN%' AND pid != pg_backend_pid()`); err != nil {
+		t.Fatal(err)
+	}
+	appendEvent(t, pool, "missed")
+	select {
+	case <-reconnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the listener to reconnect")
+	}
+	receive(t, events, "missed")
+}
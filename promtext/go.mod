@@ -0,0 +1,3 @@
+module github.com/affanhamid/editor/promtext
+
+go 1.22
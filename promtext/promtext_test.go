@@ -0,0 +1,88 @@
+package promtext
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	tasks := r.Gauge("architect_tasks", "Tasks by status.", "status")
+	exits := r.Counter("architect_agent_exits_total", "Agent exits by reason.", "reason")
+	duration := r.Histogram("architect_task_duration_seconds", "Active time.", []float64{1, 10}, "status")
+	up := r.Gauge("architect_up", "Whether the process is up.\nSecond line.")
+
+	tasks.Set(3, "pending")
+	tasks.Set(1, `in "progress"`)
+	tasks.Add(-1, "pending")
+	exits.Inc("exit")
+	exits.Add(2, "exit")
+	duration.Observe(0.5, "completed")
+	duration.Observe(5, "completed")
+	duration.Observe(50, "completed")
+	up.Set(1)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP architect_tasks Tasks by status.
+# TYPE architect_tasks gauge
+architect_tasks{status="in \"progress\""} 1
+architect_tasks{status="pending"} 2
+# HELP architect_agent_exits_total Agent exits by reason.
+# TYPE architect_agent_exits_total counter
+architect_agent_exits_total{reason="exit"} 3
+# HELP architect_task_duration_seconds Active time.
+# TYPE architect_task_duration_seconds histogram
+architect_task_duration_seconds_bucket{status="completed",le="1"} 1
+architect_task_duration_seconds_bucket{status="completed",le="10"} 2
+architect_task_duration_seconds_bucket{status="completed",le="+Inf"} 3
+architect_task_duration_seconds_sum{status="completed"} 55.5
+architect_task_duration_seconds_count{status="completed"} 3
+# HELP architect_up Whether the process is up.\nSecond line.
+# TYPE architect_up gauge
+architect_up 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLabelCountMismatchPanics(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("c_total", "c", "a", "b")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	c.Inc("only-one")
+}
+
+func TestServeRejectsBadAddress(t *testing.T) {
+	r := NewRegistry()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := r.Serve(ctx, "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Serve(ctx, "not an address"); err == nil {
+		t.Error("expected an error for a bad address")
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("served_total", "Served.").Inc()
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "served_total 1\n") {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
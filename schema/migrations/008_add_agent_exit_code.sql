@@ -0,0 +1,2 @@
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS exit_code INT NULL;
+ALTER TABLE agents ADD COLUMN IF NOT EXISTS finished_at TIMESTAMPTZ NULL;
@@ -0,0 +1,19 @@
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_status_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_status_check CHECK (status IN ('pending', 'in_progress', 'completed', 'failed', 'blocked', 'cancelled'));
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS orchestrator_commands (
+    id          BIGSERIAL PRIMARY KEY,
+    command     VARCHAR(32) NOT NULL CHECK (command IN ('add_task', 'cancel_task', 'retry_task', 'update_task', 'add_edge', 'remove_edge', 'kill_agent')),
+    args        JSONB NOT NULL DEFAULT '{}',
+    issued_by   VARCHAR(64) NOT NULL DEFAULT 'human',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS command_results (
+    command_id  BIGINT PRIMARY KEY REFERENCES orchestrator_commands(id),
+    applied     BOOLEAN NOT NULL,
+    reason      TEXT NULL,
+    result      JSONB NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS sandbox_violations (
+    id         BIGSERIAL PRIMARY KEY,
+    agent_id   VARCHAR(64) NOT NULL,
+    task_id    BIGINT NULL,
+    detail     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_sandbox_violations_agent ON sandbox_violations(agent_id, created_at);
@@ -0,0 +1,6 @@
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS file_scope TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS allow_overlap BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS base_sha VARCHAR(64) NULL;
+
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS messages_msg_type_check;
+ALTER TABLE messages ADD CONSTRAINT messages_msg_type_check CHECK (msg_type IN ('update', 'question', 'answer', 'blocker', 'discovery', 'decision', 'warning'));
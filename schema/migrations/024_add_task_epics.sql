@@ -0,0 +1,70 @@
+CREATE INDEX IF NOT EXISTS idx_tasks_parent ON tasks(parent_id);
+
+-- epic_status derives an epic's status from its children: completed once
+-- every child is completed or cancelled, cancelled if all of them are,
+-- in progress or blocked while any child is, failed if a child failed and
+-- none is running, and pending until work starts.
+CREATE OR REPLACE FUNCTION epic_status(p_epic BIGINT) RETURNS VARCHAR AS $$
+    SELECT CASE
+        WHEN bool_and(status = 'cancelled') THEN 'cancelled'
+        WHEN bool_and(status IN ('completed', 'cancelled')) THEN 'completed'
+        WHEN bool_or(status = 'in_progress') THEN 'in_progress'
+        WHEN bool_or(status = 'blocked') THEN 'blocked'
+        WHEN bool_or(status = 'failed') THEN 'failed'
+        WHEN bool_or(status = 'completed') THEN 'in_progress'
+        ELSE 'pending'
+    END
+    FROM tasks
+    WHERE parent_id = p_epic;
+$$ LANGUAGE sql STABLE;
+
+CREATE OR REPLACE FUNCTION roll_up_epic(p_epic BIGINT) RETURNS VOID AS $$
+DECLARE
+    v_status VARCHAR;
+BEGIN
+    -- Lock the epic before reading its children, so when two children
+    -- change at once the later roll-up sees both changes.
+    PERFORM 1 FROM tasks WHERE id = p_epic FOR UPDATE;
+    v_status := epic_status(p_epic);
+    UPDATE tasks SET status = v_status, updated_at = NOW()
+    WHERE id = p_epic AND status IS DISTINCT FROM v_status;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Children are updated by agents too, whose roles cannot write the epic,
+-- so the roll-up runs as the table's owner.
+CREATE OR REPLACE FUNCTION roll_up_epic_status() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE' AND OLD.parent_id IS NOT NULL AND OLD.parent_id IS DISTINCT FROM NEW.parent_id THEN
+        PERFORM roll_up_epic(OLD.parent_id);
+    END IF;
+    IF NEW.parent_id IS NOT NULL THEN
+        PERFORM roll_up_epic(NEW.parent_id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql SECURITY DEFINER SET search_path = public, pg_temp;
+
+DROP TRIGGER IF EXISTS trg_task_roll_up_insert ON tasks;
+CREATE TRIGGER trg_task_roll_up_insert AFTER INSERT ON tasks
+FOR EACH ROW
+WHEN (NEW.parent_id IS NOT NULL)
+EXECUTE FUNCTION roll_up_epic_status();
+
+DROP TRIGGER IF EXISTS trg_task_roll_up ON tasks;
+CREATE TRIGGER trg_task_roll_up AFTER UPDATE ON tasks
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.parent_id IS DISTINCT FROM NEW.parent_id)
+EXECUTE FUNCTION roll_up_epic_status();
+
+-- task_blockers lists what each task waits for: the tasks blocking it
+-- directly, and those blocking its epic.
+CREATE OR REPLACE VIEW task_blockers AS
+SELECT e.from_task AS blocker_id, e.to_task AS task_id
+FROM task_edges e
+WHERE e.edge_type = 'blocks'
+UNION
+SELECT e.from_task, t.id
+FROM task_edges e
+JOIN tasks t ON t.parent_id = e.to_task
+WHERE e.edge_type = 'blocks';
@@ -19,6 +19,8 @@ psql -U $DB_ADMIN -d postgres <<SQL
     END IF;
   END
   \$\$;
+  -- Lets the orchestrator create a scoped role for each agent.
+  ALTER ROLE $DB_USER CREATEROLE;
   GRANT ALL PRIVILEGES ON DATABASE $DB_NAME TO $DB_USER;
   ALTER DATABASE $DB_NAME OWNER TO $DB_USER;
 SQL
@@ -1,13 +1,28 @@
 CREATE OR REPLACE FUNCTION notify_agent_update() RETURNS TRIGGER AS $$
 BEGIN
-    PERFORM pg_notify('agent_updates', json_build_object(
-        'agent_id', NEW.agent_id,
-        'status', NEW.status,
-        'current_task_id', NEW.current_task_id
-    )::text);
+    PERFORM record_event(
+        'agent_updates',
+        'agent.' || lower(TG_OP),
+        'agent',
+        (NEW.agent_id)::text,
+        CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'agent_id', NEW.agent_id,
+            'status', NEW.status,
+            'current_task_id', NEW.current_task_id
+        )
+    );
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
 
+-- Heartbeats alone are not events; only inserts and state changes are recorded.
 DROP TRIGGER IF EXISTS trg_agent_notify ON agents;
-CREATE TRIGGER trg_agent_notify AFTER INSERT OR UPDATE ON agents FOR EACH ROW EXECUTE FUNCTION notify_agent_update();
+CREATE TRIGGER trg_agent_notify AFTER INSERT ON agents FOR EACH ROW EXECUTE FUNCTION notify_agent_update();
+
+DROP TRIGGER IF EXISTS trg_agent_update_notify ON agents;
+CREATE TRIGGER trg_agent_update_notify AFTER UPDATE ON agents
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.current_task_id IS DISTINCT FROM NEW.current_task_id)
+EXECUTE FUNCTION notify_agent_update();
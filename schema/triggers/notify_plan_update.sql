@@ -0,0 +1,29 @@
+CREATE OR REPLACE FUNCTION notify_plan_update() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM record_event(
+        'plan_updates',
+        'plan.' || lower(TG_OP),
+        'plan',
+        (NEW.id)::text,
+        CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'id', NEW.id,
+            'status', NEW.status,
+            'prompt', NEW.prompt,
+            'proposed', NEW.proposed,
+            'review_error', NEW.review_error
+        )
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_plan_notify ON plans;
+CREATE TRIGGER trg_plan_notify AFTER INSERT ON plans FOR EACH ROW EXECUTE FUNCTION notify_plan_update();
+
+DROP TRIGGER IF EXISTS trg_plan_update_notify ON plans;
+CREATE TRIGGER trg_plan_update_notify AFTER UPDATE ON plans
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.review_error IS DISTINCT FROM NEW.review_error)
+EXECUTE FUNCTION notify_plan_update();
@@ -0,0 +1,22 @@
+CREATE OR REPLACE FUNCTION notify_swarm_update() RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM record_event(
+        'swarm_updates',
+        'swarm.' || lower(TG_OP),
+        'swarm',
+        (NEW.id)::text,
+        CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'paused', NEW.paused
+        )
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trg_swarm_notify ON swarm_state;
+CREATE TRIGGER trg_swarm_notify AFTER UPDATE ON swarm_state
+FOR EACH ROW
+WHEN (OLD.paused IS DISTINCT FROM NEW.paused)
+EXECUTE FUNCTION notify_swarm_update();
@@ -1,10 +1,19 @@
 CREATE OR REPLACE FUNCTION notify_task_update() RETURNS TRIGGER AS $$
 BEGIN
-    PERFORM pg_notify('task_updates', json_build_object(
-        'id', NEW.id,
-        'status', NEW.status,
-        'assigned_to', NEW.assigned_to
-    )::text);
+    PERFORM record_event(
+        'task_updates',
+        'task.' || lower(TG_OP),
+        'task',
+        (NEW.id)::text,
+        CASE WHEN TG_OP = 'UPDATE' THEN to_jsonb(OLD) END,
+        to_jsonb(NEW),
+        jsonb_build_object(
+            'id', NEW.id,
+            'status', NEW.status,
+            'assigned_to', NEW.assigned_to,
+            'epic', EXISTS (SELECT 1 FROM tasks c WHERE c.parent_id = NEW.id)
+        )
+    );
     RETURN NEW;
 END;
 $$ LANGUAGE plpgsql;
@@ -0,0 +1,263 @@
+// Package tracing records OpenTelemetry spans for the orchestrator and
+// mcp-pg with the OpenTelemetry SDK, exporting them over OTLP/HTTP or to a
+// file through the stdout exporter, one JSON span per line. It wraps the SDK
+// in the few calls both programs need: spans with slog attributes, and W3C
+// trace context to hand the context of a task to an agent's mcp-pg.
+//
+// Until Setup is called with an endpoint or a file, Start returns a nil
+// *Span, whose methods do nothing.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Environment variables through which the orchestrator hands its tracing
+// settings, and the context of the task an agent works on, to mcp-pg.
+const (
+	// TraceparentEnv holds a W3C traceparent header value.
+	TraceparentEnv = "TRACEPARENT"
+	// EndpointEnv is the standard OTLP endpoint variable.
+	EndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	FileEnv     = "ARCHITECT_TRACE_FILE"
+	// TraceparentFileEnv names a file holding a traceparent that may change
+	// while the process runs, such as that of an agent's current task. It
+	// takes precedence over TraceparentEnv.
+	TraceparentFileEnv = "ARCHITECT_TRACEPARENT_FILE"
+)
+
+// scope names the instrumentation in exported spans.
+const scope = "github.com/affanhamid/editor/tracing"
+
+// Options configure Setup.
+type Options struct {
+	// Endpoint is an OTLP/HTTP collector, e.g. http://localhost:4318.
+	// Spans are posted to its /v1/traces path.
+	Endpoint string
+	// File is appended to with one JSON span per line, as written by the
+	// OpenTelemetry stdout exporter.
+	File string
+	// ServiceName names the process in the exported resource.
+	ServiceName string
+	// RunID, if set, is attached to the resource as run_id.
+	RunID string
+}
+
+// Enabled reports whether the options export spans anywhere.
+func (o Options) Enabled() bool {
+	return o.Endpoint != "" || o.File != ""
+}
+
+// OptionsFromEnv reads the options the orchestrator passed in the
+// environment (see Env).
+func OptionsFromEnv(serviceName, runID string) Options {
+	return Options{
+		Endpoint:    os.Getenv(EndpointEnv),
+		File:        os.Getenv(FileEnv),
+		ServiceName: serviceName,
+		RunID:       runID,
+	}
+}
+
+// Env returns the variables that make a child process export to the same
+// place as opts, with its spans parented to the span in ctx.
+func Env(ctx context.Context, opts Options) map[string]string {
+	env := map[string]string{}
+	if !opts.Enabled() {
+		return env
+	}
+	if opts.Endpoint != "" {
+		env[EndpointEnv] = opts.Endpoint
+	}
+	if opts.File != "" {
+		env[FileEnv] = opts.File
+	}
+	if tp := Traceparent(ctx); tp != "" {
+		env[TraceparentEnv] = tp
+	}
+	return env
+}
+
+// Span is an operation being traced. A nil *Span is valid and does nothing.
+type Span struct {
+	span trace.Span
+}
+
+var (
+	mu     sync.RWMutex
+	tracer trace.Tracer
+)
+
+// Setup starts exporting spans as opts say. The returned function flushes
+// buffered spans and stops exporting; it must be called before exit.
+func Setup(opts Options) (shutdown func(context.Context) error, err error) {
+	if !opts.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", opts.ServiceName)}
+	if opts.RunID != "" {
+		attrs = append(attrs, attribute.String("run_id", opts.RunID))
+	}
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+	}
+
+	if opts.Endpoint != "" {
+		exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(tracesURL(opts.Endpoint)))
+		if err != nil {
+			return nil, fmt.Errorf("create OTLP exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exp))
+	}
+	var file *os.File
+	if opts.File != "" {
+		file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("create file exporter: %w", err)
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exp))
+	}
+
+	// Export failures are worth a warning, not a failed run.
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("failed to export spans", "err", err)
+	}))
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	t := provider.Tracer(scope)
+	mu.Lock()
+	tracer = t
+	mu.Unlock()
+	return func(ctx context.Context) error {
+		mu.Lock()
+		if tracer == t {
+			tracer = nil
+		}
+		mu.Unlock()
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// tracesURL is the collector URL spans are posted to.
+func tracesURL(endpoint string) string {
+	endpoint = strings.TrimRight(endpoint, "/")
+	if !strings.HasSuffix(endpoint, "/v1/traces") {
+		endpoint += "/v1/traces"
+	}
+	return endpoint
+}
+
+// Start starts a span, a child of the span in ctx if there is one, and
+// returns a context carrying it. The span must be ended with End.
+func Start(ctx context.Context, name string, attrs ...slog.Attr) (context.Context, *Span) {
+	mu.RLock()
+	t := tracer
+	mu.RUnlock()
+	if t == nil {
+		return ctx, nil
+	}
+	ctx, span := t.Start(ctx, name, trace.WithAttributes(attributes(attrs)...))
+	return ctx, &Span{span: span}
+}
+
+// ContextWithSpan returns ctx with span as the parent of spans started from
+// it, for spans that outlive the call that started them.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return trace.ContextWithSpan(ctx, span.span)
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...slog.Attr) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attributes(attrs)...)
+}
+
+// SetError marks the span as failed with err. A nil err does nothing.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End ends the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.span.End()
+}
+
+// EndWithError records err, if any, and ends the span.
+func (s *Span) EndWithError(err error) {
+	s.SetError(err)
+	s.End()
+}
+
+// attributes converts slog attributes to OpenTelemetry ones.
+func attributes(attrs []slog.Attr) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		v := a.Value.Resolve()
+		switch v.Kind() {
+		case slog.KindInt64:
+			kvs = append(kvs, attribute.Int64(a.Key, v.Int64()))
+		case slog.KindUint64:
+			kvs = append(kvs, attribute.Int64(a.Key, int64(v.Uint64())))
+		case slog.KindFloat64:
+			kvs = append(kvs, attribute.Float64(a.Key, v.Float64()))
+		case slog.KindBool:
+			kvs = append(kvs, attribute.Bool(a.Key, v.Bool()))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, v.String()))
+		}
+	}
+	return kvs
+}
+
+// traceContext reads and writes W3C traceparent headers.
+var traceContext = propagation.TraceContext{}
+
+// Traceparent returns the W3C traceparent of the span in ctx, or "".
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// ContextWithTraceparent returns ctx with the span described by a W3C
+// traceparent as the parent of spans started from it. An invalid
+// traceparent leaves ctx as it is.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	return traceContext.Extract(ctx, propagation.MapCarrier{"traceparent": strings.TrimSpace(traceparent)})
+}
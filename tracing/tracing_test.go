@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDisabledSpansDoNothing(t *testing.T) {
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil {
+		t.Fatal("expected a nil span without Setup")
+	}
+	span.SetAttributes(slog.Int64("task_id", 1))
+	span.EndWithError(errors.New("ignored"))
+	if tp := Traceparent(ctx); tp != "" {
+		t.Errorf("Traceparent = %q, want empty", tp)
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	tp := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := ContextWithTraceparent(context.Background(), tp)
+	if got := Traceparent(ctx); got != tp {
+		t.Errorf("Traceparent = %q, want %q", got, tp)
+	}
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736ffff-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if got := Traceparent(ContextWithTraceparent(context.Background(), bad)); got != "" {
+			t.Errorf("%q: Traceparent = %q, want empty", bad, got)
+		}
+	}
+}
+
+func TestFileExport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown, err := Setup(Options{File: path, ServiceName: "test", RunID: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := ContextWithTraceparent(context.Background(), remote)
+	ctx, parent := Start(ctx, "task", slog.Int64("task_id", 42))
+	_, child := Start(ctx, "create_worktree")
+	child.EndWithError(errors.New("disk full"))
+	parent.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spans []exportedSpan
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var s exportedSpan
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			t.Fatalf("not one JSON span per line: %v\n%s", err, data)
+		}
+		spans = append(spans, s)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if p.SpanContext.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || p.Parent.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("task span not parented to the remote span: %+v", p)
+	}
+	if c.SpanContext.TraceID != p.SpanContext.TraceID || c.Parent.SpanID != p.SpanContext.SpanID {
+		t.Errorf("child span not parented to the task span: %+v", c)
+	}
+	if c.Status.Code != "Error" || c.Status.Description != "disk full" {
+		t.Errorf("child status = %+v", c.Status)
+	}
+	if a := p.Attributes[0]; a.Key != "task_id" || a.Value.Value != float64(42) {
+		t.Errorf("task attributes = %+v", p.Attributes)
+	}
+	if !slices.Contains(p.Resource, exportedAttr{Key: "run_id", Value: exportedValue{Type: "STRING", Value: "run-1"}}) {
+		t.Errorf("resource = %+v", p.Resource)
+	}
+}
+
+// exportedSpan is the part of a span written by the stdout exporter that
+// the tests check.
+type exportedSpan struct {
+	Name        string
+	SpanContext struct{ TraceID, SpanID string }
+	Parent      struct{ TraceID, SpanID string }
+	Status      struct{ Code, Description string }
+	Attributes  []exportedAttr
+	Resource    []exportedAttr
+}
+
+type exportedAttr struct {
+	Key   string
+	Value exportedValue
+}
+
+type exportedValue struct {
+	Type  string
+	Value any
+}
+
+func TestHTTPExport(t *testing.T) {
+	got := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got <- r.URL.Path + " " + r.Header.Get("Content-Type")
+	}))
+	defer srv.Close()
+
+	shutdown, err := Setup(Options{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := Start(context.Background(), "run")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if req := <-got; req != "/v1/traces application/x-protobuf" {
+		t.Errorf("request = %q", req)
+	}
+}